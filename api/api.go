@@ -2,8 +2,10 @@
 package api
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strings"
 
@@ -46,7 +48,15 @@ func handleError(w http.ResponseWriter, err error) (code int) {
 		code = err.StatusCode
 	}
 
-	response := newErrorResponse(msg, code)
+	// Errors of the cf-ssl packages are reported with their own
+	// code; other errors with the HTTP status.
+	errCode := code
+	if cfErr := causeError(err); cfErr != nil {
+		errCode = cfErr.ErrorCode
+		msg = cfErr.Message
+	}
+
+	response := newErrorResponse(msg, errCode)
 	jsonMessage, err := json.Marshal(response)
 	if err != nil {
 		log.Errorf("Failed to marshal JSON: %v", err)
@@ -57,6 +67,16 @@ func handleError(w http.ResponseWriter, err error) (code int) {
 	return code
 }
 
+// causeError returns the cf-ssl error that caused err, or nil if err
+// was not caused by one.
+func causeError(err error) *errors.Error {
+	if httpErr, ok := err.(*errors.HttpError); ok {
+		err = httpErr.Cause()
+	}
+	cfErr, _ := err.(*errors.Error)
+	return cfErr
+}
+
 // ServeHTTP encapsulates the call to underlying Handler to handle the request
 // and return the response with proper HTTP status code
 func (h HttpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -71,6 +91,29 @@ func (h HttpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Infof("%s - \"%s %s\" %d", r.RemoteAddr, r.Method, r.URL, status)
 }
 
+// clientCertificate returns the verified TLS client certificate of
+// the request, or nil if the client presented none.
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// requester identifies the client making a request, by the common
+// name of its TLS client certificate or else by its remote address,
+// for the records of the certificates issued to it.
+func requester(r *http.Request) string {
+	if cert := clientCertificate(r); cert != nil && cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // readRequestBlob takes a JSON-blob-encoded response body in the form
 // map[string]string and returns it, the list of keywords presented,
 // and any error that occurred.
@@ -162,7 +205,7 @@ func matchKeywords(blob map[string]string, keywords []string) bool {
 // ResponseMessage implements the standard for response errors and
 // messages. A message has a code and a string message.
 type ResponseMessage struct {
-	Code    int    `json:"int"`
+	Code    int    `json:"code"`
 	Message string `json:"message"`
 }
 
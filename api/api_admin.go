@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// An AdminHandler serves the requests to an administrative endpoint,
+// such as OCSP signing, that the admin policy of the config allows.
+type AdminHandler struct {
+	handler http.Handler
+	policy  *config.AdminPolicy
+}
+
+// NewAdminHandler restricts the endpoint served by h to the requests
+// allowed by the admin policy. If the policy names an auth key, the
+// body of a request is an auth.AuthenticatedRequest whose "request" is
+// the body passed on to h. It returns an error if there is no admin
+// policy, so that administrative endpoints are only served when the
+// config asks for them.
+func NewAdminHandler(h http.Handler, policy *config.AdminPolicy) (http.Handler, error) {
+	if policy == nil {
+		return nil, errors.New(errors.PolicyError, errors.InvalidPolicy, nil)
+	}
+	return &AdminHandler{handler: h, policy: policy}, nil
+}
+
+// ServeHTTP passes the request on to the wrapped handler if the admin
+// policy allows it, and refuses it otherwise.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Requests with other verbs are refused by the wrapped handler.
+	if r.Method == "POST" {
+		if err := h.authorize(r); err != nil {
+			status := handleError(w, err)
+			log.Infof("%s - \"%s %s\" %d", r.RemoteAddr, r.Method, r.URL, status)
+			return
+		}
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// authorize checks the client certificate and authentication of the
+// request against the admin policy, and replaces the body of an
+// authenticated request with the request it authenticates.
+func (h *AdminHandler) authorize(r *http.Request) error {
+	if !h.policy.AllowsClient(clientCertificate(r)) {
+		log.Warningf("client %s is not allowed to use %s", requester(r), r.URL.Path)
+		return errors.NewForbiddenString("the client is not allowed to use the endpoint")
+	}
+	if h.policy.Provider == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Warningf("failed to read request body: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	r.Body.Close()
+
+	var aReq auth.AuthenticatedRequest
+	if err = json.Unmarshal(body, &aReq); err != nil {
+		log.Warningf("failed to unmarshal authenticated request: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	if len(aReq.Request) == 0 {
+		return missingParamsError([]string{"request"})
+	}
+	if !h.policy.Provider.Verify(&aReq) {
+		log.Warningf("authentication failed for %s", r.URL.Path)
+		return errors.NewUnauthorizedString("invalid authentication token")
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(aReq.Request))
+	return nil
+}
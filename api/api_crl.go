@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/crl"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// A CRLHandler accepts requests with a list of revoked certificates
+// and returns a CRL signed by the CA. With a certificate database,
+// the CRL lists the certificates revoked in the database instead.
+type CRLHandler struct {
+	signer *crl.Signer
+	db     certdb.Accessor
+}
+
+// CRLRequest is the JSON request accepted by a CRLHandler.
+type CRLRequest struct {
+	Revoked []crl.RevokedCertificate `json:"revoked"`
+}
+
+// NewCRLHandler generates a new CRLHandler from the CA's certificate
+// and private key. Each generated CRL is valid for the given expiry.
+// If db is not nil, the revoked certificates are read from it.
+func NewCRLHandler(caFile, caKeyFile string, expiry time.Duration, db certdb.Accessor) (http.Handler, error) {
+	var err error
+	h := &CRLHandler{db: db}
+	if h.signer, err = crl.NewSignerFromFile(caFile, caKeyFile, expiry); err != nil {
+		log.Errorf("setting up CRL signer failed: %v", err)
+		return nil, err
+	}
+	return HttpHandler{h, "POST"}, nil
+}
+
+// Handle responds to requests for a CRL listing the revoked
+// certificates in the "revoked" parameter, or those revoked in the
+// certificate database, in which case the parameter must be left out.
+// The CRL is returned PEM-encoded.
+func (h *CRLHandler) Handle(w http.ResponseWriter, r *http.Request) error {
+	log.Info("CRL request received")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Warningf("failed to read request body: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	r.Body.Close()
+
+	var req CRLRequest
+	if err = json.Unmarshal(body, &req); err != nil {
+		log.Warningf("failed to unmarshal request: %v", err)
+		return errors.NewBadRequest(err)
+	}
+
+	var der []byte
+	if h.db == nil {
+		der, err = h.signer.Sign(req.Revoked)
+	} else if len(req.Revoked) > 0 {
+		return errors.NewBadRequestString("revoked certificates are read from the certificate database")
+	} else {
+		der, err = h.signer.SignFromDB(h.db)
+	}
+	if err != nil {
+		log.Warningf("failed to sign CRL: %v", err)
+		return errors.NewBadRequest(err)
+	}
+
+	result := map[string]string{"crl": string(crl.EncodePEM(der))}
+	log.Info("wrote response")
+	return sendResponse(w, result)
+}
@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"time"
 
-	"github.com/cloudflare/cfssl/api/client"
 	"github.com/cloudflare/cfssl/csr"
 	"github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+	"github.com/cloudflare/cfssl/signer/remote"
 )
 
 type Validator func(*csr.CertificateRequest) error
@@ -54,11 +56,10 @@ func (g *GeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) error
 		return errors.NewBadRequest(err)
 	}
 
-	key, csr, err := g.generator.ProcessRequest(req)
+	csr, key, err := g.generator.ProcessRequest(req)
 	if err != nil {
 		log.Warningf("failed to process CSR: %v", err)
-		// The validator returns a *cfssl/errors.HttpError
-		return err
+		return requestError(err)
 	}
 
 	// Both key and csr are returned PEM-encoded.
@@ -71,30 +72,45 @@ func (g *GeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) error
 
 // A CertGeneratorHandler accepts JSON-encoded certificate requests
 // and returns a new private key and signed certificate; it handles
-// sending the CSR to the server.
+// sending the CSR to the signer, which may be local or remote.
 type CertGeneratorHandler struct {
 	generator *csr.Generator
-	signer    *signer.Signer
+	signer    signer.Signer
 }
 
 // NewGeneratorHandler builds a new GeneratorHandler from the
 // validation function provided.
 func NewCertGeneratorHandler(validator Validator, caFile, caKeyFile string) (http.Handler, error) {
-	var err error
 	log.Info("setting up new generator / signer")
-	cg := new(CertGeneratorHandler)
-	if cg.signer, err = signer.NewSigner(caFile, caKeyFile, nil); err != nil {
+	s, err := local.NewSignerFromFile(caFile, caKeyFile, nil)
+	if err != nil {
 		return nil, err
 	}
-	cg.generator = &csr.Generator{validator}
+	return NewCertGeneratorHandlerFromSigner(validator, s), nil
+}
 
-	return HttpHandler{cg, "POST"}, nil
+// NewCertGeneratorHandlerFromSigner builds a new CertGeneratorHandler
+// that signs certificates with an existing signer, local or remote.
+func NewCertGeneratorHandlerFromSigner(validator Validator, s signer.Signer) http.Handler {
+	return HttpHandler{&CertGeneratorHandler{
+		generator: &csr.Generator{validator},
+		signer:    s,
+	}, "POST"}
 }
 
+// A genSignRequest is the body of a request for a new key and
+// certificate. The hosts the certificate is for are given as a list in
+// "hosts", or as a comma-separated list in "hostname"; if neither is
+// given, the hosts of the certificate request are used. The validity
+// window may be set with RFC 3339 timestamps in "not_before" and
+// "not_after".
 type genSignRequest struct {
-	Hostname string                  `json:"hostname"`
-	Request  *csr.CertificateRequest `json:"request"`
-	Profile  string                  `json:"profile"`
+	Hostname  string                  `json:"hostname"`
+	Hosts     []string                `json:"hosts"`
+	Request   *csr.CertificateRequest `json:"request"`
+	Profile   string                  `json:"profile"`
+	NotBefore time.Time               `json:"not_before"`
+	NotAfter  time.Time               `json:"not_after"`
 }
 
 // Handle responds to requests for the CA to generate a new private
@@ -116,14 +132,35 @@ func (cg *CertGeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) e
 		return errors.NewBadRequest(err)
 	}
 
-	key, csr, err := cg.generator.ProcessRequest(req.Request)
+	if profileProvider(cg.signer, req.Profile) != nil {
+		log.Warningf("unauthenticated request for profile %q", req.Profile)
+		return errors.NewUnauthorizedString("the signing profile requires authentication")
+	}
+	if err = authorizeClient(cg.signer, req.Profile, r); err != nil {
+		return err
+	}
+
+	csrPEM, key, err := cg.generator.ProcessRequest(req.Request)
 	if err != nil {
 		log.Warningf("failed to process CSR: %v", err)
-		// The validator returns a *cfssl/errors.HttpError
-		return err
+		return requestError(err)
 	}
 
-	certPEM, err := cg.signer.Sign(req.Hostname, csr, req.Profile)
+	signReq := signer.SignRequest{
+		Hosts:     req.Hosts,
+		Request:   string(csrPEM),
+		Profile:   req.Profile,
+		NotBefore: req.NotBefore,
+		NotAfter:  req.NotAfter,
+		Requester: requester(r),
+	}
+	if len(signReq.Hosts) == 0 {
+		signReq.Hosts = signer.SplitHosts(req.Hostname)
+	}
+	if len(signReq.Hosts) == 0 {
+		signReq.Hosts = req.Request.Hosts
+	}
+	certPEM, err := cg.signer.Sign(signReq)
 	if err != nil {
 		log.Warningf("failed to sign certificate: %v", err)
 		return errors.NewBadRequest(err)
@@ -136,55 +173,27 @@ func (cg *CertGeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) e
 	return sendResponse(w, result)
 }
 
-type RemoteCertGeneratorHandler struct {
-	generator *csr.Generator
-	remote    *client.Server
-}
-
-func NewRemoteCertGenerator(validator Validator, remote string) (http.Handler, error) {
-	log.Info("setting up a new remote certificate generator")
-	cg := new(RemoteCertGeneratorHandler)
-	if cg.remote = client.NewServer(remote); cg.remote == nil {
-		log.Errorf("invalid address for remote server")
-		return nil, errors.New(errors.DialError, errors.Unknown, nil)
-	}
-
-	cg.generator = &csr.Generator{validator}
-	return HttpHandler{cg, "POST"}, nil
-}
-
-func (rcg *RemoteCertGeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) error {
-	req := new(genSignRequest)
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		log.Warningf("failed to read request body: %v", err)
-		return errors.NewBadRequest(err)
-	}
-
-	err = json.Unmarshal(body, req)
-	if err != nil {
-		log.Warningf("failed to unmarshal request: %v", err)
-		return errors.NewBadRequest(err)
-	}
-
-	csrPEM, key, err := rcg.generator.ProcessRequest(req.Request)
-	if err != nil {
-		log.Warningf("failed to process CSR: %v", err)
-		// The validator returns a *cfssl/errors.HttpError
+// requestError returns the error of processing a certificate request.
+// The validator returns a *cfssl/errors.HttpError; other errors come
+// from a request that cannot be fulfilled, such as one for an unknown
+// key algorithm or key format.
+func requestError(err error) error {
+	if _, ok := err.(*errors.HttpError); ok {
 		return err
 	}
+	return errors.NewBadRequest(err)
+}
 
-	certPEM, err := rcg.remote.Sign(req.Hostname, csrPEM, req.Profile)
+// NewRemoteCertGenerator builds a new CertGeneratorHandler that has
+// the remote CF-SSL server at the given address sign certificates.
+func NewRemoteCertGenerator(validator Validator, remoteAddr string) (http.Handler, error) {
+	log.Info("setting up a new remote certificate generator")
+	s, err := remote.NewSigner(nil, remoteAddr)
 	if err != nil {
-		log.Warningf("failed to send CSR to remote signer: %v", err)
-		return err
-	}
-
-	result := map[string]string{
-		"private_key": string(key),
-		"certificate": string(certPEM),
+		log.Errorf("invalid address for remote server")
+		return nil, err
 	}
-	return sendResponse(w, result)
+	return NewCertGeneratorHandlerFromSigner(validator, s), nil
 }
 
 // CSRValidate contains the default validation logic for certificate requests to
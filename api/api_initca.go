@@ -9,6 +9,7 @@ import (
 	"github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/initca"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
 )
 
 // A NewCA contains a private key and certificate suitable for serving
@@ -55,3 +56,72 @@ func initialCAHandler(w http.ResponseWriter, r *http.Request) error {
 func NewInitCAHandler() http.Handler {
 	return HttpHandler{HandlerFunc(initialCAHandler), "POST"}
 }
+
+// A NewIntermediateCA contains the private key, certificate request
+// and certificate of a new intermediate CA, and the chain of its
+// certificate up to the issuing CA.
+type NewIntermediateCA struct {
+	Key   string `json:"private_key"`
+	CSR   string `json:"certificate_request"`
+	Cert  string `json:"certificate"`
+	Chain string `json:"chain"`
+}
+
+// An IntermediateCAHandler accepts JSON-encoded requests for
+// intermediate CAs, and returns a new private key and certificate
+// signed by its signer.
+type IntermediateCAHandler struct {
+	signer signer.Signer
+}
+
+// NewIntermediateCAHandlerFromSigner builds a new
+// IntermediateCAHandler that signs intermediate CAs with an existing
+// signer, local or remote.
+func NewIntermediateCAHandlerFromSigner(s signer.Signer) http.Handler {
+	return HttpHandler{&IntermediateCAHandler{signer: s}, "POST"}
+}
+
+// An intermediateCARequest is the body of a request for a new
+// intermediate CA: the certificate request for it, in the same format
+// as the CSR endpoint, and the CA profile to sign it under.
+type intermediateCARequest struct {
+	Request *csr.CertificateRequest `json:"request"`
+	Profile string                  `json:"profile"`
+}
+
+// Handle responds to requests for the CA to generate a new
+// intermediate CA. The format for these requests is documented in the
+// API documentation.
+func (h *IntermediateCAHandler) Handle(w http.ResponseWriter, r *http.Request) error {
+	log.Info("request for intermediate CA")
+	req := new(intermediateCARequest)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Warningf("failed to read request body: %v", err)
+		return errors.NewBadRequest(err)
+	}
+
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		log.Warningf("failed to unmarshal request: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	if req.Request == nil {
+		return errors.NewBadRequestMissingParameter("request")
+	}
+
+	if profileProvider(h.signer, req.Profile) != nil {
+		log.Warningf("unauthenticated request for profile %q", req.Profile)
+		return errors.NewUnauthorizedString("the signing profile requires authentication")
+	}
+	if err = authorizeClient(h.signer, req.Profile, r); err != nil {
+		return err
+	}
+
+	key, csrPEM, cert, chain, err := initca.NewIntermediate(req.Request, h.signer, req.Profile)
+	if err != nil {
+		log.Warningf("failed to create intermediate CA: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	return sendResponse(w, &NewIntermediateCA{string(key), string(csrPEM), string(cert), string(chain)})
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+)
+
+// An OCSPSignHandler accepts requests with a certificate and a status
+// and returns a signed OCSP response for that certificate. With a
+// certificate database, the status is the one recorded in the
+// database instead.
+type OCSPSignHandler struct {
+	signer *ocsp.Signer
+	db     certdb.Accessor
+}
+
+// NewOCSPSignHandler generates a new OCSPSignHandler from the issuing
+// CA's certificate and the responder certificate and private key. If
+// responderFile is empty, responses are signed by the CA itself and
+// keyFile should contain the CA's private key. If db is not nil, the
+// status of each certificate is read from it.
+func NewOCSPSignHandler(caFile, responderFile, keyFile string, interval time.Duration, db certdb.Accessor) (http.Handler, error) {
+	var err error
+	h := &OCSPSignHandler{db: db}
+	if h.signer, err = ocsp.NewSignerFromFile(caFile, responderFile, keyFile, interval); err != nil {
+		log.Errorf("setting up OCSP signer failed: %v", err)
+		return nil, err
+	}
+	return HttpHandler{h, "POST"}, nil
+}
+
+// Handle responds to requests for an OCSP response for the
+// PEM-encoded certificate in the "certificate" parameter. The
+// optional "status" parameter defaults to "good"; revoked
+// certificates may also carry "reason" and "revoked_at" (YYYY-MM-DD)
+// parameters. With a certificate database, these parameters must be
+// left out.
+func (h *OCSPSignHandler) Handle(w http.ResponseWriter, r *http.Request) error {
+	log.Info("OCSP signature request received")
+	blob, err := processRequestRequired(r, []string{"certificate"})
+	if err != nil {
+		return err
+	}
+
+	cert, err := helpers.ParseCertificatePEM([]byte(blob["certificate"]))
+	if err != nil {
+		log.Warningf("failed to parse certificate: %v", err)
+		return errors.NewBadRequest(err)
+	}
+
+	if h.db != nil {
+		return h.signFromDB(w, cert, blob)
+	}
+
+	req := ocsp.SignRequest{
+		Certificate: cert,
+		Status:      blob["status"],
+	}
+	if req.Status == "" {
+		req.Status = "good"
+	}
+
+	if req.Status == "revoked" {
+		req.Reason, err = ocsp.ReasonStringToCode(blob["reason"])
+		if err != nil {
+			return errors.NewBadRequest(err)
+		}
+
+		if revokedAt := blob["revoked_at"]; revokedAt == "" || revokedAt == "now" {
+			req.RevokedAt = time.Now()
+		} else if req.RevokedAt, err = time.Parse("2006-01-02", revokedAt); err != nil {
+			return errors.NewBadRequest(err)
+		}
+	}
+
+	return h.sign(w, req)
+}
+
+// signFromDB responds with an OCSP response reporting the status
+// recorded for cert in the certificate database.
+func (h *OCSPSignHandler) signFromDB(w http.ResponseWriter, cert *x509.Certificate, blob map[string]string) error {
+	for _, param := range []string{"status", "reason", "revoked_at"} {
+		if blob[param] != "" {
+			return errors.NewBadRequestString("the status is read from the certificate database")
+		}
+	}
+
+	req, err := ocsp.NewSignRequestFromDB(h.db, cert)
+	if err != nil {
+		log.Warningf("failed to look up certificate: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	return h.sign(w, req)
+}
+
+// sign responds with the OCSP response for req.
+func (h *OCSPSignHandler) sign(w http.ResponseWriter, req ocsp.SignRequest) error {
+	resp, err := h.signer.Sign(req)
+	if err != nil {
+		log.Warningf("failed to sign OCSP response: %v", err)
+		return errors.NewBadRequest(err)
+	}
+
+	result := map[string]string{"ocsp_response": base64.StdEncoding.EncodeToString(resp)}
+	log.Info("wrote response")
+	return sendResponse(w, result)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/revoke"
+)
+
+// A RevokeHandler accepts requests to revoke a certificate and marks
+// it as revoked in the certificate database.
+type RevokeHandler struct {
+	db certdb.Accessor
+}
+
+// NewRevokeHandler generates a new RevokeHandler revoking
+// certificates in the given certificate database.
+func NewRevokeHandler(db certdb.Accessor) (http.Handler, error) {
+	if db == nil {
+		return nil, errors.New(errors.CertStoreError, errors.Unknown, nil)
+	}
+	return HttpHandler{&RevokeHandler{db: db}, "POST"}, nil
+}
+
+// Handle responds to requests to revoke the certificate with the
+// serial number in the "serial" parameter, issued by the authority in
+// the optional "authority_key_id" parameter, for the RFC 5280 reason
+// in the optional "reason" parameter.
+func (h *RevokeHandler) Handle(w http.ResponseWriter, r *http.Request) error {
+	log.Info("revocation request received")
+	blob, err := processRequestRequired(r, []string{"serial"})
+	if err != nil {
+		return err
+	}
+
+	err = revoke.Revoke(h.db, blob["serial"], blob["authority_key_id"], blob["reason"])
+	if err != nil {
+		log.Warningf("failed to revoke certificate: %v", err)
+		return errors.NewBadRequest(err)
+	}
+
+	log.Info("wrote response")
+	return sendResponse(w, map[string]string{})
+}
@@ -1,45 +1,108 @@
 package api
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"time"
 
+	"github.com/cloudflare/cfssl/auth"
 	"github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
 )
 
 // A SignHandler accepts requests with a hostname and certficate
 // parameter (which should be PEM-encoded) and returns a new signed
 // certificate.
 type SignHandler struct {
-	signer *signer.Signer
+	signer signer.Signer
 }
 
 // NewSignHandler generates a new SignHandler using the certificate
 // authority private key and certficate to sign certificates.
 func NewSignHandler(caFile, cakeyFile string) (http.Handler, error) {
-	var err error
-	s := new(SignHandler)
 	// TODO(kyle): add profile loading to API server
-	if s.signer, err = signer.NewSigner(caFile, cakeyFile, nil); err != nil {
+	s, err := local.NewSignerFromFile(caFile, cakeyFile, nil)
+	if err != nil {
 		log.Errorf("setting up signer failed: %v", err)
 		return nil, err
 	}
-	return HttpHandler{s, "POST"}, nil
+	return NewSignHandlerFromSigner(s), nil
+}
+
+// NewSignHandlerFromSigner generates a new SignHandler that signs
+// certificates with an existing signer, local or remote.
+func NewSignHandlerFromSigner(s signer.Signer) http.Handler {
+	return HttpHandler{&SignHandler{signer: s}, "POST"}
+}
+
+// A jsonSignRequest is the body of a signature request. The hosts the
+// certificate is for are given as a list in "hosts", or as a
+// comma-separated list in "hostname". The validity window may be set
+// with RFC 3339 timestamps in "not_before" and "not_after". If
+// "cross_sign" is true, the request is an existing CA certificate to
+// sign again, and no hosts are given.
+type jsonSignRequest struct {
+	Hostname  string    `json:"hostname"`
+	Hosts     []string  `json:"hosts"`
+	Request   string    `json:"certificate_request"`
+	Profile   string    `json:"profile"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	CrossSign bool      `json:"cross_sign"`
 }
 
 // Handle responds to requests for the CA to sign the certificate
-// present in the "cert" parameter for the host named in the "hostname"
-// parameter. The certificate should be PEM-encoded.
+// present in the "certificate_request" parameter for the hosts named
+// in the "hosts" or "hostname" parameter. The certificate should be
+// PEM-encoded. Requests for a profile that requires authentication
+// are refused.
 func (h *SignHandler) Handle(w http.ResponseWriter, r *http.Request) error {
 	log.Info("signature request received")
-	blob, err := processRequestRequired(r, []string{"hostname", "certificate_request"})
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
+		log.Warningf("failed to read request body: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	r.Body.Close()
+
+	var jsonReq jsonSignRequest
+	if err = json.Unmarshal(body, &jsonReq); err != nil {
+		log.Warningf("failed to unmarshal request: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	if profileProvider(h.signer, jsonReq.Profile) != nil {
+		log.Warningf("unauthenticated request for profile %q", jsonReq.Profile)
+		return errors.NewUnauthorizedString("the signing profile requires authentication")
+	}
+	if err = authorizeClient(h.signer, jsonReq.Profile, r); err != nil {
 		return err
 	}
+	return signJSON(w, r, h.signer, &jsonReq)
+}
+
+// signJSON signs the signature request with the signer, and writes
+// the certificate as the response.
+func signJSON(w http.ResponseWriter, r *http.Request, s signer.Signer, jsonReq *jsonSignRequest) error {
+	if jsonReq.Request == "" {
+		return missingParamsError([]string{"certificate_request"})
+	}
 
-	certificate := []byte(blob["certificate_request"])
-	cert, err := h.signer.Sign(blob["hostname"], certificate, blob["profile"])
+	req := signer.SignRequest{
+		Hosts:     jsonReq.Hosts,
+		Request:   jsonReq.Request,
+		Profile:   jsonReq.Profile,
+		NotBefore: jsonReq.NotBefore,
+		NotAfter:  jsonReq.NotAfter,
+		CrossSign: jsonReq.CrossSign,
+		Requester: requester(r),
+	}
+	if len(req.Hosts) == 0 {
+		req.Hosts = signer.SplitHosts(jsonReq.Hostname)
+	}
+	cert, err := s.Sign(req)
 	if err != nil {
 		log.Warningf("failed to sign request: %v", err)
 		return errors.NewBadRequest(err)
@@ -49,3 +112,82 @@ func (h *SignHandler) Handle(w http.ResponseWriter, r *http.Request) error {
 	log.Info("wrote response")
 	return sendResponse(w, result)
 }
+
+// profileProvider returns the authentication provider of the named
+// signing profile of the signer, or nil if the profile does not
+// require authentication.
+func profileProvider(s signer.Signer, profileName string) auth.Provider {
+	profile := s.Policy().Profile(profileName)
+	if profile == nil {
+		return nil
+	}
+	return profile.Provider
+}
+
+// authorizeClient refuses requests from API clients whose TLS client
+// certificate does not allow them to use the named signing profile of
+// the signer.
+func authorizeClient(s signer.Signer, profileName string, r *http.Request) error {
+	profile := s.Policy().Profile(profileName)
+	if profile != nil && !profile.AllowsClient(clientCertificate(r)) {
+		log.Warningf("client %s is not allowed to use profile %q", requester(r), profileName)
+		return errors.NewForbiddenString("the client is not allowed to use the signing profile")
+	}
+	return nil
+}
+
+// An AuthSignHandler accepts signature requests authenticated with
+// the auth key of the signing profile they name, and returns a new
+// signed certificate.
+type AuthSignHandler struct {
+	signer signer.Signer
+}
+
+// NewAuthSignHandlerFromSigner generates a new AuthSignHandler that
+// signs certificates with an existing signer, local or remote.
+func NewAuthSignHandlerFromSigner(s signer.Signer) http.Handler {
+	return HttpHandler{&AuthSignHandler{signer: s}, "POST"}
+}
+
+// Handle responds to authenticated signature requests. The body of
+// the request is an auth.AuthenticatedRequest whose "request" is the
+// body of a request to the sign endpoint; it must be authenticated
+// with the auth key of the signing profile it names.
+func (h *AuthSignHandler) Handle(w http.ResponseWriter, r *http.Request) error {
+	log.Info("authenticated signature request received")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Warningf("failed to read request body: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	r.Body.Close()
+
+	var aReq auth.AuthenticatedRequest
+	if err = json.Unmarshal(body, &aReq); err != nil {
+		log.Warningf("failed to unmarshal authenticated request: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	if len(aReq.Request) == 0 {
+		return missingParamsError([]string{"request"})
+	}
+
+	var jsonReq jsonSignRequest
+	if err = json.Unmarshal(aReq.Request, &jsonReq); err != nil {
+		log.Warningf("failed to unmarshal request: %v", err)
+		return errors.NewBadRequest(err)
+	}
+
+	provider := profileProvider(h.signer, jsonReq.Profile)
+	if provider == nil {
+		log.Warningf("no auth key for profile %q", jsonReq.Profile)
+		return errors.NewBadRequestString("the signing profile does not use authentication")
+	}
+	if !provider.Verify(&aReq) {
+		log.Warningf("authentication failed for profile %q", jsonReq.Profile)
+		return errors.NewUnauthorizedString("invalid authentication token")
+	}
+	if err = authorizeClient(h.signer, jsonReq.Profile, r); err != nil {
+		return err
+	}
+	return signJSON(w, r, h.signer, &jsonReq)
+}
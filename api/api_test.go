@@ -2,13 +2,31 @@ package api
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/file"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/crl"
 	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/ocsp"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+	"github.com/cloudflare/cfssl/signer/remote"
 )
 
 const (
@@ -16,6 +34,8 @@ const (
 	testCaKeyFile     = "testdata/ca_key.pem"
 	testCSRFile       = "testdata/csr.pem"
 	testBrokenCSRFile = "testdata/broken_csr.pem"
+	testCRLCaFile     = "testdata/crl_ca.pem"
+	testCRLCaKeyFile  = "testdata/crl_ca_key.pem"
 )
 
 func newTestSignHandler(t *testing.T) (h http.Handler) {
@@ -37,6 +57,35 @@ func TestNewSignHandlerError(t *testing.T) {
 	}
 }
 
+// postJSON posts the JSON encoding of body to the API endpoint at url,
+// and returns the status and the "result" of the response.
+func postJSON(t *testing.T, url string, body interface{}) (int, json.RawMessage) {
+	blob, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Logf("%s: %s", resp.Status, respBody)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err = json.Unmarshal(respBody, &response); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, response.Result
+}
+
 func newSignServer(t *testing.T) *httptest.Server {
 	ts := httptest.NewServer(newTestSignHandler(t))
 	return ts
@@ -127,6 +176,456 @@ func TestSign(t *testing.T) {
 
 }
 
+func TestSignHosts(t *testing.T) {
+	ts := newSignServer(t)
+	defer ts.Close()
+
+	csrPEM, err := ioutil.ReadFile(testCSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := json.Marshal(map[string]interface{}{
+		"hosts":               []string{testDomainName, "10.0.0.5"},
+		"certificate_request": string(csrPEM),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status, string(body))
+	}
+
+	var response struct {
+		Result map[string]string `json:"result"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM([]byte(response.Result["certificate"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != testDomainName {
+		t.Fatalf("Unexpected DNS names %v", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 1 || cert.IPAddresses[0].String() != "10.0.0.5" {
+		t.Fatalf("Unexpected IP addresses %v", cert.IPAddresses)
+	}
+}
+
+func TestSignValidity(t *testing.T) {
+	ts := newSignServer(t)
+	defer ts.Close()
+
+	csrPEM, err := ioutil.ReadFile(testCSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	for _, test := range []struct {
+		notAfter time.Time
+		status   int
+	}{
+		{notAfter, http.StatusOK},
+		{time.Now().Add(2 * helpers.OneYear), http.StatusBadRequest},
+	} {
+		status, result := postJSON(t, ts.URL, map[string]interface{}{
+			"hosts":               []string{testDomainName},
+			"certificate_request": string(csrPEM),
+			"not_after":           test.notAfter,
+		})
+		if status != test.status {
+			t.Fatalf("Expected status %d for expiry %v, got %d", test.status, test.notAfter, status)
+		}
+		if status != http.StatusOK {
+			continue
+		}
+
+		var response map[string]string
+		if err = json.Unmarshal(result, &response); err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM([]byte(response["certificate"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cert.NotAfter.Equal(notAfter) {
+			t.Fatalf("Expected the certificate to expire at %v, not %v", notAfter, cert.NotAfter)
+		}
+	}
+}
+
+// newAuthSignServer starts a server with the sign and authsign
+// endpoints of a signer whose "auth" profile requires the given key.
+func newAuthSignServer(t *testing.T, key string) *httptest.Server {
+	provider, err := auth.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{
+			"auth": {
+				Usage:    []string{"signing", "server auth"},
+				Expiry:   time.Hour,
+				Provider: provider,
+			},
+		},
+		Default: config.DefaultConfig(),
+	}
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/cfssl/sign", NewSignHandlerFromSigner(s))
+	mux.Handle("/api/v1/cfssl/authsign", NewAuthSignHandlerFromSigner(s))
+	return httptest.NewServer(mux)
+}
+
+func TestAuthSign(t *testing.T) {
+	const key = "000102030405060708090a0b0c0d0e0f"
+	ts := newAuthSignServer(t, key)
+	defer ts.Close()
+
+	csrPEM, err := ioutil.ReadFile(testCSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	for _, test := range []struct {
+		key     string
+		profile string
+		valid   bool
+	}{
+		// The key of the profile authenticates the request.
+		{key, "auth", true},
+		// Without a key, the request goes to the sign endpoint,
+		// which refuses the profile.
+		{"", "auth", false},
+		{"0f0e0d0c0b0a09080706050403020100", "auth", false},
+		// Profiles without an auth key cannot be used on the
+		// authsign endpoint.
+		{key, "", false},
+	} {
+		clientPolicy := &config.Signing{
+			Profiles: map[string]*config.SigningProfile{},
+			Default:  config.DefaultConfig(),
+		}
+		if test.key != "" {
+			provider, err := auth.New(test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientPolicy.Default.Provider = provider
+		}
+		s, err := remote.NewSigner(clientPolicy, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.Sign(signer.SignRequest{
+			Hosts:   []string{testDomainName},
+			Request: string(csrPEM),
+			Profile: test.profile,
+		})
+		if test.valid && err != nil {
+			t.Fatalf("Failed to sign with key %q for profile %q: %v", test.key, test.profile, err)
+		} else if !test.valid && err == nil {
+			t.Fatalf("Expected error signing with key %q for profile %q", test.key, test.profile)
+		}
+	}
+}
+
+func TestSignAllowedClients(t *testing.T) {
+	policy := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{
+			"restricted": {
+				Usage:          []string{"signing", "server auth"},
+				Expiry:         time.Hour,
+				AllowedClients: []string{"issuer-1"},
+			},
+		},
+		Default: config.DefaultConfig(),
+	}
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewSignHandlerFromSigner(s)
+
+	csrPEM, err := ioutil.ReadFile(testCSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := json.Marshal(map[string]interface{}{
+		"hosts":               []string{testDomainName},
+		"certificate_request": string(csrPEM),
+		"profile":             "restricted",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		client string
+		status int
+	}{
+		{"issuer-1", http.StatusOK},
+		{"issuer-2", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("POST", "/api/v1/cfssl/sign", bytes.NewReader(blob))
+		if test.client != "" {
+			clientCert := &x509.Certificate{Subject: pkix.Name{CommonName: test.client}}
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{clientCert}}}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Fatalf("Expected status %d for client %q, got %d: %s", test.status, test.client, w.Code, w.Body)
+		}
+	}
+}
+
+func TestIntermediateCA(t *testing.T) {
+	policy := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{
+			"intermediate": {
+				Usage:  []string{"cert sign", "crl sign"},
+				Expiry: time.Hour,
+				CA:     true,
+			},
+		},
+		Default: config.DefaultConfig(),
+	}
+	// The test CA has a path length of zero, unlike the CRL test CA.
+	s, err := local.NewSignerFromFile(testCRLCaFile, testCRLCaKeyFile, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewIntermediateCAHandlerFromSigner(s))
+	defer ts.Close()
+
+	for _, test := range []struct {
+		profile string
+		status  int
+	}{
+		{"intermediate", http.StatusOK},
+		{"", http.StatusBadRequest},
+	} {
+		status, result := postJSON(t, ts.URL, map[string]interface{}{
+			"request": &csr.CertificateRequest{
+				CN:         "Test Intermediate CA",
+				KeyRequest: &csr.KeyRequest{Algo: "ecdsa", Size: 256},
+				CA:         &csr.CAConfig{PathLenZero: true},
+			},
+			"profile": test.profile,
+		})
+		if status != test.status {
+			t.Fatalf("Expected status %d for profile %q, got %d", test.status, test.profile, status)
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		var response NewIntermediateCA
+		if err = json.Unmarshal(result, &response); err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM([]byte(response.Cert))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cert.IsCA || !cert.MaxPathLenZero {
+			t.Fatal("Intermediate signed without the requested constraints.")
+		}
+		chain, err := helpers.ParseCertificatesPEM([]byte(response.Chain))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chain) != 2 || !chain[0].Equal(cert) {
+			t.Fatal("Unexpected chain of the intermediate.")
+		}
+		if err = cert.CheckSignatureFrom(chain[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if status, _ := postJSON(t, ts.URL, map[string]string{"profile": "intermediate"}); status != http.StatusBadRequest {
+		t.Fatalf("Expected status %d without a request, got %d", http.StatusBadRequest, status)
+	}
+}
+
+func TestCrossSign(t *testing.T) {
+	policy := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{
+			"ca": {Usage: []string{"cert sign", "crl sign"}, Expiry: time.Hour, CA: true},
+		},
+		Default: config.DefaultConfig(),
+	}
+	s, err := local.NewSignerFromFile(testCRLCaFile, testCRLCaKeyFile, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewSignHandlerFromSigner(s))
+	defer ts.Close()
+
+	caPEM, err := ioutil.ReadFile(testCaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		profile string
+		status  int
+	}{
+		{"ca", http.StatusOK},
+		{"", http.StatusBadRequest},
+	} {
+		status, result := postJSON(t, ts.URL, map[string]interface{}{
+			"certificate_request": string(caPEM),
+			"profile":             test.profile,
+			"cross_sign":          true,
+		})
+		if status != test.status {
+			t.Fatalf("Expected status %d for profile %q, got %d", test.status, test.profile, status)
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		var response map[string]string
+		if err = json.Unmarshal(result, &response); err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM([]byte(response["certificate"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(cert.RawSubject, existing.RawSubject) || !bytes.Equal(cert.SubjectKeyId, existing.SubjectKeyId) {
+			t.Fatal("Cross-signed certificate does not keep the subject and key identifier.")
+		}
+		ca, _ := s.Certificate()
+		if err = cert.CheckSignatureFrom(ca); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRemoteCertGenerator(t *testing.T) {
+	signServer := newSignServer(t)
+	defer signServer.Close()
+
+	h, err := NewRemoteCertGenerator(CSRValidate, strings.TrimPrefix(signServer.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	// Without a hostname, the certificate is issued for the hosts of
+	// the certificate request.
+	blob, err := json.Marshal(map[string]interface{}{
+		"request": map[string]interface{}{
+			"hosts": []string{testDomainName, "127.0.0.1"},
+			"key":   map[string]interface{}{"algo": "ecdsa", "size": 256},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status, string(body))
+	}
+
+	var response struct {
+		Result map[string]string `json:"result"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM([]byte(response.Result["certificate"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cert.VerifyHostname(testDomainName); err != nil {
+		t.Fatal(err)
+	}
+	if err = cert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = helpers.ParsePrivateKeyPEM([]byte(response.Result["private_key"])); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGeneratorKeyFormat(t *testing.T) {
+	h, err := NewGeneratorHandler(CSRValidate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	for _, test := range []struct {
+		key    map[string]interface{}
+		status int
+	}{
+		{map[string]interface{}{"algo": "ecdsa", "size": 256, "format": "encrypted-pkcs8", "password": "password"}, http.StatusOK},
+		{map[string]interface{}{"algo": "ecdsa", "size": 256, "format": "encrypted-pkcs8"}, http.StatusBadRequest},
+	} {
+		status, result := postJSON(t, ts.URL, map[string]interface{}{
+			"hosts": []string{testDomainName},
+			"key":   test.key,
+		})
+		if status != test.status {
+			t.Fatalf("Expected status %d for key %v, got %d", test.status, test.key, status)
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		var response CertRequest
+		if err = json.Unmarshal(result, &response); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(response.Key, "ENCRYPTED PRIVATE KEY") {
+			t.Fatal("Private key not encrypted.")
+		}
+		if _, err = helpers.ParsePrivateKeyPEMWithPassword([]byte(response.Key), []byte("password")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewRemoteCertGeneratorError(t *testing.T) {
+	if _, err := NewRemoteCertGenerator(CSRValidate, "127.0.0.1:port"); err == nil {
+		t.Fatal("Expect error when create a remote certificate generator with an invalid address.")
+	}
+}
+
 const (
 	testCaBundleFile     = "testdata/ca-bundle.pem"
 	testIntBundleFile    = "testdata/int-bundle.pem"
@@ -365,3 +864,475 @@ func TestGeneratorRESTfulVerbs(t *testing.T) {
 		t.Fatal(resp.Status)
 	}
 }
+
+func newTestOCSPSignHandler(t *testing.T) (h http.Handler) {
+	h, err := NewOCSPSignHandler(testCaFile, "", testCaKeyFile, 96*time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestNewOCSPSignHandlerError(t *testing.T) {
+	_, err := NewOCSPSignHandler(testCaFile, "", testBrokenCSRFile, 96*time.Hour, nil)
+	if err == nil {
+		t.Fatal("Expect error when create an OCSP signer with broken file.")
+	}
+}
+
+// testCertificate signs the test CSR with the test CA, producing a
+// certificate the test CA may answer OCSP requests for.
+func testCertificate(t *testing.T) []byte {
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM, err := ioutil.ReadFile(testCSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := s.Sign(signer.SignRequest{Hosts: []string{testHostName}, Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPEM
+}
+
+type ocspSignTest struct {
+	Certificate    string
+	Status         string
+	Reason         string
+	ExpectedStatus int
+}
+
+func TestOCSPSign(t *testing.T) {
+	ts := httptest.NewServer(newTestOCSPSignHandler(t))
+	defer ts.Close()
+	certPEM := string(testCertificate(t))
+
+	var ocspSignTests = []ocspSignTest{
+		{certPEM, "", "", http.StatusOK},
+		{certPEM, "good", "", http.StatusOK},
+		{certPEM, "revoked", "keycompromise", http.StatusOK},
+		{certPEM, "revoked", "7", http.StatusBadRequest},
+		{certPEM, "unknown", "", http.StatusOK},
+		{certPEM, "bogus", "", http.StatusBadRequest},
+		{"", "good", "", http.StatusBadRequest},
+	}
+
+	for _, test := range ocspSignTests {
+		obj := map[string]string{
+			"status": test.Status,
+			"reason": test.Reason,
+		}
+		if test.Certificate != "" {
+			obj["certificate"] = test.Certificate
+		}
+		if status, _ := postJSON(t, ts.URL, obj); status != test.ExpectedStatus {
+			t.Fatalf("Expected status %d for status %q, got %d", test.ExpectedStatus, test.Status, status)
+		}
+	}
+}
+
+// newTestDB opens an empty certificate database, which is removed by
+// the returned cleanup function.
+func newTestDB(t *testing.T) (*file.Accessor, func()) {
+	dir, err := ioutil.TempDir("", "cfssl-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := file.NewAccessor(filepath.Join(dir, "certs.json"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() { os.RemoveAll(dir) }
+}
+
+func TestOCSPSignFromDB(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	h, err := NewOCSPSignHandler(testCaFile, "", testCaKeyFile, 96*time.Hour, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	certPEM := testCertificate(t)
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := map[string]string{"certificate": string(certPEM)}
+	if status, _ := postJSON(t, ts.URL, obj); status != http.StatusBadRequest {
+		t.Fatalf("Expected status %d for an unknown certificate, got %d", http.StatusBadRequest, status)
+	}
+
+	cr := certdb.NewCertificateRecord(cert, "", "")
+	if err = db.InsertCertificate(cr); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.RevokeCertificate(cr.Serial, cr.AKI, 1); err != nil {
+		t.Fatal(err)
+	}
+	status, result := postJSON(t, ts.URL, obj)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+	}
+	var response map[string][]byte
+	if err = json.Unmarshal(result, &response); err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := ioutil.ReadFile(testCaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ocsp.ParseResponse(response["ocsp_response"], issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != ocsp.Revoked || resp.RevocationReason != 1 {
+		t.Fatalf("Expected the recorded revocation, got status %d and reason %d", resp.Status, resp.RevocationReason)
+	}
+
+	// The status may not be given along with the database.
+	obj["status"] = "good"
+	if status, _ := postJSON(t, ts.URL, obj); status != http.StatusBadRequest {
+		t.Fatalf("Expected status %d for a given status, got %d", http.StatusBadRequest, status)
+	}
+}
+
+func TestNewAdminHandlerError(t *testing.T) {
+	if _, err := NewAdminHandler(newTestOCSPSignHandler(t), nil); err == nil {
+		t.Fatal("Expect error when guarding an endpoint without an admin policy.")
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	const key = "000102030405060708090a0b0c0d0e0f"
+	provider, err := auth.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherProvider, err := auth.New("0f0e0d0c0b0a09080706050403020100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &config.AdminPolicy{
+		AuthKeyName:    "admin",
+		AllowedClients: []string{"ops"},
+		Provider:       provider,
+	}
+	h, err := NewAdminHandler(newTestOCSPSignHandler(t), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := json.Marshal(map[string]string{"certificate": string(testCertificate(t))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticate := func(p auth.Provider) []byte {
+		aReq := auth.AuthenticatedRequest{Timestamp: time.Now().Unix(), Request: blob}
+		if aReq.Token, err = p.Token(aReq.Timestamp, aReq.Request); err != nil {
+			t.Fatal(err)
+		}
+		body, err := json.Marshal(aReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	for _, test := range []struct {
+		client string
+		body   []byte
+		status int
+	}{
+		{"ops", authenticate(provider), http.StatusOK},
+		// The request must come from an allowed client.
+		{"", authenticate(provider), http.StatusForbidden},
+		{"dev", authenticate(provider), http.StatusForbidden},
+		// The request must be authenticated with the admin key.
+		{"ops", authenticate(otherProvider), http.StatusUnauthorized},
+		{"ops", blob, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", "/api/v1/cfssl/ocspsign", bytes.NewReader(test.body))
+		if test.client != "" {
+			clientCert := &x509.Certificate{Subject: pkix.Name{CommonName: test.client}}
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{clientCert}}}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Fatalf("Expected status %d for client %q, got %d: %s", test.status, test.client, w.Code, w.Body)
+		}
+	}
+}
+
+func newTestCRLHandler(t *testing.T) (h http.Handler) {
+	h, err := NewCRLHandler(testCRLCaFile, testCRLCaKeyFile, 24*time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestNewCRLHandlerError(t *testing.T) {
+	// The RSA test CA is not allowed to sign CRLs.
+	if _, err := NewCRLHandler(testCaFile, testCaKeyFile, 24*time.Hour, nil); err == nil {
+		t.Fatal("Expect error when create a CRL signer with a CA that cannot sign CRLs.")
+	}
+	if _, err := NewCRLHandler(testCRLCaFile, testBrokenCSRFile, 24*time.Hour, nil); err == nil {
+		t.Fatal("Expect error when create a CRL signer with broken file.")
+	}
+}
+
+type crlTest struct {
+	Body           string
+	ExpectedStatus int
+	ExpectedCount  int
+}
+
+var crlTests = []crlTest{
+	{`{"revoked": []}`, http.StatusOK, 0},
+	{`{"revoked": [{"serial": "1234567890", "reason": "keycompromise"}, {"serial": "0x10", "revoked_at": "2014-06-01"}]}`, http.StatusOK, 2},
+	{`{"revoked": [{"serial": "bogus"}]}`, http.StatusBadRequest, 0},
+	{`{"revoked": [{"serial": "1", "reason": "7"}]}`, http.StatusBadRequest, 0},
+	{`not json`, http.StatusBadRequest, 0},
+}
+
+func TestCRL(t *testing.T) {
+	ts := httptest.NewServer(newTestCRLHandler(t))
+	defer ts.Close()
+
+	for _, test := range crlTests {
+		resp, err := http.Post(ts.URL, "application/json", bytes.NewReader([]byte(test.Body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.ExpectedStatus {
+			t.Fatal(resp.Status, test.ExpectedStatus, string(body))
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		var response struct {
+			Result map[string]string `json:"result"`
+		}
+		if err = json.Unmarshal(body, &response); err != nil {
+			t.Fatal(err)
+		}
+		crl, err := x509.ParseCRL([]byte(response.Result["crl"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(crl.TBSCertList.RevokedCertificates) != test.ExpectedCount {
+			t.Fatalf("Expected %d revoked certificates, got %d", test.ExpectedCount, len(crl.TBSCertList.RevokedCertificates))
+		}
+	}
+}
+
+func TestCRLFromDB(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	h, err := NewCRLHandler(testCRLCaFile, testCRLCaKeyFile, 24*time.Hour, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	caPEM, err := ioutil.ReadFile(testCRLCaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := certdb.CertificateRecord{
+		Serial: "1234567890",
+		AKI:    hex.EncodeToString(ca.SubjectKeyId),
+		Status: certdb.StatusGood,
+		Expiry: time.Now().Add(time.Hour),
+	}
+	if err = db.InsertCertificate(cr); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.RevokeCertificate(cr.Serial, cr.AKI, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Revoked certificates may not be listed along with the database.
+	if status, _ := postJSON(t, ts.URL, map[string]interface{}{"revoked": []crl.RevokedCertificate{{Serial: "17"}}}); status != http.StatusBadRequest {
+		t.Fatalf("Expected status %d for a given list, got %d", http.StatusBadRequest, status)
+	}
+
+	status, result := postJSON(t, ts.URL, map[string]string{})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+	}
+	var response map[string]string
+	if err = json.Unmarshal(result, &response); err != nil {
+		t.Fatal(err)
+	}
+	list, err := x509.ParseCRL([]byte(response["crl"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked := list.TBSCertList.RevokedCertificates
+	if len(revoked) != 1 || revoked[0].SerialNumber.String() != cr.Serial {
+		t.Fatalf("Expected the recorded revocation, got %+v", revoked)
+	}
+}
+
+// An admin policy without an auth key passes the requests of allowed
+// clients on as they are.
+func TestAdminCRL(t *testing.T) {
+	policy := &config.AdminPolicy{AllowedClients: []string{"ops"}}
+	h, err := NewAdminHandler(newTestCRLHandler(t), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		client string
+		status int
+	}{
+		{"ops", http.StatusOK},
+		{"dev", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("POST", "/api/v1/cfssl/crl", strings.NewReader(`{"revoked": []}`))
+		if test.client != "" {
+			clientCert := &x509.Certificate{Subject: pkix.Name{CommonName: test.client}}
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{clientCert}}}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Fatalf("Expected status %d for client %q, got %d: %s", test.status, test.client, w.Code, w.Body)
+		}
+	}
+}
+
+func TestNewRevokeHandlerError(t *testing.T) {
+	if _, err := NewRevokeHandler(nil); err == nil {
+		t.Fatal("Expect error when create a revocation handler without a database.")
+	}
+}
+
+type revokeTest struct {
+	Serial         string
+	AKI            string
+	Reason         string
+	ExpectedStatus int
+}
+
+var revokeTests = []revokeTest{
+	{"", "", "", http.StatusBadRequest},
+	{"1234567890", "", "bogus", http.StatusBadRequest},
+	{"1234567891", "", "", http.StatusBadRequest},
+	{"1234567890", "b7:d2:f7:84", "keycompromise", http.StatusOK},
+	{"1234567890", "b7d2f784", "superseded", http.StatusBadRequest},
+}
+
+func TestRevoke(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	err := db.InsertCertificate(certdb.CertificateRecord{
+		Serial: "1234567890",
+		AKI:    "b7d2f784",
+		Status: certdb.StatusGood,
+		Expiry: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewRevokeHandler(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	for _, test := range revokeTests {
+		obj := map[string]string{
+			"authority_key_id": test.AKI,
+			"reason":           test.Reason,
+		}
+		if test.Serial != "" {
+			obj["serial"] = test.Serial
+		}
+		if status, _ := postJSON(t, ts.URL, obj); status != test.ExpectedStatus {
+			t.Fatalf("Expected status %d for serial %q, got %d", test.ExpectedStatus, test.Serial, status)
+		}
+	}
+
+	records, err := db.GetCertificate("1234567890", "b7d2f784")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].Status != certdb.StatusRevoked || records[0].Reason != 1 {
+		t.Fatalf("Certificate not revoked: %+v", records[0])
+	}
+}
+
+// Unauthenticated requests to revoke a certificate leave it alone.
+func TestAdminRevoke(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	err := db.InsertCertificate(certdb.CertificateRecord{
+		Serial: "1234567890",
+		AKI:    "b7d2f784",
+		Status: certdb.StatusGood,
+		Expiry: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := auth.New("000102030405060708090a0b0c0d0e0f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewRevokeHandler(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err = NewAdminHandler(h, &config.AdminPolicy{AuthKeyName: "admin", Provider: provider})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader(`{"serial": "1234567890"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal(resp.Status)
+	}
+
+	records, err := db.GetCertificate("1234567890", "b7d2f784")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].Status != certdb.StatusGood {
+		t.Fatalf("Certificate revoked without authentication: %+v", records[0])
+	}
+}
@@ -2,87 +2,310 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/auth"
+	cferr "github.com/cloudflare/cfssl/errors"
 )
 
-// A Server points to a remote CFSSL instance.
+// DefaultTimeout is the default time limit of a request to a remote
+// server, including reading the response.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultRetries is the default number of times an idempotent request
+// is tried again once all the remotes have failed.
+const DefaultRetries = 2
+
+// retryDelay is the time waited before trying the remote servers
+// again, once all of them have failed.
+var retryDelay = time.Second
+
+// A Server points to one or more remote CFSSL instances, given by the
+// base URLs of their APIs, such as "https://ca.example.com:8888".
+// Requests go to the current remote; if it cannot be reached, the
+// Server fails over to the next one, which becomes the current remote.
+//
+// Requests that are not idempotent, such as signature requests, only
+// fail over when the connection to a remote could not be made, so that
+// a request is never sent twice. Idempotent requests fail over on any
+// connection error or timeout, and on responses showing the remote
+// failed, such as 5xx errors or the error pages of a proxy; they are
+// tried again up to Retries times once all the remotes have failed.
+// Each attempt is limited to Timeout.
 type Server struct {
-	Address string
-	Port    int
+	URLs      []string
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+	Retries   int
+
+	lock      sync.Mutex
+	current   int
+	transport *http.Transport
+}
+
+// NewServer returns the Server for the comma-separated list of
+// addresses, each of the form host:port or host, with the port
+// defaulting to 8888. An address starting with "https://" is reached
+// over HTTPS, verified against the system's root certificates. It
+// returns nil if an address is invalid.
+func NewServer(addrs string) *Server {
+	return newServer(addrs, nil)
+}
+
+// NewServerTLS returns the Server for the comma-separated list of
+// addresses, all reached over HTTPS with the TLS config. The config
+// holds the root certificates the servers are verified against, if
+// not the system's, and the client certificate presented to servers
+// requiring one. It returns nil if an address is invalid.
+func NewServerTLS(addrs string, tlsConfig *tls.Config) *Server {
+	return newServer(addrs, tlsConfig)
+}
+
+func newServer(addrs string, tlsConfig *tls.Config) *Server {
+	var urls []string
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		u := normalizeURL(addr, tlsConfig != nil)
+		if u == "" {
+			return nil
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	return &Server{
+		URLs:      urls,
+		TLSConfig: tlsConfig,
+		Timeout:   DefaultTimeout,
+		Retries:   DefaultRetries,
+		transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
 }
 
-func NewServer(addr string) *Server {
+// normalizeURL returns the base URL of the server at addr, or "" if
+// the address is invalid.
+func normalizeURL(addr string, useTLS bool) string {
+	scheme := "http"
+	if useTLS || strings.HasPrefix(addr, "https://") {
+		scheme = "https"
+	}
+	addr = strings.TrimPrefix(strings.TrimPrefix(addr, "https://"), "http://")
+
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		host, port, err = net.SplitHostPort(addr + ":8888")
 		if err != nil {
-			return nil
+			return ""
 		}
 	}
-
-	var portno int
 	if port == "" {
-		portno = 8888
-	} else {
-		portno, err = strconv.Atoi(port)
-		if err != nil {
-			return nil
-		}
+		port = "8888"
+	} else if _, err = strconv.Atoi(port); err != nil {
+		return ""
 	}
 
-	return &Server{host, portno}
+	return scheme + "://" + net.JoinHostPort(host, port)
 }
 
-func (srv *Server) getURL(endpoint string) string {
-	return fmt.Sprintf("http://%s:%d/api/v1/cfssl/%s", srv.Address, srv.Port, endpoint)
+// Sign sends a signature request to the remote CFSSL server,
+// receiving a signed certificate or an error in response. The
+// request is the JSON body of a signature request, as documented in
+// the API documentation.
+func (srv *Server) Sign(jsonData []byte) ([]byte, error) {
+	return srv.sign("sign", jsonData)
 }
 
-// Sign sends a signature request to the remote CFSSL server,
-// receiving a signed certificate or an error in response.
-func (srv *Server) Sign(hostname string, csr []byte, profileName string) ([]byte, error) {
-	url := srv.getURL("sign")
-	var request = map[string]string{
-		"certificate_request": string(csr),
-		"hostname":            hostname,
-		"profile":             profileName,
+// AuthSign sends a signature request authenticated by the provider to
+// the remote CFSSL server, receiving a signed certificate or an error
+// in response. The request is the JSON body of a signature request,
+// which the provider must hold the auth key of the requested signing
+// profile to authenticate.
+func (srv *Server) AuthSign(jsonData []byte, provider auth.Provider) ([]byte, error) {
+	aReq, err := auth.NewRequest(provider, jsonData)
+	if err != nil {
+		return nil, err
 	}
 
-	jsonData, err := json.Marshal(request)
+	jsonData, err = json.Marshal(aReq)
 	if err != nil {
 		return nil, err
 	}
+	return srv.sign("authsign", jsonData)
+}
+
+// Bundle sends a bundle request to the remote CFSSL server, receiving
+// the bundle or an error in response. The request is the JSON body of
+// a bundle request, as documented in the API documentation. As bundle
+// requests are idempotent, they are retried.
+func (srv *Server) Bundle(jsonData []byte) (map[string]interface{}, error) {
+	return srv.post("bundle", jsonData, true)
+}
 
-	buf := bytes.NewBuffer(jsonData)
-	resp, err := http.Post(url, "application/json", buf)
+// sign posts a signature request to the endpoint and returns the
+// certificate in the response.
+func (srv *Server) sign(endpoint string, jsonData []byte) ([]byte, error) {
+	result, err := srv.post(endpoint, jsonData, false)
 	if err != nil {
 		return nil, err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
+
+	cert, ok := result["certificate"].(string)
+	if !ok {
+		return nil, &Error{Message: "the response has no certificate"}
+	}
+	return []byte(cert), nil
+}
+
+// post sends a request to the endpoint of the current remote, failing
+// over to the other remotes and retrying as the request allows, and
+// returns the result in the response.
+func (srv *Server) post(endpoint string, jsonData []byte, idempotent bool) (map[string]interface{}, error) {
+	attempts := 1
+	if idempotent {
+		attempts += srv.Retries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryDelay)
+		}
+
+		for range srv.URLs {
+			i := srv.currentRemote()
+			var result map[string]interface{}
+			result, err = srv.postTo(srv.URLs[i], endpoint, jsonData)
+			if err == nil {
+				return result, nil
+			}
+			if apiErr, ok := err.(*Error); ok {
+				// The remote answered; its answer is final,
+				// unless it failed to handle an idempotent
+				// request.
+				if !idempotent || !apiErr.remoteFailure() {
+					return nil, err
+				}
+			} else if !idempotent && !isDialError(err) {
+				return nil, cferr.New(cferr.DialError, cferr.Unknown, err)
+			}
+			srv.failover(i)
+		}
+	}
+	if _, ok := err.(*Error); ok {
+		return nil, err
+	}
+	return nil, cferr.New(cferr.DialError, cferr.Unknown, err)
+}
+
+// postTo sends a request to the endpoint of the remote at the base
+// URL. It returns an *Error if the remote answered with an error.
+func (srv *Server) postTo(baseURL, endpoint string, jsonData []byte) (map[string]interface{}, error) {
+	remoteURL := baseURL + "/api/v1/cfssl/" + endpoint
+	client := &http.Client{Transport: srv.transport, Timeout: srv.Timeout}
+	resp, err := client.Post(remoteURL, "application/json", bytes.NewReader(jsonData))
 	if err != nil {
 		return nil, err
 	}
+	body, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
-
-	var response Response
-	err = json.Unmarshal(body, &response)
 	if err != nil {
 		return nil, err
 	}
 
-	if !response.Success || response.Result == nil {
+	var response Response
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, &Error{Remote: baseURL, StatusCode: resp.StatusCode, Message: "invalid response: " + err.Error(), invalid: true}
+	}
+	if !response.Success {
 		if len(response.Errors) > 0 {
-			return nil, errors.New(response.Errors[0].Message)
+			return nil, &Error{
+				Remote:     baseURL,
+				StatusCode: resp.StatusCode,
+				Code:       response.Errors[0].Code,
+				Message:    response.Errors[0].Message,
+			}
 		}
-		return nil, errors.New("API response was not successful")
+		return nil, &Error{Remote: baseURL, StatusCode: resp.StatusCode, Message: "API response was not successful"}
 	}
-	result := response.Result.(map[string]interface{})
-	cert := result["certificate"].(string)
 
-	return []byte(cert), nil
+	result, ok := response.Result.(map[string]interface{})
+	if !ok {
+		return nil, &Error{Remote: baseURL, StatusCode: resp.StatusCode, Message: "unexpected result in response"}
+	}
+	return result, nil
+}
+
+// currentRemote returns the index of the current remote.
+func (srv *Server) currentRemote() int {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.current
+}
+
+// failover makes the remote after the ith the current remote, unless
+// another request has already failed over from the ith remote.
+func (srv *Server) failover(i int) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if srv.current == i {
+		srv.current = (i + 1) % len(srv.URLs)
+	}
+}
+
+// isDialError reports whether the request failed before it could be
+// sent, because no connection to the remote could be made.
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// An Error is an error response from a remote CFSSL server. Code and
+// Message are those of the error the server reported: for errors of
+// the CFSSL packages, the 4-digit errors.Error code, and otherwise
+// the HTTP status. Code is zero if the response was not a valid API
+// response.
+type Error struct {
+	Remote     string `json:"-"`
+	StatusCode int    `json:"-"`
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+
+	// invalid is set if the response was not JSON at all.
+	invalid bool
+}
+
+// remoteFailure reports whether the error shows that the remote failed
+// to handle the request, rather than refused it: a 5xx status, or a
+// response that is not an API response, such as a proxy's error page.
+func (e *Error) remoteFailure() bool {
+	return e.StatusCode >= 500 || e.invalid
+}
+
+// Error formats the error as a JSON object, like errors.Error.
+func (e *Error) Error() string {
+	marshaled, err := json.Marshal(e)
+	if err != nil {
+		return e.Message
+	}
+	return string(marshaled)
 }
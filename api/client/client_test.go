@@ -0,0 +1,216 @@
+package client
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testCertificate = "-----BEGIN CERTIFICATE-----\ntest\n-----END CERTIFICATE-----\n"
+
+func init() {
+	retryDelay = 0
+}
+
+// newTestServer starts a fake CFSSL server that answers every request
+// with a certificate, counting the requests it receives.
+func newTestServer(count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(count, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"result":  map[string]string{"certificate": testCertificate},
+		})
+	}))
+}
+
+// closedAddress returns an address nothing listens on.
+func closedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestNewServer(t *testing.T) {
+	srv := NewServer("ca1.example.com:8080, https://ca2.example.com,http://[::1]:9000")
+	if srv == nil {
+		t.Fatal("Failed to parse a list of addresses.")
+	}
+	expected := []string{"http://ca1.example.com:8080", "https://ca2.example.com:8888", "http://[::1]:9000"}
+	if !reflect.DeepEqual(srv.URLs, expected) {
+		t.Fatalf("Expected URLs %v, got %v", expected, srv.URLs)
+	}
+	if srv.Timeout != DefaultTimeout || srv.Retries != DefaultRetries {
+		t.Fatalf("Unexpected timeout %v and retries %d", srv.Timeout, srv.Retries)
+	}
+
+	for _, addr := range []string{"", ",", "ca.example.com:port", "ca1.example.com,ca2.example.com:port"} {
+		if NewServer(addr) != nil {
+			t.Fatalf("Expected an invalid address %q to be refused.", addr)
+		}
+	}
+}
+
+func TestFailover(t *testing.T) {
+	var count int32
+	ts := newTestServer(&count)
+	defer ts.Close()
+
+	srv := NewServer(closedAddress(t) + "," + strings.TrimPrefix(ts.URL, "http://"))
+	for i := 0; i < 2; i++ {
+		cert, err := srv.Sign([]byte("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(cert) != testCertificate {
+			t.Fatalf("Unexpected certificate %q", cert)
+		}
+	}
+	// The second request goes straight to the remote that answered.
+	if srv.currentRemote() != 1 || count != 2 {
+		t.Fatalf("Unexpected current remote %d after %d requests", srv.currentRemote(), count)
+	}
+
+	srv = NewServer(closedAddress(t))
+	if _, err := srv.Sign([]byte("{}")); err == nil {
+		t.Fatal("Expected error when no remote can be reached.")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer slow.Close()
+	defer close(hang)
+
+	var count int32
+	ts := newTestServer(&count)
+	defer ts.Close()
+
+	srv := NewServer(strings.TrimPrefix(slow.URL, "http://") + "," + strings.TrimPrefix(ts.URL, "http://"))
+	srv.Timeout = 100 * time.Millisecond
+
+	// A signature request may have reached the remote that timed
+	// out, so it is not sent again.
+	if _, err := srv.Sign([]byte("{}")); err == nil {
+		t.Fatal("Expected error when the remote times out.")
+	}
+	if count != 0 {
+		t.Fatal("Signature request sent to another remote after a timeout.")
+	}
+
+	// Idempotent requests fail over.
+	if _, err := srv.Bundle([]byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatal("Bundle request not sent to another remote after a timeout.")
+	}
+}
+
+// A remote answering with an error page fails over idempotent
+// requests only.
+func TestFailoverErrorPage(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("<html><body>502 Bad Gateway</body></html>"))
+	}))
+	defer broken.Close()
+
+	var count int32
+	ts := newTestServer(&count)
+	defer ts.Close()
+
+	addrs := strings.TrimPrefix(broken.URL, "http://") + "," + strings.TrimPrefix(ts.URL, "http://")
+	_, err := NewServer(addrs).Sign([]byte("{}"))
+	if apiErr, ok := err.(*Error); !ok || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Expected the error page of the first remote, got %v", err)
+	}
+	if count != 0 {
+		t.Fatal("Signature request sent to another remote after an error page.")
+	}
+
+	if _, err = NewServer(addrs).Bundle([]byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatal("Bundle request not sent to another remote after an error page.")
+	}
+
+	// Once all the retries have failed, the last error page is
+	// returned.
+	srv := NewServer(strings.TrimPrefix(broken.URL, "http://"))
+	if _, err = srv.Bundle([]byte("{}")); err == nil {
+		t.Fatal("Expected error when every remote fails.")
+	} else if _, ok := err.(*Error); !ok {
+		t.Fatalf("Expected an *Error, got %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request is dropped.
+		if atomic.AddInt32(&count, 1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"result":  map[string]string{"bundle": "test"},
+		})
+	}))
+	defer ts.Close()
+
+	srv := NewServer(strings.TrimPrefix(ts.URL, "http://"))
+	srv.Retries = 1
+	result, err := srv.Bundle([]byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["bundle"] != "test" || count != 2 {
+		t.Fatalf("Unexpected result %v after %d requests", result, count)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, test := range []struct {
+		response string
+		code     int
+	}{
+		{`{"success":false,"errors":[{"code":5300,"message":"no hosts given"}]}`, 5300},
+		{`{"success":true,"result":"unexpected"}`, 0},
+		{`{"success":true,"result":{"certificate":42}}`, 0},
+		{`not json`, 0},
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(test.response))
+		}))
+
+		_, err := NewServer(strings.TrimPrefix(ts.URL, "http://")).Sign([]byte("{}"))
+		ts.Close()
+		apiErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("Expected an *Error for response %s, got %v", test.response, err)
+		}
+		if apiErr.Code != test.code {
+			t.Fatalf("Expected code %d for response %s, got %d", test.code, test.response, apiErr.Code)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f"
+
+var testRequest = []byte(`{"hosts":["cloudflare.com"],"certificate_request":"csr"}`)
+
+func TestNewRequest(t *testing.T) {
+	p, err := New(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := NewRequest(p, testRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Verify(ar) {
+		t.Fatal("Failed to verify a valid request.")
+	}
+
+	// Any change to the request or its timestamp invalidates it.
+	tampered := *ar
+	tampered.Request = []byte(`{"hosts":["example.com"],"certificate_request":"csr"}`)
+	if p.Verify(&tampered) {
+		t.Fatal("Verified a tampered request.")
+	}
+	tampered = *ar
+	tampered.Timestamp++
+	if p.Verify(&tampered) {
+		t.Fatal("Verified a request with a tampered timestamp.")
+	}
+
+	other, err := New("0f0e0d0c0b0a09080706050403020100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Verify(ar) {
+		t.Fatal("Verified a request with the wrong key.")
+	}
+}
+
+func TestVerifyTimestamp(t *testing.T) {
+	p, err := New(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ts := range []time.Time{time.Now().Add(-2 * MaxSkew), time.Now().Add(2 * MaxSkew)} {
+		ar := &AuthenticatedRequest{Timestamp: ts.Unix(), Request: testRequest}
+		if ar.Token, err = p.Token(ar.Timestamp, ar.Request); err != nil {
+			t.Fatal(err)
+		}
+		if p.Verify(ar) {
+			t.Fatalf("Verified a request made at %v.", ts)
+		}
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	for _, key := range []string{"", "not hex", "00010203"} {
+		if _, err := New(key); err == nil {
+			t.Fatalf("Expected error creating a provider with key %q.", key)
+		}
+	}
+
+	os.Setenv("CFSSL_TEST_AUTH_KEY", testKey)
+	defer os.Unsetenv("CFSSL_TEST_AUTH_KEY")
+	p, err := New("env:CFSSL_TEST_AUTH_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := New(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ar, err := NewRequest(p, testRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Verify(ar) {
+		t.Fatal("Key read from the environment does not match.")
+	}
+}
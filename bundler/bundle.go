@@ -3,6 +3,7 @@ package bundler
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -104,6 +105,8 @@ func (b *Bundle) MarshalJSON() ([]byte, error) {
 		keyType = fmt.Sprintf("%d-bit ECDSA", keyLength)
 	case x509.RSA:
 		keyType = fmt.Sprintf("%d-bit RSA", keyLength)
+	case x509.Ed25519:
+		keyType = "Ed25519"
 	case x509.DSA:
 		keyType = "DSA"
 	default:
@@ -115,6 +118,9 @@ func (b *Bundle) MarshalJSON() ([]byte, error) {
 	} else if ecdsaKey, ok := b.Key.(*ecdsa.PrivateKey); ok {
 		keyBytes, _ = x509.MarshalECPrivateKey(ecdsaKey)
 		typeString = "EC PRIVATE KEY"
+	} else if edKey, ok := b.Key.(ed25519.PrivateKey); ok {
+		keyBytes, _ = x509.MarshalPKCS8PrivateKey(edKey)
+		typeString = "PRIVATE KEY"
 	}
 	var ocspSupport = false
 	if b.Cert.OCSPServer != nil {
@@ -4,6 +4,7 @@ package bundler
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	_ "crypto/sha256"
 	_ "crypto/sha512"
@@ -159,23 +160,40 @@ func (b *Bundler) BundleFromFile(bundleFile, keyFile string, flavor BundleFlavor
 		}
 	}
 
-	return b.BundleFromPEM(certsPEM, keyPEM, flavor)
+	// The key file may be encrypted, with the passphrase read from
+	// helpers.KeyPasswordSource.
+	var key interface{}
+	if len(keyPEM) != 0 {
+		key, err = helpers.ParsePrivateKeyPEM(keyPEM)
+		if err != nil {
+			log.Debugf("failed to parse private key: %v", err)
+			return nil, err
+		}
+	}
+	return b.bundleFromPEM(certsPEM, key, flavor)
 }
 
 // BundleFromPEM builds a certificate bundle from the set of byte
 // slices containing the PEM-encoded certificate(s), private key.
+// Encrypted private keys are refused, since their passphrase is not
+// known.
 func (b *Bundler) BundleFromPEM(certsPEM, keyPEM []byte, flavor BundleFlavor) (*Bundle, error) {
 	log.Debug("bundling from PEM files")
 	var key interface{}
 	var err error
 	if len(keyPEM) != 0 {
-		key, err = helpers.ParsePrivateKeyPEM(keyPEM)
+		key, err = helpers.ParsePrivateKeyPEMWithPassword(keyPEM, nil)
 		log.Debugf("failed to parse private key: %v", err)
 		if err != nil {
 			return nil, err
 		}
 	}
+	return b.bundleFromPEM(certsPEM, key, flavor)
+}
 
+// bundleFromPEM builds a certificate bundle from the PEM-encoded
+// certificate(s) and the parsed private key, if any.
+func (b *Bundler) bundleFromPEM(certsPEM []byte, key interface{}, flavor BundleFlavor) (*Bundle, error) {
 	certs, err := helpers.ParseCertificatesPEM(certsPEM)
 	if err != nil {
 		log.Debugf("failed to parse certificates: %v", err)
@@ -438,7 +456,8 @@ func (b *Bundler) fetchIntermediates(certs []*x509.Certificate) (err error) {
 
 // Bundle takes an X509 certificate (already in the
 // Certificate structure), a private key in one of the appropriate
-// formats (i.e. *rsa.PrivateKey or *ecdsa.PrivateKey), using them to
+// formats (i.e. *rsa.PrivateKey, *ecdsa.PrivateKey or
+// ed25519.PrivateKey), using them to
 // build a certificate bundle.
 func (b *Bundler) Bundle(certs []*x509.Certificate, key interface{}, flavor BundleFlavor) (*Bundle, error) {
 	log.Infof("bundling certificate for %+v", certs[0].Subject)
@@ -465,6 +484,14 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key interface{}, flavor Bund
 			if cert.PublicKey.(*ecdsa.PublicKey).X.Cmp(ecdsaKey.PublicKey.X) != 0 {
 				return nil, errors.New(errors.PrivateKeyError, errors.KeyMismatch, nil)
 			}
+		case cert.PublicKeyAlgorithm == x509.Ed25519:
+			var edKey ed25519.PrivateKey
+			if edKey, ok = key.(ed25519.PrivateKey); !ok {
+				return nil, errors.New(errors.PrivateKeyError, errors.KeyMismatch, nil)
+			}
+			if !cert.PublicKey.(ed25519.PublicKey).Equal(edKey.Public()) {
+				return nil, errors.New(errors.PrivateKeyError, errors.KeyMismatch, nil)
+			}
 		default:
 			return nil, errors.New(errors.PrivateKeyError, errors.NotRSAOrECC, nil)
 		}
@@ -472,6 +499,7 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key interface{}, flavor Bund
 		switch {
 		case cert.PublicKeyAlgorithm == x509.RSA:
 		case cert.PublicKeyAlgorithm == x509.ECDSA:
+		case cert.PublicKeyAlgorithm == x509.Ed25519:
 		default:
 			return nil, errors.New(errors.PrivateKeyError, errors.NotRSAOrECC, nil)
 		}
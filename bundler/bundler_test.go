@@ -14,6 +14,7 @@ import (
 	"github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
 	"github.com/cloudflare/cfssl/ubiquity"
 )
 
@@ -364,7 +365,7 @@ func newBundler(t *testing.T) (b *Bundler) {
 
 // create a test intermediate cert in PEM
 func createInterCert(t *testing.T, csrFile string, policy *config.Signing, profileName string) (certPEM []byte) {
-	signer, err := signer.NewSigner(testCAFile, testCAKeyFile, policy)
+	s, err := local.NewSignerFromFile(testCAFile, testCAKeyFile, policy)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -372,7 +373,11 @@ func createInterCert(t *testing.T, csrFile string, policy *config.Signing, profi
 	if err != nil {
 		t.Fatal(err)
 	}
-	certPEM, err = signer.Sign("cloudflare-inter.com", csr, profileName)
+	certPEM, err = s.Sign(signer.SignRequest{
+		Hosts:   []string{"cloudflare-inter.com"},
+		Request: string(csr),
+		Profile: profileName,
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
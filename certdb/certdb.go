@@ -0,0 +1,73 @@
+// Package certdb defines the interface to the store of certificates
+// issued by CF-SSL. Every certificate the signer issues may be
+// recorded, so that it can later be looked up, listed as it nears
+// expiry, or revoked.
+package certdb
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"time"
+)
+
+// The statuses a certificate record may have.
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+)
+
+// A CertificateRecord is the stored form of an issued certificate. A
+// certificate is identified by its serial number, in decimal, and the
+// hex-encoded authority key identifier of its issuer. Reason and
+// RevokedAt are only set once the certificate has been revoked.
+type CertificateRecord struct {
+	Serial    string    `json:"serial"`
+	AKI       string    `json:"aki"`
+	Status    string    `json:"status"`
+	Reason    int       `json:"reason"`
+	Expiry    time.Time `json:"expiry"`
+	RevokedAt time.Time `json:"revoked_at"`
+	Profile   string    `json:"profile"`
+	Requester string    `json:"requester"`
+	PEM       string    `json:"pem"`
+}
+
+// NewCertificateRecord builds a record of a newly issued certificate,
+// signed with the given profile on behalf of requester.
+func NewCertificateRecord(cert *x509.Certificate, profile, requester string) CertificateRecord {
+	return CertificateRecord{
+		Serial:    cert.SerialNumber.String(),
+		AKI:       hex.EncodeToString(cert.AuthorityKeyId),
+		Status:    StatusGood,
+		Expiry:    cert.NotAfter.UTC(),
+		Profile:   profile,
+		Requester: requester,
+		PEM:       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+	}
+}
+
+// An Accessor stores and retrieves certificate records.
+//
+// InsertCertificate records a newly issued certificate; a certificate
+// with the same serial number and AKI must not already be stored.
+//
+// GetCertificate returns the certificates with the given serial
+// number; if aki is not empty, only the certificate issued by that
+// authority is returned. No records found is not an error.
+//
+// GetExpiringCertificates returns the certificates that have not
+// been revoked and expire between now and the given time.
+//
+// GetRevokedAndUnexpiredCertificates returns the certificates that
+// have been revoked and have not yet expired, as listed in a CRL.
+//
+// RevokeCertificate marks the certificate with the given serial
+// number and AKI as revoked, with an RFC 5280 reason code.
+type Accessor interface {
+	InsertCertificate(cr CertificateRecord) error
+	GetCertificate(serial, aki string) ([]CertificateRecord, error)
+	GetExpiringCertificates(before time.Time) ([]CertificateRecord, error)
+	GetRevokedAndUnexpiredCertificates() ([]CertificateRecord, error)
+	RevokeCertificate(serial, aki string, reasonCode int) error
+}
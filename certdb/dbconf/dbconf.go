@@ -0,0 +1,82 @@
+// Package dbconf loads the configuration of the certificate store and
+// opens the store it describes.
+package dbconf
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/file"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	// The SQLite driver is linked in, so that a DB config may name
+	// the "sqlite3" driver for an embedded SQL store.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// FileDriver is the driver name selecting the JSON file store, whose
+// data source is the path of the file.
+const FileDriver = "file"
+
+// A DBConfig names the driver of the certificate store and its data
+// source. Any driver other than "file" is a database/sql driver, which
+// must be linked into the program; the "sqlite3" driver always is.
+type DBConfig struct {
+	DriverName     string `json:"driver"`
+	DataSourceName string `json:"data_source"`
+}
+
+// LoadFile reads a DBConfig from a JSON file.
+func LoadFile(path string) (*DBConfig, error) {
+	log.Debug("Loading DB config: ", path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, cferr.New(cferr.CertStoreError, cferr.ReadFailed, err)
+	}
+
+	cfg := new(DBConfig)
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return nil, cferr.New(cferr.CertStoreError, cferr.DecodeFailed, err)
+	}
+	if cfg.DriverName == "" || cfg.DataSourceName == "" {
+		return nil, cferr.New(cferr.CertStoreError, cferr.DecodeFailed,
+			errors.New("DB config must give a driver and a data source"))
+	}
+	return cfg, nil
+}
+
+// Open opens the certificate store described by the config.
+func (cfg *DBConfig) Open() (certdb.Accessor, error) {
+	if cfg.DriverName == FileDriver {
+		a, err := file.NewAccessor(cfg.DataSourceName)
+		if err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+
+	db, err := sql.Open(cfg.DriverName, cfg.DataSourceName)
+	if err != nil {
+		return nil, cferr.New(cferr.CertStoreError, cferr.Unknown, err)
+	}
+	a, err := certsql.NewAccessor(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// DBFromConfig loads the DB config at path and opens the certificate
+// store it describes.
+func DBFromConfig(path string) (certdb.Accessor, error) {
+	cfg, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Open()
+}
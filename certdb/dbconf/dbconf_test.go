@@ -0,0 +1,45 @@
+package dbconf
+
+import (
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	cfg, err := LoadFile("testdata/file.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DriverName != FileDriver || cfg.DataSourceName != "testdata/certs.json" {
+		t.Fatalf("Unexpected DB config %+v", cfg)
+	}
+
+	if _, err = LoadFile("testdata/nonexistent.json"); err == nil {
+		t.Fatal("Expected error loading a missing DB config.")
+	}
+	if _, err = LoadFile("testdata/incomplete.json"); err == nil {
+		t.Fatal("Expected error loading a DB config without a data source.")
+	}
+}
+
+func TestDBFromConfig(t *testing.T) {
+	db, err := DBFromConfig("testdata/file.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := db.GetCertificate("1", ""); err != nil || len(found) != 0 {
+		t.Fatalf("Expected an empty store, got %v, %v", found, err)
+	}
+
+	// The SQLite driver is linked in by default.
+	db, err = DBFromConfig("testdata/sqlite.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := db.GetCertificate("1", ""); err != nil || len(found) != 0 {
+		t.Fatalf("Expected an empty store, got %v, %v", found, err)
+	}
+
+	if _, err = DBFromConfig("testdata/unknown.json"); err == nil {
+		t.Fatal("Expected error opening a store with an unknown driver.")
+	}
+}
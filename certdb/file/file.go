@@ -0,0 +1,164 @@
+// Package file implements a certificate store kept in a single JSON
+// file. It is suitable for small, single-process deployments; the
+// whole store is held in memory and rewritten on every change.
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	cferr "github.com/cloudflare/cfssl/errors"
+)
+
+// An Accessor is a certdb.Accessor backed by a JSON file.
+type Accessor struct {
+	path    string
+	lock    sync.Mutex
+	records []certdb.CertificateRecord
+}
+
+// NewAccessor loads the certificate store kept in the file at path,
+// which is created on the first insertion if it does not exist.
+func NewAccessor(path string) (*Accessor, error) {
+	a := &Accessor{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	} else if err != nil {
+		return nil, cferr.New(cferr.CertStoreError, cferr.ReadFailed, err)
+	}
+
+	if err = json.Unmarshal(data, &a.records); err != nil {
+		return nil, cferr.New(cferr.CertStoreError, cferr.DecodeFailed, err)
+	}
+	return a, nil
+}
+
+// save writes the store out to a temporary file and renames it over
+// the store, so that a failed write never leaves a truncated store.
+func (a *Accessor) save() error {
+	data, err := json.MarshalIndent(a.records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(a.path), filepath.Base(a.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), a.path)
+}
+
+// find returns the index of the record with the given serial number
+// and AKI, or -1 if there is none.
+func (a *Accessor) find(serial, aki string) int {
+	for i, cr := range a.records {
+		if cr.Serial == serial && cr.AKI == aki {
+			return i
+		}
+	}
+	return -1
+}
+
+// InsertCertificate adds a certificate record to the store.
+func (a *Accessor) InsertCertificate(cr certdb.CertificateRecord) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.find(cr.Serial, cr.AKI) >= 0 {
+		return cferr.New(cferr.CertStoreError, cferr.InsertionFailed,
+			errors.New("certificate "+cr.Serial+" is already recorded"))
+	}
+
+	a.records = append(a.records, cr)
+	if err := a.save(); err != nil {
+		a.records = a.records[:len(a.records)-1]
+		return cferr.New(cferr.CertStoreError, cferr.InsertionFailed, err)
+	}
+	return nil
+}
+
+// GetCertificate returns the records of the certificates with the
+// given serial number, issued by the authority with the given key
+// identifier if aki is not empty.
+func (a *Accessor) GetCertificate(serial, aki string) ([]certdb.CertificateRecord, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var found []certdb.CertificateRecord
+	for _, cr := range a.records {
+		if cr.Serial == serial && (aki == "" || cr.AKI == aki) {
+			found = append(found, cr)
+		}
+	}
+	return found, nil
+}
+
+// GetExpiringCertificates returns the records of the unrevoked
+// certificates that expire between now and before.
+func (a *Accessor) GetExpiringCertificates(before time.Time) ([]certdb.CertificateRecord, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+	var found []certdb.CertificateRecord
+	for _, cr := range a.records {
+		if cr.Status == certdb.StatusGood && cr.Expiry.After(now) && !cr.Expiry.After(before) {
+			found = append(found, cr)
+		}
+	}
+	return found, nil
+}
+
+// GetRevokedAndUnexpiredCertificates returns the records of the
+// revoked certificates that have not yet expired.
+func (a *Accessor) GetRevokedAndUnexpiredCertificates() ([]certdb.CertificateRecord, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+	var found []certdb.CertificateRecord
+	for _, cr := range a.records {
+		if cr.Status == certdb.StatusRevoked && cr.Expiry.After(now) {
+			found = append(found, cr)
+		}
+	}
+	return found, nil
+}
+
+// RevokeCertificate marks the record of a certificate as revoked.
+func (a *Accessor) RevokeCertificate(serial, aki string, reasonCode int) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.find(serial, aki)
+	if i < 0 {
+		return cferr.New(cferr.CertStoreError, cferr.RecordNotFound, nil)
+	}
+
+	old := a.records[i]
+	a.records[i].Status = certdb.StatusRevoked
+	a.records[i].Reason = reasonCode
+	a.records[i].RevokedAt = time.Now().UTC()
+	if err := a.save(); err != nil {
+		a.records[i] = old
+		return cferr.New(cferr.CertStoreError, cferr.UpdateFailed, err)
+	}
+	return nil
+}
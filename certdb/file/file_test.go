@@ -0,0 +1,56 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+)
+
+func TestAccessor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-certdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "certs.json")
+
+	a, err := NewAccessor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testdb.TestAccessor(t, a)
+
+	// The store is read back from disk in the same state.
+	a, err = NewAccessor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := a.GetCertificate("1", "aa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Status != certdb.StatusRevoked {
+		t.Fatalf("Unexpected records after reload %+v", found)
+	}
+	if len(a.records) != 3 {
+		t.Fatalf("Expected 3 records after reload, got %d", len(a.records))
+	}
+}
+
+func TestNewAccessorError(t *testing.T) {
+	f, err := ioutil.TempFile("", "cfssl-certdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not json")
+	f.Close()
+
+	if _, err = NewAccessor(f.Name()); err == nil {
+		t.Fatal("Expected error loading a malformed store.")
+	}
+}
@@ -0,0 +1,139 @@
+// Package sql implements a certificate store in an SQL database,
+// accessed through database/sql. The database driver is chosen by the
+// program opening the database; queries use '?' placeholders, as
+// expected by drivers such as SQLite and MySQL.
+package sql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	cferr "github.com/cloudflare/cfssl/errors"
+)
+
+// Schema is the definition of the certificates table. NewAccessor
+// creates the table if it does not exist.
+const Schema = `CREATE TABLE IF NOT EXISTS certificates (
+	serial_number            VARCHAR(128) NOT NULL,
+	authority_key_identifier VARCHAR(128) NOT NULL,
+	status                   VARCHAR(16) NOT NULL,
+	reason                   INTEGER NOT NULL DEFAULT 0,
+	expiry                   TIMESTAMP NOT NULL,
+	revoked_at               TIMESTAMP NULL,
+	profile                  VARCHAR(128) NOT NULL,
+	requester                VARCHAR(255) NOT NULL,
+	pem                      TEXT NOT NULL,
+	PRIMARY KEY (serial_number, authority_key_identifier)
+)`
+
+const (
+	insertSQL = `INSERT INTO certificates
+		(serial_number, authority_key_identifier, status, reason, expiry, revoked_at, profile, requester, pem)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	selectSQL = `SELECT serial_number, authority_key_identifier, status, reason,
+		expiry, revoked_at, profile, requester, pem FROM certificates`
+	revokeSQL = `UPDATE certificates SET status = ?, reason = ?, revoked_at = ?
+		WHERE serial_number = ? AND authority_key_identifier = ?`
+)
+
+// An Accessor is a certdb.Accessor backed by an SQL database.
+type Accessor struct {
+	db *sql.DB
+}
+
+// NewAccessor returns an Accessor for the certificates table in db,
+// creating the table if needed.
+func NewAccessor(db *sql.DB) (*Accessor, error) {
+	if db == nil {
+		return nil, cferr.New(cferr.CertStoreError, cferr.Unknown, errors.New("no database given"))
+	}
+	if _, err := db.Exec(Schema); err != nil {
+		return nil, cferr.New(cferr.CertStoreError, cferr.Unknown, err)
+	}
+	return &Accessor{db: db}, nil
+}
+
+// InsertCertificate adds a certificate record to the database.
+func (a *Accessor) InsertCertificate(cr certdb.CertificateRecord) error {
+	var revokedAt interface{}
+	if !cr.RevokedAt.IsZero() {
+		revokedAt = cr.RevokedAt.UTC()
+	}
+
+	_, err := a.db.Exec(insertSQL, cr.Serial, cr.AKI, cr.Status, cr.Reason,
+		cr.Expiry.UTC(), revokedAt, cr.Profile, cr.Requester, cr.PEM)
+	if err != nil {
+		return cferr.New(cferr.CertStoreError, cferr.InsertionFailed, err)
+	}
+	return nil
+}
+
+// query runs a select on the certificates table, restricted by the
+// given where clause, and scans the resulting records.
+func (a *Accessor) query(where string, args ...interface{}) ([]certdb.CertificateRecord, error) {
+	rows, err := a.db.Query(selectSQL+" WHERE "+where, args...)
+	if err != nil {
+		return nil, cferr.New(cferr.CertStoreError, cferr.Unknown, err)
+	}
+	defer rows.Close()
+
+	var found []certdb.CertificateRecord
+	for rows.Next() {
+		var cr certdb.CertificateRecord
+		var revokedAt sql.NullTime
+		err = rows.Scan(&cr.Serial, &cr.AKI, &cr.Status, &cr.Reason,
+			&cr.Expiry, &revokedAt, &cr.Profile, &cr.Requester, &cr.PEM)
+		if err != nil {
+			return nil, cferr.New(cferr.CertStoreError, cferr.ParseFailed, err)
+		}
+		cr.Expiry = cr.Expiry.UTC()
+		cr.RevokedAt = revokedAt.Time.UTC()
+		found = append(found, cr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cferr.New(cferr.CertStoreError, cferr.Unknown, err)
+	}
+	return found, nil
+}
+
+// GetCertificate returns the records of the certificates with the
+// given serial number, issued by the authority with the given key
+// identifier if aki is not empty.
+func (a *Accessor) GetCertificate(serial, aki string) ([]certdb.CertificateRecord, error) {
+	if aki == "" {
+		return a.query("serial_number = ?", serial)
+	}
+	return a.query("serial_number = ? AND authority_key_identifier = ?", serial, aki)
+}
+
+// GetExpiringCertificates returns the records of the unrevoked
+// certificates that expire between now and before.
+func (a *Accessor) GetExpiringCertificates(before time.Time) ([]certdb.CertificateRecord, error) {
+	return a.query("status = ? AND expiry > ? AND expiry <= ?",
+		certdb.StatusGood, time.Now().UTC(), before.UTC())
+}
+
+// GetRevokedAndUnexpiredCertificates returns the records of the
+// revoked certificates that have not yet expired.
+func (a *Accessor) GetRevokedAndUnexpiredCertificates() ([]certdb.CertificateRecord, error) {
+	return a.query("status = ? AND expiry > ?", certdb.StatusRevoked, time.Now().UTC())
+}
+
+// RevokeCertificate marks the record of a certificate as revoked.
+func (a *Accessor) RevokeCertificate(serial, aki string, reasonCode int) error {
+	result, err := a.db.Exec(revokeSQL, certdb.StatusRevoked, reasonCode, time.Now().UTC(), serial, aki)
+	if err != nil {
+		return cferr.New(cferr.CertStoreError, cferr.UpdateFailed, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return cferr.New(cferr.CertStoreError, cferr.UpdateFailed, err)
+	}
+	if n == 0 {
+		return cferr.New(cferr.CertStoreError, cferr.RecordNotFound, nil)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package sql
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestAccessor(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Each connection to an in-memory database has its own data.
+	db.SetMaxOpenConns(1)
+
+	a, err := NewAccessor(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testdb.TestAccessor(t, a)
+}
@@ -0,0 +1,92 @@
+// Package testdb holds the tests shared by the certdb.Accessor
+// implementations.
+package testdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+)
+
+// TestAccessor runs insertions, lookups, expiry and revocation
+// listings and revocations against an empty store.
+func TestAccessor(t *testing.T, db certdb.Accessor) {
+	now := time.Now().UTC().Truncate(time.Second)
+	records := []certdb.CertificateRecord{
+		{Serial: "1", AKI: "aa", Status: certdb.StatusGood, Expiry: now.Add(time.Hour), Profile: "server", Requester: "alice", PEM: "pem 1"},
+		{Serial: "1", AKI: "bb", Status: certdb.StatusGood, Expiry: now.Add(48 * time.Hour), Profile: "client", Requester: "bob", PEM: "pem 2"},
+		{Serial: "2", AKI: "aa", Status: certdb.StatusGood, Expiry: now.Add(-time.Hour), PEM: "pem 3"},
+	}
+	for _, cr := range records {
+		if err := db.InsertCertificate(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertCertificate(records[0]); err == nil {
+		t.Fatal("Expected error inserting a duplicate certificate.")
+	}
+
+	found, err := db.GetCertificate("1", "aa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("Expected 1 certificate, got %d", len(found))
+	}
+	cr := found[0]
+	if cr.Profile != "server" || cr.Requester != "alice" || cr.PEM != "pem 1" || !cr.Expiry.Equal(records[0].Expiry) {
+		t.Fatalf("Unexpected certificate record %+v", cr)
+	}
+
+	if found, err = db.GetCertificate("1", ""); err != nil {
+		t.Fatal(err)
+	} else if len(found) != 2 {
+		t.Fatalf("Expected 2 certificates with serial 1, got %d", len(found))
+	}
+	if found, err = db.GetCertificate("3", ""); err != nil {
+		t.Fatal(err)
+	} else if len(found) != 0 {
+		t.Fatalf("Expected no certificates with serial 3, got %d", len(found))
+	}
+
+	// Only the first certificate expires within a day; the third
+	// has already expired.
+	if found, err = db.GetExpiringCertificates(now.Add(24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if len(found) != 1 || found[0].AKI != "aa" || found[0].Serial != "1" {
+		t.Fatalf("Unexpected expiring certificates %+v", found)
+	}
+
+	if err = db.RevokeCertificate("1", "aa", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.RevokeCertificate("2", "aa", 4); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.RevokeCertificate("3", "aa", 1); err == nil {
+		t.Fatal("Expected error revoking an unknown certificate.")
+	}
+
+	if found, err = db.GetCertificate("1", "aa"); err != nil {
+		t.Fatal(err)
+	}
+	cr = found[0]
+	if cr.Status != certdb.StatusRevoked || cr.Reason != 1 || cr.RevokedAt.IsZero() {
+		t.Fatalf("Certificate not revoked: %+v", cr)
+	}
+
+	// Revoked certificates are no longer listed as expiring.
+	if found, err = db.GetExpiringCertificates(now.Add(72 * time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if len(found) != 1 || found[0].AKI != "bb" {
+		t.Fatalf("Unexpected expiring certificates %+v", found)
+	}
+
+	// The revoked certificate that has already expired is not listed.
+	if found, err = db.GetRevokedAndUnexpiredCertificates(); err != nil {
+		t.Fatal(err)
+	} else if len(found) != 1 || found[0].Serial != "1" || found[0].AKI != "aa" || found[0].Reason != 1 {
+		t.Fatalf("Unexpected revoked certificates %+v", found)
+	}
+}
@@ -10,6 +10,10 @@ The commands are
 	bundle	create a client cert bundle
 	sign	signs a client cert
 	serve	starts a HTTP server handling sign and bundle requests
+	ocspsign	signs an OCSP response for a certificate
+	ocspserve	starts an OCSP responder serving pre-signed responses
+	gencrl	generates a CRL listing revoked certificates
+	revoke	revokes a certificate in the certificate database
 	version	prints the current cfssl version
 
 Use "cfssl [command] -help" to find out more about a command.
@@ -22,8 +26,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 )
 
@@ -61,12 +67,39 @@ var Config struct {
 	cfg               *config.Config
 	profile           string
 	isCA              bool
+	renew             bool
+	rekey             bool
+	intermediate      bool
+	crossSign         bool
+	keyFormat         string
+	keyOutPassword    string
 	intDir            string
 	flavor            string
 	metadata          string
 	domain            string
 	ip                string
 	remote            string
+	responderFile     string
+	responderKeyFile  string
+	status            string
+	reason            string
+	revokedAt         string
+	interval          time.Duration
+	responseFile      string
+	issuersFile       string
+	prefix            string
+	crlExpiry         time.Duration
+	dbConfig          string
+	serial            string
+	aki               string
+	notBefore         string
+	notAfter          string
+	tlsCertFile       string
+	tlsKeyFile        string
+	mutualTLSCAFile   string
+	tlsRemoteCAFile   string
+	mutualTLSCertFile string
+	mutualTLSKeyFile  string
 }
 
 // Parsed command name
@@ -80,6 +113,9 @@ func registerFlags() {
 	cfsslFlagSet.StringVar(&Config.caFile, "ca", "ca.pem", "CA used to sign the new certificate")
 	cfsslFlagSet.StringVar(&Config.caKeyFile, "ca-key", "ca-key.pem", "CA private key")
 	cfsslFlagSet.StringVar(&Config.keyFile, "key", "", "private key for the certificate")
+	cfsslFlagSet.StringVar(&Config.keyFormat, "key-format", "", "format of generated private keys: pkcs8 or encrypted-pkcs8")
+	cfsslFlagSet.StringVar(&Config.keyOutPassword, "key-out-password", helpers.DefaultKeyOutPasswordSource, "passphrase to encrypt generated private keys with: env:NAME, file:PATH or prompt")
+	cfsslFlagSet.StringVar(&helpers.KeyPasswordSource, "key-password", helpers.DefaultKeyPasswordSource, "passphrase of encrypted private keys: env:NAME, file:PATH or prompt")
 	cfsslFlagSet.StringVar(&Config.intermediatesFile, "intermediates", "", "intermediate certs")
 	cfsslFlagSet.StringVar(&Config.caBundleFile, "ca-bundle", "/etc/cfssl/ca-bundle.crt", "Bundle to be used for root certificates pool")
 	cfsslFlagSet.StringVar(&Config.intBundleFile, "int-bundle", "/etc/cfssl/int-bundle.crt", "Bundle to be used for intermediate certificates pool")
@@ -88,12 +124,37 @@ func registerFlags() {
 	cfsslFlagSet.StringVar(&Config.configFile, "f", "", "path to configuration file")
 	cfsslFlagSet.StringVar(&Config.profile, "profile", "", "signing profile to use")
 	cfsslFlagSet.BoolVar(&Config.isCA, "initca", false, "initialise new CA")
+	cfsslFlagSet.BoolVar(&Config.renew, "renew", false, "renew the CA certificate with the same key")
+	cfsslFlagSet.BoolVar(&Config.rekey, "rekey", false, "generate a new CA key and cross-sign it with the current one")
+	cfsslFlagSet.BoolVar(&Config.intermediate, "intermediate", false, "generate an intermediate CA signed by the CA")
+	cfsslFlagSet.BoolVar(&Config.crossSign, "cross-sign", false, "sign an existing CA certificate again under the CA")
 	cfsslFlagSet.StringVar(&Config.intDir, "int-dir", "/etc/cfssl/intermediates", "specify intermediates directory")
 	cfsslFlagSet.StringVar(&Config.flavor, "flavor", "ubiquitous", "Bundle Flavor: ubiquitous, optimal.")
 	cfsslFlagSet.StringVar(&Config.metadata, "metadata", "/etc/cfssl/ca-bundle.crt.metadata", "Metadata file for root certificate presence. The content of the file is a json dictionary (k,v): each key k is SHA-1 digest of a root certificate while value v is a list of key store filenames.")
 	cfsslFlagSet.StringVar(&Config.domain, "domain", "", "remote server domain name")
 	cfsslFlagSet.StringVar(&Config.ip, "ip", "", "remote server ip")
-	cfsslFlagSet.StringVar(&Config.remote, "remote", "", "remote CFSSL server")
+	cfsslFlagSet.StringVar(&Config.remote, "remote", "", "remote CFSSL servers, as a comma-separated list")
+	cfsslFlagSet.StringVar(&Config.responderFile, "responder", "", "Certificate for OCSP responder")
+	cfsslFlagSet.StringVar(&Config.responderKeyFile, "responder-key", "", "private key for OCSP responder certificate")
+	cfsslFlagSet.StringVar(&Config.status, "status", "good", "Status of the certificate: good, revoked, unknown")
+	cfsslFlagSet.StringVar(&Config.reason, "reason", "", "Reason code for revocation")
+	cfsslFlagSet.StringVar(&Config.revokedAt, "revoked-at", "now", "Date of revocation (YYYY-MM-DD)")
+	cfsslFlagSet.StringVar(&Config.responseFile, "responses", "", "file to load OCSP responses from")
+	cfsslFlagSet.StringVar(&Config.issuersFile, "issuers", "", "CA certificates whose OCSP responses are served for any CertID hash algorithm")
+	cfsslFlagSet.StringVar(&Config.prefix, "prefix", "/", "URL path the OCSP responder is served at")
+	cfsslFlagSet.DurationVar(&Config.interval, "interval", 4*24*time.Hour, "Interval between OCSP updates (default: 96h)")
+	cfsslFlagSet.StringVar(&Config.dbConfig, "db-config", "", "certificate database configuration file")
+	cfsslFlagSet.StringVar(&Config.serial, "serial", "", "certificate serial number")
+	cfsslFlagSet.StringVar(&Config.aki, "aki", "", "certificate issuer (authority) key identifier")
+	cfsslFlagSet.DurationVar(&Config.crlExpiry, "crl-expiry", 7*24*time.Hour, "Validity period of generated CRLs (default: 168h)")
+	cfsslFlagSet.StringVar(&Config.notBefore, "not-before", "", "Start of the certificate's validity (RFC 3339)")
+	cfsslFlagSet.StringVar(&Config.notAfter, "not-after", "", "End of the certificate's validity (RFC 3339)")
+	cfsslFlagSet.StringVar(&Config.tlsCertFile, "tls-cert", "", "Certificate of the API server's TLS listener")
+	cfsslFlagSet.StringVar(&Config.tlsKeyFile, "tls-key", "", "Private key of the API server's TLS listener")
+	cfsslFlagSet.StringVar(&Config.mutualTLSCAFile, "mutual-tls-ca", "", "CA certificates that API clients' TLS certificates must be verified against")
+	cfsslFlagSet.StringVar(&Config.tlsRemoteCAFile, "tls-remote-ca", "", "CA certificates that the remote server's TLS certificate is verified against")
+	cfsslFlagSet.StringVar(&Config.mutualTLSCertFile, "mutual-tls-client-cert", "", "Client certificate presented to the remote server")
+	cfsslFlagSet.StringVar(&Config.mutualTLSKeyFile, "mutual-tls-client-key", "", "Private key of the client certificate presented to the remote server")
 }
 
 // usage is the cfssl usage heading. It will be appended with names of defined commands in cmds
@@ -138,12 +199,16 @@ func init() {
 	}
 	// Register commands.
 	cmds = map[string]*Command{
-		"bundle":  CLIBundler,
-		"sign":    CLISigner,
-		"serve":   CLIServer,
-		"version": CLIVersioner,
-		"genkey":  CLIGenKey,
-		"gencert": CLIGenCert,
+		"bundle":    CLIBundler,
+		"sign":      CLISigner,
+		"serve":     CLIServer,
+		"version":   CLIVersioner,
+		"genkey":    CLIGenKey,
+		"gencert":   CLIGenCert,
+		"ocspsign":  CLIOCSPSigner,
+		"ocspserve": CLIOCSPServe,
+		"gencrl":    CLIGenCRL,
+		"revoke":    CLIRevoke,
 	}
 	// Register all command flags.
 	registerFlags()
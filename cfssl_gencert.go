@@ -2,10 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 
-	"github.com/cloudflare/cfssl/api/client"
-	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/csr"
 	"github.com/cloudflare/cfssl/initca"
 	"github.com/cloudflare/cfssl/log"
@@ -16,21 +15,39 @@ var gencertUsageText = `cfssl gencert -- generate a new key and signed certifica
 
 Usage of gencert:
         cfssl gencert [-initca] CSRJSON
-        cfssl gencert [-remote remote_server] HOSTNAME CSRJSON
-        cfssl gencert [-ca cert] [-ca-key key] HOSTNAME CSRJSON
+        cfssl gencert -initca -renew -ca cert -ca-key key
+        cfssl gencert -initca -rekey -ca cert -ca-key key [CSRJSON]
+        cfssl gencert [-remote remote_server] [HOSTNAME] CSRJSON
+        cfssl gencert [-ca cert] [-ca-key key] [HOSTNAME] CSRJSON
+        cfssl gencert -f config -profile profile [HOSTNAME] CSRJSON
+        cfssl gencert -intermediate [-ca cert] [-ca-key key] [-f config -profile profile] CSRJSON
 
 Arguments:
-        HOSTNAME:   Hostname for the cert
+        HOSTNAME:   Comma-separated hostnames and IP addresses for the cert
         CSRJSON:    JSON file containing the request
 
-	HOSTNAME should not be included when initalising a new CA.
+	HOSTNAME should not be included when initalising a new CA. If it is
+	left out, the cert is issued for the hosts in the request.
+
+	With -intermediate, the CA signs a new intermediate CA under a CA
+	profile, or its default CA policy if no config is given, and the
+	output includes the chain up to the CA.
+
+	With -initca, -renew issues a new self-signed certificate for the
+	root CA with the same subject and key, and -rekey a new key and
+	root certificate, together with the new root cross-signed by the
+	current one.
 Flags:
 `
 
-var gencertFlags = []string{"initca", "remote", "ca", "ca-key", "f"}
+var gencertFlags = []string{"initca", "renew", "rekey", "intermediate", "remote", "ca", "ca-key", "key-format", "key-out-password", "key-password", "f", "profile", "tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key"}
 
 func gencertMain(args []string) (err error) {
-	if Config.hostname == "" && !Config.isCA {
+	if Config.isCA && (Config.renew || Config.rekey) {
+		return gencertRenew(args)
+	}
+
+	if Config.hostname == "" && !Config.isCA && !Config.intermediate && len(args) > 1 {
 		Config.hostname, args, err = popFirstArgument(args)
 		if err != nil {
 			return
@@ -52,6 +69,9 @@ func gencertMain(args []string) (err error) {
 	if err != nil {
 		return
 	}
+	if req.KeyRequest, err = keyOutput(req.KeyRequest); err != nil {
+		return
+	}
 
 	if Config.isCA {
 		var key, cert []byte
@@ -59,27 +79,22 @@ func gencertMain(args []string) (err error) {
 		if err != nil {
 			return
 		}
-		printCert(key, nil, cert)
+		printCert(key, nil, cert, nil)
 	} else {
-		if Config.remote != "" {
-			return gencertRemotely(req)
+		if Config.remote == "" && !profileHasRemote(Config.profile) {
+			if Config.caFile == "" {
+				log.Error("cannot sign certificate without a CA certificate (provide one with -ca)")
+				return
+			}
+
+			if Config.caKeyFile == "" {
+				log.Error("cannot sign certificate without a CA key (provide one with -ca-key)")
+				return
+			}
 		}
 
-		if Config.caFile == "" {
-			log.Error("cannot sign certificate without a CA certificate (provide one with -ca)")
-			return
-		}
-
-		if Config.caKeyFile == "" {
-			log.Error("cannot sign certificate without a CA key (provide one with -ca-key)")
-			return
-		}
-
-		var policy *config.Signing
-		// If there is a config, use its signing policy. Otherwise, leave policy == nil
-		// and NewSigner will use DefaultConfig().
-		if Config.cfg != nil {
-			policy = Config.cfg.Signing
+		if Config.intermediate {
+			return gencertIntermediate(&req)
 		}
 
 		var key, csrPEM []byte
@@ -90,57 +105,129 @@ func gencertMain(args []string) (err error) {
 			return
 		}
 
-		var sign *signer.Signer
-		sign, err = signer.NewSigner(Config.caFile, Config.caKeyFile, policy)
+		hosts := signer.SplitHosts(Config.hostname)
+		if len(hosts) == 0 {
+			hosts = req.Hosts
+		}
+
+		var s signer.Signer
+		s, err = signerFromConfig()
 		if err != nil {
 			return
 		}
 
 		var cert []byte
-		cert, err = sign.Sign(Config.hostname, csrPEM, Config.profile)
+		cert, err = s.Sign(signer.SignRequest{
+			Hosts:   hosts,
+			Request: string(csrPEM),
+			Profile: Config.profile,
+		})
 		if err != nil {
 			return
 		}
 
-		printCert(key, csrPEM, cert)
+		printCert(key, csrPEM, cert, nil)
 	}
 	return nil
 }
 
-func printCert(key, csrPEM, cert []byte) {
-	out := map[string]string{
-		"cert": string(cert),
-		"key":  string(key),
+// profileHasRemote reports whether the named signing profile of the
+// config forwards signing to a remote server, so that no CA is needed
+// locally.
+func profileHasRemote(name string) bool {
+	if Config.cfg == nil {
+		return false
 	}
-	if csrPEM != nil {
-		out["csr"] = string(csrPEM)
+	profile := Config.cfg.Signing.Profile(name)
+	return profile != nil && profile.RemoteServer != ""
+}
+
+// gencertIntermediate generates an intermediate CA from the request,
+// signed under the CA profile selected on the command line, or under
+// the default CA policy if no config is given.
+func gencertIntermediate(req *csr.CertificateRequest) error {
+	s, err := signerFromConfig()
+	if err != nil {
+		return err
+	}
+	if Config.cfg == nil {
+		s.SetPolicy(initca.CAPolicy)
 	}
 
-	jsonOut, err := json.Marshal(out)
+	key, csrPEM, cert, chain, err := initca.NewIntermediate(req, s, Config.profile)
 	if err != nil {
-		return
+		return err
 	}
-	fmt.Printf("%s\n", jsonOut)
+	printCert(key, csrPEM, cert, chain)
+	return nil
 }
 
-func gencertRemotely(req csr.CertificateRequest) error {
-	srv := client.NewServer(Config.remote)
+// gencertRenew renews the CA given by -ca and -ca-key with -renew, or
+// re-keys it with -rekey, generating a key as asked for by the "key"
+// of the CSR JSON, if given, or of the kind of the current key.
+func gencertRenew(args []string) error {
+	if Config.renew && Config.rekey {
+		return errors.New("-renew and -rekey cannot be used together")
+	}
 
-	g := &csr.Generator{validator}
-	csrPEM, key, err := g.ProcessRequest(&req)
+	if Config.renew {
+		cert, err := initca.Renew(Config.caFile, Config.caKeyFile)
+		if err != nil {
+			return err
+		}
+		printCert(nil, nil, cert, nil)
+		return nil
+	}
+
+	var req csr.CertificateRequest
+	if len(args) > 0 {
+		csrFileBytes, err := readStdin(args[0])
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(csrFileBytes, &req); err != nil {
+			return err
+		}
+	}
+	kr, err := keyOutput(req.KeyRequest)
 	if err != nil {
-		key = nil
 		return err
 	}
-
-	var cert []byte
-	cert, err = srv.Sign(Config.hostname, csrPEM, Config.profile)
+	cert, crossCert, key, err := initca.Rekey(Config.caFile, Config.caKeyFile, kr)
 	if err != nil {
 		return err
 	}
-
-	printCert(key, csrPEM, cert)
+	printJSON(map[string]string{
+		"cert":  string(cert),
+		"cross": string(crossCert),
+		"key":   string(key),
+	})
 	return nil
 }
 
+func printCert(key, csrPEM, cert, chain []byte) {
+	out := map[string]string{
+		"cert": string(cert),
+	}
+	if key != nil {
+		out["key"] = string(key)
+	}
+	if csrPEM != nil {
+		out["csr"] = string(csrPEM)
+	}
+	if chain != nil {
+		out["chain"] = string(chain)
+	}
+	printJSON(out)
+}
+
+// printJSON prints the output of the command as a JSON object.
+func printJSON(out map[string]string) {
+	jsonOut, err := json.Marshal(out)
+	if err != nil {
+		return
+	}
+	fmt.Printf("%s\n", jsonOut)
+}
+
 var CLIGenCert = &Command{gencertUsageText, gencertFlags, gencertMain}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	"github.com/cloudflare/cfssl/crl"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// Usage text of 'cfssl gencrl'
+var gencrlUsageText = `cfssl gencrl -- generates a CRL signed by the CA, listing the revoked certificates.
+Returns a PEM-encoded CRL.
+
+Usage of gencrl:
+        cfssl gencrl [-ca cert] [-ca-key key] [-crl-expiry duration] REVOKED_JSON
+        cfssl gencrl [-ca cert] [-ca-key key] [-crl-expiry duration] -db-config config
+
+Arguments:
+        REVOKED_JSON:   JSON file listing the revoked certificates, use '-' for reading JSON from stdin.
+                        Each entry has a "serial", and optionally a "revoked_at" date and a "reason".
+
+With -db-config, the CRL lists the unexpired certificates issued by the CA that are revoked in the
+certificate database, and no REVOKED_JSON is given.
+
+Flags:
+`
+
+// Flags of 'cfssl gencrl'
+var gencrlFlags = []string{"ca", "ca-key", "key-password", "crl-expiry", "db-config"}
+
+// gencrlMain is the main CLI of CRL generation functionality.
+func gencrlMain(args []string) (err error) {
+	if Config.dbConfig != "" {
+		return gencrlFromDB(args)
+	}
+
+	revokedFile, args, err := popFirstArgument(args)
+	if err != nil {
+		return
+	}
+
+	log.Debug("Loading revoked certificates: ", revokedFile)
+	revokedJSON, err := readStdin(revokedFile)
+	if err != nil {
+		return
+	}
+	revoked, err := crl.ParseRevokedCertificates(revokedJSON)
+	if err != nil {
+		return
+	}
+
+	s, err := crl.NewSignerFromFile(Config.caFile, Config.caKeyFile, Config.crlExpiry)
+	if err != nil {
+		return
+	}
+
+	der, err := s.Sign(revoked)
+	if err != nil {
+		return
+	}
+	fmt.Print(string(crl.EncodePEM(der)))
+	return
+}
+
+// gencrlFromDB signs a CRL listing the certificates revoked in the
+// certificate database.
+func gencrlFromDB(args []string) error {
+	if len(args) > 0 {
+		return errors.New("no REVOKED_JSON may be given with -db-config")
+	}
+
+	db, err := dbconf.DBFromConfig(Config.dbConfig)
+	if err != nil {
+		return err
+	}
+
+	s, err := crl.NewSignerFromFile(Config.caFile, Config.caKeyFile, Config.crlExpiry)
+	if err != nil {
+		return err
+	}
+
+	der, err := s.SignFromDB(db)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(crl.EncodePEM(der)))
+	return nil
+}
+
+// CLIGenCRL assembles the definition of Command 'gencrl'
+var CLIGenCRL = &Command{gencrlUsageText, gencrlFlags, gencrlMain}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/cloudflare/cfssl/csr"
 	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/initca"
 )
 
@@ -22,7 +23,7 @@ Arguments:
 Flags:
 `
 
-var genkeyFlags = []string{"initca", "f"}
+var genkeyFlags = []string{"initca", "key-format", "key-out-password", "key-password", "f"}
 
 func genkeyMain(args []string) (err error) {
 	csrFile, args, err := popFirstArgument(args)
@@ -40,6 +41,9 @@ func genkeyMain(args []string) (err error) {
 	if err != nil {
 		return
 	}
+	if req.KeyRequest, err = keyOutput(req.KeyRequest); err != nil {
+		return
+	}
 
 	if Config.isCA {
 		var key, cert []byte
@@ -84,6 +88,31 @@ func genkeyMain(args []string) (err error) {
 	return nil
 }
 
+// keyOutput applies the -key-format flag to the key request, which is
+// created if needed, and reads the password of a key to encrypt from
+// the -key-out-password source if the request has none. The
+// -key-password source of the passphrase of existing keys, such as the
+// CA key, is never used.
+func keyOutput(kr *csr.KeyRequest) (*csr.KeyRequest, error) {
+	if kr == nil {
+		if Config.keyFormat == "" {
+			return nil, nil
+		}
+		kr = &csr.KeyRequest{}
+	}
+	if Config.keyFormat != "" {
+		kr.Format = Config.keyFormat
+	}
+	if kr.Format == csr.KeyFormatEncryptedPKCS8 && kr.Password == "" {
+		password, err := helpers.ReadNewPassword(Config.keyOutPassword)
+		if err != nil {
+			return nil, err
+		}
+		kr.Password = string(password)
+	}
+	return kr, nil
+}
+
 func validator(req *csr.CertificateRequest) error {
 	if len(req.Hosts) == 0 {
 		return cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("missing hosts field"))
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+)
+
+// Usage text of 'cfssl ocspserve'
+var ocspServerUsageText = `cfssl ocspserve -- set up an HTTP server that handles OCSP requests from a file of pre-signed responses
+
+Usage of ocspserve:
+        cfssl ocspserve [-address address] [-port port] [-prefix path] [-issuers file] -responses file
+
+Without -issuers, responses only answer requests that identify the issuer with SHA-1 hashes.
+
+Flags:
+`
+
+// Flags used by 'cfssl ocspserve'
+var ocspServerFlags = []string{"address", "port", "responses", "issuers", "prefix"}
+
+// ocspServerMain is the command line entry point to the OCSP responder.
+// It sets up a new HTTP server that responds to OCSP requests.
+func ocspServerMain(args []string) error {
+	// ocspserve doesn't support arguments.
+	if len(args) > 0 {
+		return errors.New("Arguments is provided but not defined. Please refer to the usage by flag -h.")
+	}
+
+	if Config.responseFile == "" {
+		return errors.New("no response file provided, please set the -responses flag")
+	}
+
+	var issuers []*x509.Certificate
+	if Config.issuersFile != "" {
+		issuersPEM, err := ioutil.ReadFile(Config.issuersFile)
+		if err != nil {
+			return err
+		}
+		if issuers, err = helpers.ParseCertificatesPEM(issuersPEM); err != nil {
+			return err
+		}
+	}
+
+	src, err := ocsp.NewSourceFromFile(Config.responseFile, issuers)
+	if err != nil {
+		log.Errorf("failed to load OCSP responses: %v", err)
+		return err
+	}
+
+	addr := fmt.Sprintf("%s:%d", Config.address, Config.port)
+	log.Info("Registering OCSP responder handler")
+	log.Info("Now listening on ", addr)
+	return http.ListenAndServe(addr, ocsp.NewResponder(src, Config.prefix))
+}
+
+// CLIOCSPServe assembles the definition of Command 'ocspserve'
+var CLIOCSPServe = &Command{ocspServerUsageText, ocspServerFlags, ocspServerMain}
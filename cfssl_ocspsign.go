@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+)
+
+// Usage text of 'cfssl ocspsign'
+var ocspSignerUsageText = `cfssl ocspsign -- signs an OCSP response for a given CA, cert, and status.
+Returns a base64-encoded OCSP response.
+
+Usage of ocspsign:
+        cfssl ocspsign [-ca cert] [-ca-key key] [-responder cert -responder-key key] \
+                       [-status status] [-reason code] [-revoked-at YYYY-MM-DD] [-interval duration] CERT
+        cfssl ocspsign [-ca cert] [-ca-key key] [-responder cert -responder-key key] \
+                       -db-config config [-interval duration] CERT
+
+Arguments:
+        CERT:       Certificate whose status is being reported.
+
+Note: CERT can also be supplied as flag value. But flag value will take precedence, overwriting the argument.
+If no responder certificate is given, the response is signed with the CA key.
+With -db-config, the status, reason and revocation time are those recorded for CERT in the certificate database.
+
+Flags:
+`
+
+// Flags of 'cfssl ocspsign'
+var ocspSignerFlags = []string{"ca", "ca-key", "responder", "responder-key", "key-password", "cert", "status", "reason", "revoked-at", "interval", "db-config"}
+
+// ocspResponderFiles returns the certificate and key that should sign
+// OCSP responses: the delegated responder if one is configured, and
+// the CA otherwise.
+func ocspResponderFiles() (responderFile, keyFile string) {
+	if Config.responderFile == "" {
+		return "", Config.caKeyFile
+	}
+	return Config.responderFile, Config.responderKeyFile
+}
+
+// ocspSignerMain is the main CLI of OCSP signer functionality.
+func ocspSignerMain(args []string) (err error) {
+	if Config.certFile == "" {
+		Config.certFile, args, err = popFirstArgument(args)
+		if err != nil {
+			return
+		}
+	}
+
+	log.Debug("Loading certificate: ", Config.certFile)
+	certPEM, err := readStdin(Config.certFile)
+	if err != nil {
+		return
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return
+	}
+
+	req := ocsp.SignRequest{
+		Certificate: cert,
+		Status:      Config.status,
+	}
+
+	if Config.dbConfig != "" {
+		db, err := dbconf.DBFromConfig(Config.dbConfig)
+		if err != nil {
+			return err
+		}
+		if req, err = ocsp.NewSignRequestFromDB(db, cert); err != nil {
+			return err
+		}
+	} else if Config.status == "revoked" {
+		req.Reason, err = ocsp.ReasonStringToCode(Config.reason)
+		if err != nil {
+			return
+		}
+
+		if Config.revokedAt == "now" {
+			req.RevokedAt = time.Now()
+		} else {
+			req.RevokedAt, err = time.Parse("2006-01-02", Config.revokedAt)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	responderFile, keyFile := ocspResponderFiles()
+	s, err := ocsp.NewSignerFromFile(Config.caFile, responderFile, keyFile, Config.interval)
+	if err != nil {
+		return
+	}
+
+	resp, err := s.Sign(req)
+	if err != nil {
+		return
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(resp))
+	return
+}
+
+// CLIOCSPSigner assembles the definition of Command 'ocspsign'
+var CLIOCSPSigner = &Command{ocspSignerUsageText, ocspSignerFlags, ocspSignerMain}
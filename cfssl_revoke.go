@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/revoke"
+)
+
+// Usage text of 'cfssl revoke'
+var revokeUsageText = `cfssl revoke -- revokes a certificate in the certificate database
+
+Usage of revoke:
+        cfssl revoke -db-config config -serial serial [-aki aki] [-reason reason]
+
+The serial number is given in decimal, or in hexadecimal with a "0x" prefix.
+The AKI may be omitted if no other certificate in the database has the same serial number.
+The reason is an RFC 5280 reason, given by name (e.g. keycompromise) or code; it defaults to unspecified.
+
+Flags:
+`
+
+// Flags of 'cfssl revoke'
+var revokeFlags = []string{"db-config", "serial", "aki", "reason"}
+
+// revokeMain is the main CLI of certificate revocation functionality.
+func revokeMain(args []string) error {
+	if len(args) > 0 {
+		return errors.New("Arguments is provided but not defined. Please refer to the usage by flag -h.")
+	}
+	if Config.dbConfig == "" {
+		return errors.New("no certificate database provided, please set the -db-config flag")
+	}
+	if Config.serial == "" {
+		return errors.New("no serial number provided, please set the -serial flag")
+	}
+
+	db, err := dbconf.DBFromConfig(Config.dbConfig)
+	if err != nil {
+		return err
+	}
+
+	if err = revoke.Revoke(db, Config.serial, Config.aki, Config.reason); err != nil {
+		return err
+	}
+	log.Info("certificate revoked")
+	return nil
+}
+
+// CLIRevoke assembles the definition of Command 'revoke'
+var CLIRevoke = &Command{revokeUsageText, revokeFlags, revokeMain}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/cloudflare/cfssl/api"
 	"github.com/cloudflare/cfssl/bundler"
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer/remote"
+	"github.com/cloudflare/cfssl/signer/universal"
 	"github.com/cloudflare/cfssl/ubiquity"
 )
 
@@ -16,22 +23,83 @@ var serverUsageText = `cfssl serve -- set up a HTTP server handles CF SSL reques
 
 Usage of serve:
         cfssl serve [-address address] [-ca cert] [-ca-bundle bundle] \
-                    [-ca-key key] [-int-bundle bundle] [-port port] [-metadata file]
+                    [-ca-key key] [-int-bundle bundle] [-port port] [-metadata file] \
+                    [-responder cert] [-responder-key key] [-interval duration] \
+                    [-crl-expiry duration] [-db-config file] \
+                    [-tls-cert cert -tls-key key [-mutual-tls-ca file]]
 
 Flags:
 `
 
 // Flags used by 'cfssl serve'
-var serverFlags = []string{"address", "port", "ca", "ca-key", "ca-bundle", "int-bundle", "int-dir", "metadata", "remote", "f"}
+var serverFlags = []string{"address", "port", "ca", "ca-key", "key-password", "ca-bundle", "int-bundle", "int-dir", "metadata", "remote", "responder", "responder-key", "interval", "crl-expiry", "db-config", "f",
+	"tls-cert", "tls-key", "mutual-tls-ca", "tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key"}
 
 // registerHandlers instantiates various handlers and assoicate them to corresponding endpoints.
 func registerHandlers() error {
+	var db certdb.Accessor
+	if Config.dbConfig != "" {
+		log.Info("Opening certificate database")
+		var err error
+		if db, err = dbconf.DBFromConfig(Config.dbConfig); err != nil {
+			log.Errorf("Failed to open certificate database: %v", err)
+			return err
+		}
+	}
+
+	var policy *config.Signing
+	if Config.cfg != nil {
+		policy = Config.cfg.Signing
+	}
+
+	tlsConfig, err := remoteTLSConfig()
+	if err != nil {
+		log.Errorf("Failed to set up remote TLS configuration: %v", err)
+		return err
+	}
+
 	log.Info("Setting up signer endpoint")
-	signHandler, err := api.NewSignHandler(Config.caFile, Config.caKeyFile)
+	s, err := universal.NewSigner(policy, Config.caFile, Config.caKeyFile, tlsConfig)
+	if err != nil {
+		log.Warningf("endpoints '/api/v1/cfssl/sign' and '/api/v1/cfssl/authsign' are disabled: %v", err)
+	} else {
+		s.SetDBAccessor(db)
+		http.Handle("/api/v1/cfssl/sign", api.NewSignHandlerFromSigner(s))
+		http.Handle("/api/v1/cfssl/authsign", api.NewAuthSignHandlerFromSigner(s))
+	}
+
+	log.Info("Setting up OCSP signer endpoint")
+	responderFile, responderKeyFile := ocspResponderFiles()
+	ocspSignHandler, err := api.NewOCSPSignHandler(Config.caFile, responderFile, responderKeyFile, Config.interval, db)
+	if err == nil {
+		ocspSignHandler, err = adminHandler(ocspSignHandler)
+	}
+	if err != nil {
+		log.Warningf("endpoint '/api/v1/cfssl/ocspsign' is disabled: %v", err)
+	} else {
+		http.Handle("/api/v1/cfssl/ocspsign", ocspSignHandler)
+	}
+
+	log.Info("Setting up CRL endpoint")
+	crlHandler, err := api.NewCRLHandler(Config.caFile, Config.caKeyFile, Config.crlExpiry, db)
+	if err == nil {
+		crlHandler, err = adminHandler(crlHandler)
+	}
+	if err != nil {
+		log.Warningf("endpoint '/api/v1/cfssl/crl' is disabled: %v", err)
+	} else {
+		http.Handle("/api/v1/cfssl/crl", crlHandler)
+	}
+
+	log.Info("Setting up revocation endpoint")
+	revokeHandler, err := api.NewRevokeHandler(db)
+	if err == nil {
+		revokeHandler, err = adminHandler(revokeHandler)
+	}
 	if err != nil {
-		log.Warningf("endpoint '/api/v1/cfssl/sign' is disabled: %v", err)
+		log.Warningf("endpoint '/api/v1/cfssl/revoke' is disabled: %v", err)
 	} else {
-		http.Handle("/api/v1/cfssl/sign", signHandler)
+		http.Handle("/api/v1/cfssl/revoke", revokeHandler)
 	}
 
 	log.Info("Setting up bundler endpoint")
@@ -51,31 +119,46 @@ func registerHandlers() error {
 	http.Handle("/api/v1/cfssl/newkey", generatorHandler)
 
 	log.Info("Setting up new cert endpoint")
-	newCertGenerator, err := api.NewCertGeneratorHandler(api.CSRValidate,
-		Config.caFile, Config.caKeyFile)
-	if err != nil {
+	if s == nil {
 		log.Errorf("endpoint '/api/v1/cfssl/newcert' is disabled")
 	} else {
-		http.Handle("/api/v1/cfssl/newcert", newCertGenerator)
+		http.Handle("/api/v1/cfssl/newcert", api.NewCertGeneratorHandlerFromSigner(api.CSRValidate, s))
 	}
 
 	log.Info("Setting up initial CA endpoint")
 	http.Handle("/api/v1/cfssl/init_ca", api.NewInitCAHandler())
 
+	log.Info("Setting up intermediate CA endpoint")
+	if s == nil {
+		log.Errorf("endpoint '/api/v1/cfssl/newintermediate' is disabled")
+	} else {
+		http.Handle("/api/v1/cfssl/newintermediate", api.NewIntermediateCAHandlerFromSigner(s))
+	}
+
 	if Config.remote != "" {
 		log.Info("Remote CFSSL endpoint given, setting up remote certificate generator")
-		if rcg, err := api.NewRemoteCertGenerator(api.CSRValidate, Config.remote); err != nil {
+		rs, err := remote.NewSignerTLS(policy, Config.remote, tlsConfig)
+		if err != nil {
 			log.Errorf("Failed to set up remote certificate generator: %v", err)
 			return err
-		} else {
-			http.Handle("/api/v1/cfssl/remotecert", rcg)
 		}
+		http.Handle("/api/v1/cfssl/remotecert", api.NewCertGeneratorHandlerFromSigner(api.CSRValidate, rs))
 	}
 
 	log.Info("Handler set up complete.")
 	return nil
 }
 
+// adminHandler restricts the administrative endpoint served by h to
+// the requests allowed by the admin policy of the config. Without an
+// admin policy, the endpoint is not served.
+func adminHandler(h http.Handler) (http.Handler, error) {
+	if Config.cfg == nil || Config.cfg.Admin == nil {
+		return nil, errors.New("no admin policy in the config")
+	}
+	return api.NewAdminHandler(h, Config.cfg.Admin)
+}
+
 // serverMain is the command line entry point to the API server. It sets up a
 // new HTTP server to handle sign, bundle, and validate requests.
 func serverMain(args []string) error {
@@ -93,8 +176,25 @@ func serverMain(args []string) error {
 	}
 
 	addr := fmt.Sprintf("%s:%d", Config.address, Config.port)
-	log.Info("Now listening on ", addr)
-	return http.ListenAndServe(addr, nil)
+	if Config.tlsCertFile == "" && Config.tlsKeyFile == "" {
+		if Config.mutualTLSCAFile != "" {
+			return errors.New("-mutual-tls-ca requires -tls-cert and -tls-key")
+		}
+		log.Info("Now listening on ", addr)
+		return http.ListenAndServe(addr, nil)
+	}
+
+	server := &http.Server{Addr: addr, TLSConfig: &tls.Config{}}
+	if Config.mutualTLSCAFile != "" {
+		pool, err := helpers.LoadPEMCertPool(Config.mutualTLSCAFile)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig.ClientCAs = pool
+		server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	log.Info("Now listening on https://", addr)
+	return server.ListenAndServeTLS(Config.tlsCertFile, Config.tlsKeyFile)
 }
 
 // CLIServer assembles the definition of Command 'serve'
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/remote"
+	"github.com/cloudflare/cfssl/signer/universal"
 )
 
 // Usage text of 'cfssl sign'
@@ -14,10 +19,13 @@ var signerUsageText = `cfssl sign -- signs a client cert with a host name by a g
 
 Usage of sign:
         cfssl sign [-ca cert] [-ca-key key] HOSTNAME CSR
+        cfssl sign [-remote remote_server] HOSTNAME CSR
+        cfssl sign -cross-sign [-ca cert] [-ca-key key] [-profile profile] CACERT
 
 Arguments:
-        HOSTNAME:   Hostname for the cert
+        HOSTNAME:   Comma-separated hostnames and IP addresses for the cert
         CSR:        Certificate request.
+        CACERT:     Existing CA certificate to cross-sign, keeping its subject and key.
 
 Note: HOSTNAME, CERT can also be supplied as flag value. But flag value will take precedence, overwriting the argument.
 
@@ -25,13 +33,15 @@ Flags:
 `
 
 // Flags of 'cfssl sign'
-var signerFlags = []string{"hostname", "csr", "ca", "ca-key", "f", "profile", "f"}
+var signerFlags = []string{"hostname", "csr", "remote", "ca", "ca-key", "key-password", "f", "profile", "not-before", "not-after", "cross-sign",
+	"tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key"}
 
 // signerMain is the main CLI of signer functionality.
 // [TODO: zi] Decide whether to drop the argument list and only use flags to specify all the inputs.
 func signerMain(args []string) (err error) {
-	// Grab values through args only if corresponding flags are absent
-	if Config.hostname == "" {
+	// Grab values through args only if corresponding flags are absent.
+	// A cross-signed CA certificate keeps its own names.
+	if Config.hostname == "" && !Config.crossSign {
 		Config.hostname, args, err = popFirstArgument(args)
 		if err != nil {
 			return
@@ -51,18 +61,27 @@ func signerMain(args []string) (err error) {
 		return
 	}
 
-	var policy *config.Signing
-	// If there is a config, use its signing policy. Otherwise, leave policy == nil
-	// and NewSigner will use DefaultConfig().
-	if Config.cfg != nil {
-		policy = Config.cfg.Signing
-	}
-
-	signer, err := signer.NewSigner(Config.caFile, Config.caKeyFile, policy)
+	s, err := signerFromConfig()
 	if err != nil {
 		return
 	}
-	cert, err := signer.Sign(Config.hostname, clientCert, Config.profile)
+	req := signer.SignRequest{
+		Hosts:     signer.SplitHosts(Config.hostname),
+		Request:   string(clientCert),
+		Profile:   Config.profile,
+		CrossSign: Config.crossSign,
+	}
+	if Config.notBefore != "" {
+		if req.NotBefore, err = time.Parse(time.RFC3339, Config.notBefore); err != nil {
+			return
+		}
+	}
+	if Config.notAfter != "" {
+		if req.NotAfter, err = time.Parse(time.RFC3339, Config.notAfter); err != nil {
+			return
+		}
+	}
+	cert, err := s.Sign(req)
 	if err != nil {
 		return
 	}
@@ -70,5 +89,52 @@ func signerMain(args []string) (err error) {
 	return
 }
 
+// signerFromConfig returns the signer selected by the command line:
+// a remote signer if a remote server is given, or else a signer using
+// the CA certificate and key, which forwards requests for profiles
+// naming a remote to it. If there is a config, its signing policy is
+// used; otherwise the signer uses DefaultConfig().
+func signerFromConfig() (signer.Signer, error) {
+	var policy *config.Signing
+	if Config.cfg != nil {
+		policy = Config.cfg.Signing
+	}
+
+	tlsConfig, err := remoteTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if Config.remote != "" {
+		return remote.NewSignerTLS(policy, Config.remote, tlsConfig)
+	}
+	return universal.NewSigner(policy, Config.caFile, Config.caKeyFile, tlsConfig)
+}
+
+// remoteTLSConfig returns the TLS config used to reach the remote
+// server, with the root certificates and the client certificate given
+// on the command line, or nil if none are given.
+func remoteTLSConfig() (*tls.Config, error) {
+	if Config.tlsRemoteCAFile == "" && Config.mutualTLSCertFile == "" && Config.mutualTLSKeyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if Config.tlsRemoteCAFile != "" {
+		pool, err := helpers.LoadPEMCertPool(Config.tlsRemoteCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if Config.mutualTLSCertFile != "" || Config.mutualTLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(Config.mutualTLSCertFile, Config.mutualTLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
 // CLISigner assembles the definition of Command 'sign'
 var CLISigner = &Command{signerUsageText, signerFlags, signerMain}
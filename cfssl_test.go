@@ -6,6 +6,11 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 // 'cfssl -help' should be supported.
@@ -71,6 +76,9 @@ func TestServe(t *testing.T) {
 	ts := httptest.NewServer(http.DefaultServeMux)
 	// Soft-enable endpoints should be all disabled due to empty config files.
 	urlSign := ts.URL + "/api/v1/cfssl/sign"
+	urlOCSPSign := ts.URL + "/api/v1/cfssl/ocspsign"
+	urlCRL := ts.URL + "/api/v1/cfssl/crl"
+	urlRevoke := ts.URL + "/api/v1/cfssl/revoke"
 	urlBundle := ts.URL + "/api/v1/cfssl/bundle"
 	urlInitCA := ts.URL + "/api/v1/cfssl/init_ca"
 	urlCSR := ts.URL + "/api/v1/cfssl/newkey"
@@ -81,6 +89,21 @@ func TestServe(t *testing.T) {
 		t.Fatal(resp.Status)
 	}
 
+	resp, _ = http.Get(urlOCSPSign)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal(resp.Status)
+	}
+
+	resp, _ = http.Get(urlCRL)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal(resp.Status)
+	}
+
+	resp, _ = http.Get(urlRevoke)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal(resp.Status)
+	}
+
 	resp, _ = http.Get(urlBundle)
 	if resp.StatusCode != http.StatusNotFound {
 		t.Fatal(resp.Status)
@@ -99,6 +122,63 @@ func TestServe(t *testing.T) {
 
 }
 
+// Administrative endpoints are only served with an admin policy.
+func TestAdminHandler(t *testing.T) {
+	defer func(cfg *config.Config) { Config.cfg = cfg }(Config.cfg)
+	h := http.NotFoundHandler()
+
+	Config.cfg = nil
+	if _, err := adminHandler(h); err == nil {
+		t.Fatal("Administrative endpoint served without a config.")
+	}
+	Config.cfg = &config.Config{}
+	if _, err := adminHandler(h); err == nil {
+		t.Fatal("Administrative endpoint served without an admin policy.")
+	}
+	provider, err := auth.New("000102030405060708090a0b0c0d0e0f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Config.cfg.Admin = &config.AdminPolicy{AuthKeyName: "admin", Provider: provider}
+	if _, err := adminHandler(h); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Generated keys are encrypted with the -key-out-password passphrase,
+// never with the -key-password passphrase of the CA key.
+func TestKeyOutputPassword(t *testing.T) {
+	defer func(source, out, format string) {
+		helpers.KeyPasswordSource, Config.keyOutPassword, Config.keyFormat = source, out, format
+	}(helpers.KeyPasswordSource, Config.keyOutPassword, Config.keyFormat)
+	os.Setenv("CFSSL_TEST_CA_PASSWORD", "ca passphrase")
+	os.Setenv("CFSSL_TEST_OUT_PASSWORD", "leaf passphrase")
+	defer os.Unsetenv("CFSSL_TEST_CA_PASSWORD")
+	defer os.Unsetenv("CFSSL_TEST_OUT_PASSWORD")
+
+	helpers.KeyPasswordSource = "env:CFSSL_TEST_CA_PASSWORD"
+	Config.keyOutPassword = "env:CFSSL_TEST_OUT_PASSWORD"
+	Config.keyFormat = csr.KeyFormatEncryptedPKCS8
+	kr, err := keyOutput(&csr.KeyRequest{Algo: "ecdsa", Size: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kr.Password != "leaf passphrase" {
+		t.Fatalf("Generated key encrypted with passphrase %q", kr.Password)
+	}
+
+	// Without an output passphrase, the key is not encrypted with
+	// the CA key's.
+	Config.keyOutPassword = "env:CFSSL_TEST_NO_PASSWORD"
+	kr, err = keyOutput(&csr.KeyRequest{Algo: "ecdsa", Size: 256})
+	if err == nil && kr.Password != "" {
+		t.Fatalf("Generated key encrypted with passphrase %q", kr.Password)
+	}
+	if _, _, err = csr.ParseRequest(&csr.CertificateRequest{CN: "cloudflare.com", KeyRequest: kr}); err == nil {
+		t.Fatal("Expected error encrypting a key without a passphrase")
+	}
+}
+
 // Additional routines derived from flag unit testing
 
 // ResetForTesting clears all flag state and sets the usage function as directed.
@@ -8,6 +8,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+
+	"github.com/cloudflare/cfssl/csr"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 func readFile(filespec string) ([]byte, error) {
@@ -26,8 +30,33 @@ func writeFile(filespec, contents string, perms os.FileMode) {
 	}
 }
 
+// encodeKey converts the PEM-encoded private key to the format, reading
+// the password of a key to encrypt from the password source. Keys that
+// are already encrypted are kept as they are.
+func encodeKey(keyPEM, format, passwordSource string) (string, error) {
+	priv, err := helpers.ParsePrivateKeyPEMWithPassword([]byte(keyPEM), nil)
+	if cfErr, ok := err.(*cferr.Error); ok && cfErr.ErrorCode == int(cferr.PrivateKeyError)+int(cferr.Encrypted) {
+		return keyPEM, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	kr := &csr.KeyRequest{Format: format}
+	if format == csr.KeyFormatEncryptedPKCS8 {
+		password, err := helpers.ReadNewPassword(passwordSource)
+		if err != nil {
+			return "", err
+		}
+		kr.Password = string(password)
+	}
+	key, err := kr.EncodeKey(priv)
+	return string(key), err
+}
+
 func main() {
 	inFile := flag.String("f", "-", "JSON input")
+	keyFormat := flag.String("key-format", "", "convert private keys to this format: pkcs8 or encrypted-pkcs8")
+	keyPassword := flag.String("key-out-password", helpers.DefaultKeyOutPasswordSource, "passphrase to encrypt private keys with: env:NAME, file:PATH or prompt")
 	flag.Parse()
 
 	var baseName string
@@ -56,10 +85,18 @@ func main() {
 		writeFile(baseName+".pem", contents, 0644)
 	}
 
-	if contents, ok := input["key"]; ok {
-		writeFile(baseName+"-key.pem", contents, 0600)
-	} else if contents, ok = input["private_key"]; ok {
-		writeFile(baseName+"-key.pem", contents, 0600)
+	key, ok := input["key"]
+	if !ok {
+		key, ok = input["private_key"]
+	}
+	if ok {
+		if *keyFormat != "" {
+			if key, err = encodeKey(key, *keyFormat, *keyPassword); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to convert private key: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		writeFile(baseName+"-key.pem", key, 0600)
 	}
 
 	if contents, ok := input["csr"]; ok {
@@ -71,4 +108,12 @@ func main() {
 	if contents, ok := input["bundle"]; ok {
 		writeFile(baseName+"-bundle.pem", contents, 0644)
 	}
+
+	if contents, ok := input["chain"]; ok {
+		writeFile(baseName+"-chain.pem", contents, 0644)
+	}
+
+	if contents, ok := input["cross"]; ok {
+		writeFile(baseName+"-cross.pem", contents, 0644)
+	}
 }
@@ -3,32 +3,351 @@ package config
 
 import (
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/cloudflare/cfssl/auth"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 )
 
-// A SigningProfile stores information that the CA needs to store
-// signature policy.
+// A SigningProfile stores the signature policy of the CA.
 type SigningProfile struct {
 	Usage        []string `json:"usages"`
 	IssuerURL    []string `json:"issuer_urls"`
 	OCSP         string   `json:"ocsp_url"`
 	CRL          string   `json:"crl_url"`
 	ExpiryString string   `json:"expiry"`
-	CA           bool     `json:"is_ca"`
+	// BackdateString is parsed into Backdate.
+	BackdateString string `json:"backdate"`
+	CA             bool   `json:"is_ca"`
+	// AllowCSRHosts signs a sign request that names no hosts for the
+	// subject alternative names of its certificate request.
+	AllowCSRHosts bool `json:"allow_csr_hosts"`
+	// NamePolicy restricts the names certificates may be issued for.
+	NamePolicy *NamePolicy `json:"name_policy"`
+	// MaxPathLen, if not zero, overrides the default path length of
+	// CA certificates; it only applies to CA profiles.
+	MaxPathLen int `json:"max_path_len"`
+	// PathLenZero gives CA certificates a path length of zero.
+	PathLenZero bool `json:"path_len_zero"`
+	// NameConstraints are the name constraints of CA certificates.
+	NameConstraints *NameConstraints `json:"name_constraints"`
+	// Policies are published in the certificate policies extension.
+	Policies []CertificatePolicy `json:"policies"`
+	// Extensions are added to the certificates as they are.
+	Extensions []Extension `json:"extensions"`
+	// AuthKeyName, if it names one of the config's auth keys,
+	// requires sign requests for the profile to be authenticated
+	// with that key.
+	AuthKeyName string `json:"auth_key"`
+	// AllowedClients, if set, restricts the profile to API clients
+	// presenting a verified TLS client certificate for one of these
+	// identities.
+	AllowedClients []string `json:"allowed_clients"`
+	// RemoteName, if it names one of the config's remotes, has sign
+	// requests for the profile checked locally and then forwarded to
+	// RemoteServer to be signed there.
+	RemoteName string `json:"remote"`
+	// PSS has RSA CA keys sign with RSA-PSS rather than PKCS#1 v1.5.
+	PSS bool `json:"pss"`
+	// SigAlgoString, if set, names the algorithm certificates are
+	// signed with instead of the one the CA key's size suggests.
+	SigAlgoString string `json:"signature_algorithm"`
+	// AllowWeakSig accepts weak algorithms in SigAlgoString.
+	AllowWeakSig bool `json:"allow_weak_signature_algorithm"`
 	Expiry       time.Duration
+	// Backdate is how far before the time of signing a certificate
+	// may become valid; a sign request may ask for a validity window
+	// that starts no earlier than that and ends no later than Expiry
+	// after the time of signing.
+	Backdate time.Duration
+	// Provider authenticates the sign requests of AuthKeyName; it is
+	// set up when the config is loaded.
+	Provider auth.Provider `json:"-"`
+	// RemoteServer is the comma-separated list of the addresses of
+	// RemoteName.
+	RemoteServer string `json:"-"`
 }
 
-// parse, and the ExpiryString parameter, are needed to parse
-// expiration timestamps from JSON. The JSON decoder is not able to
-// decode a string time duration to a time.Duration, so this is called
-// when loading the configuration to properly parse and fill out the
-// Expiry parameter. It returns true if there was a valid string
-// representation of a time.Duration, and false if an error occurred.
+// An OID is an ASN.1 object identifier, written in JSON as a string of
+// dot-separated numbers, such as "1.3.6.1.4.1.44947.1.1.1".
+type OID asn1.ObjectIdentifier
+
+// UnmarshalJSON parses an OID from a dot-separated string.
+func (oid *OID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid OID %q", s)
+	}
+	parsed := make(OID, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid OID %q", s)
+		}
+		parsed[i] = n
+	}
+	*oid = parsed
+	return nil
+}
+
+// MarshalJSON writes an OID as a dot-separated string.
+func (oid OID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(asn1.ObjectIdentifier(oid).String())
+}
+
+// The types of certificate policy qualifiers: a CPS pointer gives the
+// URI of a certification practice statement, and a user notice gives
+// a text to display to relying parties.
+const (
+	CPSQualifier        = "id-qt-cps"
+	UserNoticeQualifier = "id-qt-unotice"
+)
+
+// A CertificatePolicy is a certificate policy OID and its optional
+// qualifiers.
+type CertificatePolicy struct {
+	ID         OID                          `json:"id"`
+	Qualifiers []CertificatePolicyQualifier `json:"qualifiers"`
+}
+
+// A CertificatePolicyQualifier is a CPS pointer or a user notice,
+// according to its type.
+type CertificatePolicyQualifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// An Extension is an X.509 extension added to certificates as it is;
+// its value is its hex-encoded DER encoding.
+type Extension struct {
+	ID       OID    `json:"id"`
+	Critical bool   `json:"critical"`
+	Value    string `json:"value"`
+}
+
+// NameConstraints lists the names a CA certificate may issue
+// certificates for, and the names it may not. DNS constraints are
+// domains, IP constraints are CIDR ranges and email constraints are
+// mailboxes, domains or, with a leading dot, subdomains.
+type NameConstraints struct {
+	Critical                bool     `json:"critical"`
+	PermittedDNSDomains     []string `json:"permitted_dns_domains"`
+	ExcludedDNSDomains      []string `json:"excluded_dns_domains"`
+	PermittedIPRanges       []string `json:"permitted_ip_ranges"`
+	ExcludedIPRanges        []string `json:"excluded_ip_ranges"`
+	PermittedEmailAddresses []string `json:"permitted_email_addresses"`
+	ExcludedEmailAddresses  []string `json:"excluded_email_addresses"`
+}
+
+// parseIPRanges parses a list of CIDR ranges.
+func parseIPRanges(ranges []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, r := range ranges {
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Apply sets the name constraints of a CA certificate template. It
+// fails if an IP range is not a valid CIDR range.
+func (nc *NameConstraints) Apply(cert *x509.Certificate) (err error) {
+	cert.PermittedIPRanges, err = parseIPRanges(nc.PermittedIPRanges)
+	if err != nil {
+		return
+	}
+	cert.ExcludedIPRanges, err = parseIPRanges(nc.ExcludedIPRanges)
+	if err != nil {
+		return
+	}
+	cert.PermittedDNSDomainsCritical = nc.Critical
+	cert.PermittedDNSDomains = nc.PermittedDNSDomains
+	cert.ExcludedDNSDomains = nc.ExcludedDNSDomains
+	cert.PermittedEmailAddresses = nc.PermittedEmailAddresses
+	cert.ExcludedEmailAddresses = nc.ExcludedEmailAddresses
+	return
+}
+
+// A NamePolicy restricts the subject alternative names of the
+// certificates signed with a profile. A DNS name must end in one of
+// the AllowedSuffixes (the suffix itself or a subdomain of it) or
+// match the whole of one of the AllowedPatterns, which are regular
+// expressions matched regardless of case; if both lists are empty,
+// any DNS name is allowed. The domain of an email address and the host
+// of a URI are checked as DNS names. Wildcard DNS names and IP address
+// SANs are only allowed if the policy says so, and MaxSANs, if not
+// zero, limits the number of SANs of all kinds. A common name that is
+// not one of the SANs must be a DNS name the policy allows.
+type NamePolicy struct {
+	AllowedSuffixes []string `json:"allowed_suffixes"`
+	AllowedPatterns []string `json:"allowed_patterns"`
+	AllowIPs        bool     `json:"allow_ip_addresses"`
+	AllowWildcards  bool     `json:"allow_wildcards"`
+	MaxSANs         int      `json:"max_sans"`
+
+	once       sync.Once
+	patterns   []*regexp.Regexp
+	compileErr error
+}
+
+// compile compiles the allowed patterns of the policy, each of which
+// must match a whole name, in any case. The policy is compiled once, however many
+// requests check names against it concurrently.
+func (np *NamePolicy) compile() error {
+	np.once.Do(func() {
+		for _, pattern := range np.AllowedPatterns {
+			re, err := regexp.Compile("(?i)^(?:" + pattern + ")$")
+			if err != nil {
+				np.compileErr = err
+				return
+			}
+			np.patterns = append(np.patterns, re)
+		}
+		if np.MaxSANs < 0 {
+			np.compileErr = errors.New("max_sans must not be negative")
+		}
+	})
+	return np.compileErr
+}
+
+// restrictsNames reports whether the policy restricts DNS names to its
+// suffixes and patterns.
+func (np *NamePolicy) restrictsNames() bool {
+	return len(np.AllowedSuffixes) > 0 || len(np.patterns) > 0
+}
+
+// allowedName reports whether the policy allows the DNS name. Only a
+// leading "*." label is a wildcard, and only if the policy allows
+// wildcards; any other "*" is refused.
+func (np *NamePolicy) allowedName(name string) bool {
+	if strings.Contains(name, "*") {
+		if !np.AllowWildcards || !strings.HasPrefix(name, "*.") || strings.Contains(name[2:], "*") {
+			return false
+		}
+	}
+	if !np.restrictsNames() {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	for _, suffix := range np.AllowedSuffixes {
+		suffix = strings.ToLower(strings.TrimPrefix(suffix, "."))
+		if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			return true
+		}
+	}
+	for _, re := range np.patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckNames returns an error if the subject alternative names or the
+// common name of the certificate are not allowed by the policy. A nil
+// policy allows all names.
+func (np *NamePolicy) CheckNames(cert *x509.Certificate) error {
+	if np == nil {
+		return nil
+	}
+	if err := np.compile(); err != nil {
+		return err
+	}
+
+	count := len(cert.DNSNames) + len(cert.IPAddresses) + len(cert.EmailAddresses) + len(cert.URIs)
+	if np.MaxSANs > 0 && count > np.MaxSANs {
+		return fmt.Errorf("%d subject alternative names requested, at most %d allowed", count, np.MaxSANs)
+	}
+	if len(cert.IPAddresses) > 0 && !np.AllowIPs {
+		return fmt.Errorf("IP address %s not allowed", cert.IPAddresses[0])
+	}
+	for _, name := range cert.DNSNames {
+		if !np.allowedName(name) {
+			return fmt.Errorf("host name %s not allowed", name)
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if i := strings.LastIndex(email, "@"); i < 0 || !np.allowedName(email[i+1:]) {
+			return fmt.Errorf("email address %s not allowed", email)
+		}
+	}
+	for _, uri := range cert.URIs {
+		if !np.allowedURI(uri) {
+			return fmt.Errorf("URI %s not allowed", uri)
+		}
+	}
+	if cn := cert.Subject.CommonName; cn != "" && !isSAN(cert, cn) && !np.allowedName(cn) {
+		return fmt.Errorf("common name %s not allowed", cn)
+	}
+	return nil
+}
+
+// allowedURI reports whether the policy allows the URI, by its host:
+// an IP address if the policy allows them, and a DNS name otherwise.
+// A URI without a host is only allowed if the policy does not restrict
+// names.
+func (np *NamePolicy) allowedURI(uri *url.URL) bool {
+	host := uri.Hostname()
+	switch {
+	case host == "":
+		return !np.restrictsNames()
+	case net.ParseIP(host) != nil:
+		return np.AllowIPs
+	default:
+		return np.allowedName(host)
+	}
+}
+
+// isSAN reports whether the name is one of the DNS names, IP
+// addresses or email addresses of the certificate, which are checked
+// as SANs.
+func isSAN(cert *x509.Certificate, name string) bool {
+	for _, dns := range cert.DNSNames {
+		if strings.EqualFold(dns, name) {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.Equal(net.ParseIP(name)) {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if strings.EqualFold(email, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse, and the ExpiryString and BackdateString parameters, are
+// needed to parse expiration timestamps from JSON. The JSON decoder is
+// not able to decode a string time duration to a time.Duration, so
+// this is called when loading the configuration to properly parse and
+// fill out the Expiry and Backdate parameters. It returns true if
+// there was a valid string representation of the expiry, and of the
+// backdate if one is given, and false if an error occurred.
 func (p *SigningProfile) parse() bool {
 	log.Debugf("parse expiry in profile")
 	if p == nil {
@@ -43,8 +362,57 @@ func (p *SigningProfile) parse() bool {
 	} else {
 		log.Debugf("expiry is valid")
 		p.Expiry = dur
+	}
+
+	if p.BackdateString != "" {
+		dur, err := time.ParseDuration(p.BackdateString)
+		if err != nil || dur < 0 {
+			log.Debugf("failed to parse backdate: %s", p.BackdateString)
+			return false
+		}
+		log.Debugf("backdate is valid")
+		p.Backdate = dur
+	}
+	return true
+}
+
+// AllowsClient reports whether an API client presenting the verified
+// TLS client certificate may use the profile: either the profile
+// allows all clients, or the certificate's common name or one of its
+// subject alternative names is one of the allowed clients. cert is
+// nil if the client presented no certificate.
+func (p *SigningProfile) AllowsClient(cert *x509.Certificate) bool {
+	return allowsClient(p.AllowedClients, cert)
+}
+
+// allowsClient reports whether the list of allowed clients is empty or
+// names the common name or one of the subject alternative names of
+// cert.
+func allowsClient(allowedClients []string, cert *x509.Certificate) bool {
+	if len(allowedClients) == 0 {
 		return true
 	}
+	if cert == nil {
+		return false
+	}
+
+	ids := []string{cert.Subject.CommonName}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		ids = append(ids, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		ids = append(ids, ip.String())
+	}
+	for _, allowed := range allowedClients {
+		for _, id := range ids {
+			if id != "" && id == allowed {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Usages parses the list of key uses in the profile, translating them
@@ -63,10 +431,94 @@ func (p *SigningProfile) Usages() (ku x509.KeyUsage, eku []x509.ExtKeyUsage, unk
 	return
 }
 
+// signatureAlgorithms are the algorithms a profile may sign
+// certificates with, and whether each is weak.
+var signatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.SHA1WithRSA:      true,
+	x509.SHA256WithRSA:    false,
+	x509.SHA384WithRSA:    false,
+	x509.SHA512WithRSA:    false,
+	x509.SHA256WithRSAPSS: false,
+	x509.SHA384WithRSAPSS: false,
+	x509.SHA512WithRSAPSS: false,
+	x509.ECDSAWithSHA1:    true,
+	x509.ECDSAWithSHA256:  false,
+	x509.ECDSAWithSHA384:  false,
+	x509.ECDSAWithSHA512:  false,
+	x509.PureEd25519:      false,
+}
+
+// SigAlgo returns the signature algorithm named by the profile's
+// SigAlgoString, either as helpers.SignatureString or as
+// crypto/x509 writes it, such as "SHA256WithRSA" or "SHA256-RSA". It
+// returns x509.UnknownSignatureAlgorithm if the profile names none, and
+// an error if the name is unknown, or is that of a weak algorithm the
+// profile does not allow.
+func (p *SigningProfile) SigAlgo() (x509.SignatureAlgorithm, error) {
+	if p == nil || p.SigAlgoString == "" {
+		return x509.UnknownSignatureAlgorithm, nil
+	}
+	for algo, weak := range signatureAlgorithms {
+		if !strings.EqualFold(p.SigAlgoString, helpers.SignatureString(algo)) &&
+			!strings.EqualFold(p.SigAlgoString, algo.String()) {
+			continue
+		}
+		if weak && !p.AllowWeakSig {
+			return x509.UnknownSignatureAlgorithm, fmt.Errorf("weak signature algorithm %s is not allowed", p.SigAlgoString)
+		}
+		return algo, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unknown signature algorithm %s", p.SigAlgoString)
+}
+
 // A valid profile has defined at least key usages to be used, and a
 // valid default profile has defined at least a default expiration.
+// The name policy, path length, name constraints and signature
+// algorithm of any profile must be valid.
 func (p *SigningProfile) validProfile(isDefault bool) bool {
 	log.Debugf("validate profile")
+	if p.NamePolicy != nil {
+		if err := p.NamePolicy.compile(); err != nil {
+			log.Debugf("invalid profile: invalid name policy: %v", err)
+			return false
+		}
+	}
+	if p.MaxPathLen < 0 || (p.PathLenZero && p.MaxPathLen != 0) {
+		log.Debugf("invalid profile: invalid path length")
+		return false
+	}
+	if p.NameConstraints != nil {
+		if err := p.NameConstraints.Apply(&x509.Certificate{}); err != nil {
+			log.Debugf("invalid profile: invalid name constraints: %v", err)
+			return false
+		}
+	}
+	if _, err := p.SigAlgo(); err != nil {
+		log.Debugf("invalid profile: %v", err)
+		return false
+	}
+	for _, policy := range p.Policies {
+		if len(policy.ID) == 0 {
+			log.Debugf("invalid profile: policy without an OID")
+			return false
+		}
+		for _, qualifier := range policy.Qualifiers {
+			if qualifier.Type != CPSQualifier && qualifier.Type != UserNoticeQualifier {
+				log.Debugf("invalid profile: unknown policy qualifier type %s", qualifier.Type)
+				return false
+			}
+		}
+	}
+	for _, ext := range p.Extensions {
+		if len(ext.ID) == 0 {
+			log.Debugf("invalid profile: extension without an OID")
+			return false
+		}
+		if _, err := hex.DecodeString(ext.Value); err != nil {
+			log.Debugf("invalid profile: invalid extension value: %v", err)
+			return false
+		}
+	}
 	if !isDefault {
 		if len(p.Usage) == 0 {
 			log.Debugf("invalid profile: no usages specified")
@@ -89,11 +541,169 @@ func (p *SigningProfile) validProfile(isDefault bool) bool {
 type Signing struct {
 	Profiles map[string]*SigningProfile `json:"profiles"`
 	Default  *SigningProfile            `json:"default"`
+	Serial   *SerialConfig              `json:"serial"`
+}
+
+// The bounds and default of the length in octets of random serial
+// numbers. RFC 5280 allows at most 20 octets, and the CA/Browser
+// Forum requires at least 64 bits of entropy; as serial numbers must
+// be positive, one bit of each random serial number is lost.
+const (
+	MinSerialLength     = 9
+	MaxSerialLength     = 20
+	DefaultSerialLength = 16
+)
+
+// A SerialConfig chooses how serial numbers are generated. By default
+// they are random, of Length octets if it is given. If CounterFile is
+// given, serial numbers are instead taken from a counter kept in that
+// file.
+type SerialConfig struct {
+	Length      int    `json:"length"`
+	CounterFile string `json:"counter_file"`
+}
+
+// valid reports whether the serial number length is within bounds.
+func (sc *SerialConfig) valid() bool {
+	if sc == nil || sc.Length == 0 {
+		return true
+	}
+	return sc.Length >= MinSerialLength && sc.Length <= MaxSerialLength
+}
+
+// The types of auth keys.
+const (
+	StandardAuthKey = "standard"
+)
+
+// An AuthKey is a named key used to authenticate API requests. The
+// only Type is "standard", an HMAC-SHA256 key given in hex in Key; if
+// Key is "env:NAME", the key is read from the environment variable
+// NAME instead.
+type AuthKey struct {
+	Type string `json:"type"`
+	Key  string `json:"key"`
+}
+
+// provider returns the authentication provider using the key.
+func (k AuthKey) provider() (auth.Provider, error) {
+	if k.Type != StandardAuthKey {
+		return nil, fmt.Errorf("unknown auth key type %q", k.Type)
+	}
+	return auth.New(k.Key)
+}
+
+// An AdminPolicy controls access to the API endpoints that change or
+// attest to the revocation status of certificates: OCSP signing, CRL
+// generation and revocation. These endpoints are only served if the
+// config has an admin policy.
+type AdminPolicy struct {
+	// AuthKeyName, if set, names the auth key that requests must
+	// be authenticated with.
+	AuthKeyName string `json:"auth_key"`
+	// AllowedClients, if set, restricts the endpoints to API
+	// clients presenting a verified TLS client certificate for one
+	// of these identities.
+	AllowedClients []string `json:"allowed_clients"`
+	// Provider is the authentication provider of AuthKeyName, set
+	// up when the config is loaded.
+	Provider auth.Provider `json:"-"`
 }
 
-// Config stores configuration information for the CA.
+// AllowsClient reports whether an API client presenting the verified
+// TLS client certificate may use the admin endpoints. cert is nil if
+// the client presented no certificate.
+func (a *AdminPolicy) AllowsClient(cert *x509.Certificate) bool {
+	return allowsClient(a.AllowedClients, cert)
+}
+
+// Config stores configuration information for the CA. Remotes maps
+// the names of remote CFSSL servers that signing profiles may forward
+// to to their addresses, each a comma-separated list of the servers'
+// addresses.
 type Config struct {
-	Signing *Signing `json:"signing"`
+	Signing  *Signing           `json:"signing"`
+	AuthKeys map[string]AuthKey `json:"auth_keys"`
+	Remotes  map[string]string  `json:"remotes"`
+	Admin    *AdminPolicy       `json:"admin"`
+}
+
+// loadAuthKeys sets up the authentication provider of every profile
+// and of the admin policy that names an auth key. It returns false if
+// a profile or the admin policy names an unknown key, if a key is
+// invalid, or if the admin policy neither names a key nor restricts
+// the allowed clients.
+func (c *Config) loadAuthKeys() bool {
+	providers := map[string]auth.Provider{}
+	for name, key := range c.AuthKeys {
+		provider, err := key.provider()
+		if err != nil {
+			log.Debugf("invalid auth key %s: %v", name, err)
+			return false
+		}
+		providers[name] = provider
+	}
+
+	profiles := []*SigningProfile{c.Signing.Default}
+	for _, p := range c.Signing.Profiles {
+		profiles = append(profiles, p)
+	}
+	for _, p := range profiles {
+		if p.AuthKeyName == "" {
+			continue
+		}
+		provider, ok := providers[p.AuthKeyName]
+		if !ok {
+			log.Debugf("unknown auth key %s", p.AuthKeyName)
+			return false
+		}
+		p.Provider = provider
+	}
+
+	if c.Admin != nil {
+		if c.Admin.AuthKeyName == "" && len(c.Admin.AllowedClients) == 0 {
+			log.Debugf("admin policy has neither an auth key nor allowed clients")
+			return false
+		}
+		if c.Admin.AuthKeyName != "" {
+			provider, ok := providers[c.Admin.AuthKeyName]
+			if !ok {
+				log.Debugf("unknown auth key %s", c.Admin.AuthKeyName)
+				return false
+			}
+			c.Admin.Provider = provider
+		}
+	}
+	return true
+}
+
+// loadRemotes sets the remote server of every profile that names a
+// remote. It returns false if a profile names an unknown remote, or if
+// a remote has no address.
+func (c *Config) loadRemotes() bool {
+	for name, addrs := range c.Remotes {
+		if strings.TrimSpace(strings.Replace(addrs, ",", "", -1)) == "" {
+			log.Debugf("remote %s has no address", name)
+			return false
+		}
+	}
+
+	profiles := []*SigningProfile{c.Signing.Default}
+	for _, p := range c.Signing.Profiles {
+		profiles = append(profiles, p)
+	}
+	for _, p := range profiles {
+		if p.RemoteName == "" {
+			continue
+		}
+		addrs, ok := c.Remotes[p.RemoteName]
+		if !ok {
+			log.Debugf("unknown remote %s", p.RemoteName)
+			return false
+		}
+		p.RemoteServer = addrs
+	}
+	return true
 }
 
 // Valid ensures that Config is a valid configuration. It should be
@@ -102,9 +712,25 @@ func (c *Config) Valid() bool {
 	return c.Signing.Valid()
 }
 
+// Profile returns the named signing profile, or the default profile if
+// there is no profile of that name.
+func (s *Signing) Profile(name string) *SigningProfile {
+	if s == nil {
+		return nil
+	}
+	if p := s.Profiles[name]; p != nil {
+		return p
+	}
+	return s.Default
+}
+
 // Signing specifically validates the signature policies.
 func (s *Signing) Valid() bool {
 	log.Debugf("validating configuration")
+	if !s.Serial.valid() {
+		log.Debugf("invalid serial number length")
+		return false
+	}
 	if !s.Default.validProfile(true) {
 		log.Debugf("default profile is invalid")
 		return false
@@ -202,6 +828,10 @@ func LoadFile(path string) *Config {
 		}
 	}
 
+	if !cfg.loadAuthKeys() || !cfg.loadRemotes() {
+		return nil
+	}
+
 	log.Debugf("configuration ok")
 	return cfg
 }
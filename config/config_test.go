@@ -1,8 +1,13 @@
 package config
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"testing"
 	"time"
 )
@@ -148,7 +153,13 @@ func TestParse(t *testing.T) {
 }
 
 func TestLoadFile(t *testing.T) {
-	validConfigFiles := []string{"testdata/valid_config.json", "testdata/valid_config_no_default.json"}
+	validConfigFiles := []string{"testdata/valid_config.json", "testdata/valid_config_no_default.json",
+		"testdata/valid_name_policy.json",
+		"testdata/valid_policies.json",
+		"testdata/valid_serial.json",
+		"testdata/valid_backdate.json",
+		"testdata/valid_auth_keys.json",
+		"testdata/valid_admin.json"}
 	for _, configFile := range validConfigFiles {
 		config := LoadFile(configFile)
 		if config == nil {
@@ -162,7 +173,18 @@ func TestLoadInvalidConfigFile(t *testing.T) {
 		"testdata/invalid_default.json",
 		"testdata/invalid_profiles.json",
 		"testdata/invalid_usage.json",
-		"testdata/invalid_config.json"}
+		"testdata/invalid_config.json",
+		"testdata/invalid_name_policy.json",
+		"testdata/invalid_policy_oid.json",
+		"testdata/invalid_policy_qualifier.json",
+		"testdata/invalid_extension.json",
+		"testdata/invalid_serial.json",
+		"testdata/invalid_backdate.json",
+		"testdata/invalid_auth_key_name.json",
+		"testdata/invalid_auth_key.json",
+		"testdata/invalid_remote_name.json",
+		"testdata/invalid_admin.json",
+		"testdata/invalid_admin_auth_key.json"}
 	for _, configFile := range invalidConfigFiles {
 		config := LoadFile(configFile)
 		if config != nil {
@@ -170,3 +192,288 @@ func TestLoadInvalidConfigFile(t *testing.T) {
 		}
 	}
 }
+
+func TestBackdate(t *testing.T) {
+	config := LoadFile("testdata/valid_backdate.json")
+	if config == nil {
+		t.Fatal("Load valid config failed.")
+	}
+	if config.Signing.Default.Backdate != time.Hour {
+		t.Fatalf("Unexpected default backdate %v", config.Signing.Default.Backdate)
+	}
+	if config.Signing.Profiles["migration"].Backdate != 8760*time.Hour {
+		t.Fatalf("Unexpected profile backdate %v", config.Signing.Profiles["migration"].Backdate)
+	}
+}
+
+func TestAuthKeys(t *testing.T) {
+	config := LoadFile("testdata/valid_auth_keys.json")
+	if config == nil {
+		t.Fatal("Load valid config failed.")
+	}
+	if config.Signing.Profile("server").Provider == nil {
+		t.Fatal("No authentication provider for a profile with an auth key.")
+	}
+	if config.Signing.Profile("").Provider != nil {
+		t.Fatal("Authentication provider for a profile without an auth key.")
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	config := LoadFile("testdata/valid_admin.json")
+	if config == nil {
+		t.Fatal("Load valid config failed.")
+	}
+	if config.Admin.Provider == nil {
+		t.Fatal("No authentication provider for an admin policy with an auth key.")
+	}
+
+	cert := &x509.Certificate{DNSNames: []string{"ops.example.com"}}
+	if !config.Admin.AllowsClient(cert) {
+		t.Fatal("Allowed admin client refused.")
+	}
+	if config.Admin.AllowsClient(nil) {
+		t.Fatal("Admin client without a certificate allowed.")
+	}
+}
+
+func TestRemotes(t *testing.T) {
+	config := LoadFile("testdata/valid_remotes.json")
+	if config == nil {
+		t.Fatal("Load valid config failed.")
+	}
+	if remote := config.Signing.Profile("server").RemoteServer; remote != "ca1.example.com:8888,ca2.example.com:8888" {
+		t.Fatalf("Unexpected remote server %q for a profile naming a remote.", remote)
+	}
+	if config.Signing.Profile("").RemoteServer != "" {
+		t.Fatal("Remote server for a profile without a remote.")
+	}
+}
+
+func TestAllowsClient(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "issuer-1"},
+		DNSNames: []string{"issuer-1.example.com"},
+	}
+
+	p := &SigningProfile{}
+	if !p.AllowsClient(nil) || !p.AllowsClient(cert) {
+		t.Fatal("A profile without allowed clients should allow all clients.")
+	}
+
+	p.AllowedClients = []string{"issuer-2", "issuer-1.example.com"}
+	if !p.AllowsClient(cert) {
+		t.Fatal("Allowed client refused.")
+	}
+	if p.AllowsClient(nil) {
+		t.Fatal("Client without a certificate allowed.")
+	}
+	p.AllowedClients = []string{"issuer-2"}
+	if p.AllowsClient(cert) {
+		t.Fatal("Client that is not allowed accepted.")
+	}
+}
+
+func TestNamePolicy(t *testing.T) {
+	config := LoadFile("testdata/valid_name_policy.json")
+	if config == nil {
+		t.Fatal("Load valid config failed.")
+	}
+	np := config.Signing.Profiles["server"].NamePolicy
+
+	allowed := []*x509.Certificate{
+		{DNSNames: []string{"example.com", "www.example.com", "WWW.EXAMPLE.COM"}},
+		{DNSNames: []string{"db-1.internal"}},
+		{IPAddresses: []net.IP{net.ParseIP("10.0.0.5")}},
+		{EmailAddresses: []string{"admin@example.com"}},
+		{URIs: []*url.URL{mustParseURL(t, "spiffe://db-1.internal/service")}},
+		{URIs: []*url.URL{mustParseURL(t, "https://10.0.0.5/")}},
+	}
+	allowed = append(allowed,
+		&x509.Certificate{Subject: pkix.Name{CommonName: "www.example.com"}, DNSNames: []string{"example.com"}},
+		&x509.Certificate{Subject: pkix.Name{CommonName: "10.0.0.5"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.5")}},
+	)
+	for _, cert := range allowed {
+		if err := np.CheckNames(cert); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	disallowed := []*x509.Certificate{
+		{DNSNames: []string{"cloudflare.com"}},
+		{DNSNames: []string{"badexample.com"}},
+		{DNSNames: []string{"db.1.internal"}},
+		{DNSNames: []string{"*.example.com"}},
+		{DNSNames: []string{"*foo.example.com"}},
+		{DNSNames: []string{"a.*.example.com"}},
+		{EmailAddresses: []string{"admin@cloudflare.com"}},
+		{EmailAddresses: []string{"admin"}},
+		{URIs: []*url.URL{mustParseURL(t, "spiffe://anything/service")}},
+		{URIs: []*url.URL{mustParseURL(t, "urn:uuid:6e8bc430-9c3a-11d9-9669-0800200c9a66")}},
+		{Subject: pkix.Name{CommonName: "evil.com"}, DNSNames: []string{"example.com"}},
+		{Subject: pkix.Name{CommonName: "*.example.com"}, DNSNames: []string{"www.example.com"}},
+		{DNSNames: []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com",
+			"e.example.com", "f.example.com", "g.example.com", "h.example.com", "i.example.com",
+			"j.example.com", "k.example.com"}},
+	}
+	for _, cert := range disallowed {
+		if err := np.CheckNames(cert); err == nil {
+			t.Fatal("Name policy allowed", cert.DNSNames, cert.EmailAddresses, cert.URIs)
+		}
+	}
+
+	np = &NamePolicy{AllowWildcards: true}
+	if err := np.CheckNames(&x509.Certificate{DNSNames: []string{"*.cloudflare.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := np.CheckNames(&x509.Certificate{IPAddresses: []net.IP{net.ParseIP("::1")}}); err == nil {
+		t.Fatal("Name policy allowed an IP address.")
+	}
+	for _, name := range []string{"a.*.cloudflare.com", "*foo.cloudflare.com", "*.*.cloudflare.com"} {
+		if err := np.CheckNames(&x509.Certificate{DNSNames: []string{name}}); err == nil {
+			t.Fatal("Name policy allowed", name)
+		}
+	}
+
+	// Without suffixes or patterns, URIs need no host.
+	if err := np.CheckNames(&x509.Certificate{URIs: []*url.URL{mustParseURL(t, "urn:example:service")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Patterns match names in any case.
+	np = &NamePolicy{AllowedPatterns: []string{"DB-[0-9]+\\.Internal"}}
+	for _, name := range []string{"db-1.internal", "DB-1.INTERNAL"} {
+		if err := np.CheckNames(&x509.Certificate{DNSNames: []string{name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	np = nil
+	if err := np.CheckNames(&x509.Certificate{DNSNames: []string{"*.cloudflare.com"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// A policy that was not loaded from a file is compiled once, however
+// many requests check names against it.
+func TestNamePolicyConcurrent(t *testing.T) {
+	np := &NamePolicy{AllowedPatterns: []string{"db-[0-9]+\\.internal"}}
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- np.CheckNames(&x509.Certificate{DNSNames: []string{"db-1.internal"}})
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(np.patterns) != 1 {
+		t.Fatalf("Expected 1 compiled pattern, got %d", len(np.patterns))
+	}
+}
+
+func TestPathLenAndNameConstraints(t *testing.T) {
+	valid := &SigningProfile{
+		Usage:      []string{"cert sign"},
+		CA:         true,
+		MaxPathLen: 1,
+		NameConstraints: &NameConstraints{
+			PermittedDNSDomains: []string{"example.com"},
+			PermittedIPRanges:   []string{"10.0.0.0/8"},
+		},
+	}
+	if !valid.validProfile(false) {
+		t.Fatal("valid profile is not valid")
+	}
+
+	invalid := []*SigningProfile{
+		{Usage: []string{"cert sign"}, CA: true, MaxPathLen: -1},
+		{Usage: []string{"cert sign"}, CA: true, MaxPathLen: 1, PathLenZero: true},
+		{Usage: []string{"cert sign"}, CA: true, NameConstraints: &NameConstraints{ExcludedIPRanges: []string{"10.0.0.0"}}},
+	}
+	for _, p := range invalid {
+		if p.validProfile(false) {
+			t.Fatalf("invalid profile accepted as valid: %+v", p)
+		}
+	}
+
+	cert := &x509.Certificate{}
+	if err := valid.NameConstraints.Apply(cert); err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.PermittedDNSDomains) != 1 || len(cert.PermittedIPRanges) != 1 || cert.PermittedIPRanges[0].String() != "10.0.0.0/8" {
+		t.Fatalf("Unexpected name constraints %v %v", cert.PermittedDNSDomains, cert.PermittedIPRanges)
+	}
+}
+
+func TestSigAlgo(t *testing.T) {
+	for name, algo := range map[string]x509.SignatureAlgorithm{
+		"":                 x509.UnknownSignatureAlgorithm,
+		"SHA256WithRSA":    x509.SHA256WithRSA,
+		"sha256withrsa":    x509.SHA256WithRSA,
+		"SHA384-RSA":       x509.SHA384WithRSA,
+		"SHA512WithRSAPSS": x509.SHA512WithRSAPSS,
+		"ECDSAWithSHA256":  x509.ECDSAWithSHA256,
+		"Ed25519":          x509.PureEd25519,
+	} {
+		p := &SigningProfile{Usage: []string{"server auth"}, SigAlgoString: name}
+		if sigAlgo, err := p.SigAlgo(); err != nil || sigAlgo != algo {
+			t.Fatalf("Expected %v for signature algorithm %q, got %v, %v", algo, name, sigAlgo, err)
+		}
+		if !p.validProfile(false) {
+			t.Fatalf("Profile with signature algorithm %q is not valid", name)
+		}
+	}
+
+	for _, name := range []string{"SHA1WithRSA", "ECDSA-SHA1", "MD5WithRSA", "DSAWithSHA256", "SHA3WithRSA"} {
+		p := &SigningProfile{Usage: []string{"server auth"}, SigAlgoString: name}
+		if _, err := p.SigAlgo(); err == nil {
+			t.Fatalf("Expected error for signature algorithm %q", name)
+		}
+		if p.validProfile(false) {
+			t.Fatalf("Profile with signature algorithm %q accepted as valid", name)
+		}
+	}
+
+	p := &SigningProfile{Usage: []string{"server auth"}, SigAlgoString: "SHA1WithRSA", AllowWeakSig: true}
+	if sigAlgo, err := p.SigAlgo(); err != nil || sigAlgo != x509.SHA1WithRSA {
+		t.Fatalf("Expected SHA1WithRSA for an allowed weak algorithm, got %v, %v", sigAlgo, err)
+	}
+	p = &SigningProfile{Usage: []string{"server auth"}, SigAlgoString: "MD5WithRSA", AllowWeakSig: true}
+	if _, err := p.SigAlgo(); err == nil {
+		t.Fatal("Expected error for MD5WithRSA, which is never allowed")
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	config := LoadFile("testdata/valid_policies.json")
+	if config == nil {
+		t.Fatal("Load valid config failed.")
+	}
+	profile := config.Signing.Profiles["server"]
+	if len(profile.Policies) != 2 || len(profile.Extensions) != 1 {
+		t.Fatalf("Unexpected policies %+v and extensions %+v", profile.Policies, profile.Extensions)
+	}
+	policy := profile.Policies[1]
+	if asn1.ObjectIdentifier(policy.ID).String() != "1.3.6.1.4.1.44947.1.1.1" || len(policy.Qualifiers) != 2 {
+		t.Fatalf("Unexpected policy %+v", policy)
+	}
+
+	bytes, err := json.Marshal(policy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes) != `"1.3.6.1.4.1.44947.1.1.1"` {
+		t.Fatalf("Unexpected OID encoding %s", bytes)
+	}
+}
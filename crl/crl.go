@@ -0,0 +1,197 @@
+// Package crl implements certificate revocation list generation for
+// CF-SSL. CRLs are signed by the issuing CA and list the serial
+// numbers of the certificates it has revoked.
+package crl
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// A RevokedCertificate identifies a revoked certificate by its serial
+// number, given in decimal or as hexadecimal with a "0x" prefix. The
+// revocation time is either an RFC 3339 timestamp or a date in the
+// form YYYY-MM-DD, and defaults to the time the CRL is signed. The
+// reason is an RFC 5280 reason, given by name or by code.
+type RevokedCertificate struct {
+	Serial    string `json:"serial"`
+	RevokedAt string `json:"revoked_at"`
+	Reason    string `json:"reason"`
+}
+
+// entry converts a RevokedCertificate to an entry in the revoked
+// certificates list of a CRL.
+func (rc RevokedCertificate) entry(now time.Time) (entry x509.RevocationListEntry, err error) {
+	serial, ok := new(big.Int).SetString(rc.Serial, 0)
+	if !ok || serial.Sign() <= 0 {
+		return entry, errors.New("invalid serial number " + rc.Serial)
+	}
+	entry.SerialNumber = serial
+
+	switch rc.RevokedAt {
+	case "", "now":
+		entry.RevocationTime = now
+	default:
+		entry.RevocationTime, err = time.Parse(time.RFC3339, rc.RevokedAt)
+		if err != nil {
+			entry.RevocationTime, err = time.Parse("2006-01-02", rc.RevokedAt)
+		}
+		if err != nil {
+			return entry, errors.New("invalid revocation time " + rc.RevokedAt)
+		}
+	}
+
+	entry.ReasonCode, err = ocsp.ReasonStringToCode(rc.Reason)
+	return entry, err
+}
+
+// ParseRevokedCertificates parses a JSON list of revoked
+// certificates, as read by 'cfssl gencrl'.
+func ParseRevokedCertificates(data []byte) ([]RevokedCertificate, error) {
+	var revoked []RevokedCertificate
+	if err := json.Unmarshal(data, &revoked); err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// A Signer produces CRLs for the certificates issued by a CA.
+type Signer struct {
+	issuer  *x509.Certificate
+	key     crypto.Signer
+	sigAlgo x509.SignatureAlgorithm
+	expiry  time.Duration
+}
+
+// NewSignerFromFile reads the CA's certificate and private key from
+// PEM-encoded files and returns a new Signer. Each CRL it signs is
+// valid for the given expiry.
+func NewSignerFromFile(caFile, caKeyFile string, expiry time.Duration) (*Signer, error) {
+	log.Debug("Loading CA: ", caFile)
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.ReadFailed, err)
+	}
+	ca, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("Loading CA key: ", caKeyFile)
+	keyPEM, err := ioutil.ReadFile(caKeyFile)
+	if err != nil {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.ReadFailed, err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigner(ca, key, expiry)
+}
+
+// NewSigner returns a new Signer for CRLs issued by the CA with the
+// given certificate and private key. The CA certificate must be
+// allowed to sign CRLs.
+func NewSigner(ca *x509.Certificate, key interface{}, expiry time.Duration) (*Signer, error) {
+	priv, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC, nil)
+	}
+	if pub, ok := priv.Public().(interface {
+		Equal(crypto.PublicKey) bool
+	}); !ok || !pub.Equal(ca.PublicKey) {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.KeyMismatch, nil)
+	}
+	if ca.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return nil, cferr.New(cferr.CertificateError, cferr.BadRequest,
+			errors.New("CA certificate is not allowed to sign CRLs"))
+	}
+	if expiry <= 0 {
+		return nil, cferr.New(cferr.CertificateError, cferr.BadRequest,
+			errors.New("CRL expiry must be positive"))
+	}
+
+	return &Signer{
+		issuer:  ca,
+		key:     priv,
+		sigAlgo: signer.DefaultSigAlgo(key),
+		expiry:  expiry,
+	}, nil
+}
+
+// Sign builds and signs a CRL listing the revoked certificates,
+// returning the DER-encoded CRL. The CRL is valid from now until the
+// signer's expiry has elapsed; the CRL number is taken from the
+// signing time, so that later CRLs always have higher numbers.
+func (s *Signer) Sign(revoked []RevokedCertificate) ([]byte, error) {
+	now := time.Now().UTC()
+
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, rc := range revoked {
+		entry, err := rc.entry(now)
+		if err != nil {
+			return nil, cferr.New(cferr.CertificateError, cferr.BadRequest, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	template := &x509.RevocationList{
+		SignatureAlgorithm:        s.sigAlgo,
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(now.UnixNano()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(s.expiry),
+	}
+
+	crl, err := x509.CreateRevocationList(rand.Reader, template, s.issuer, s.key)
+	if err != nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.Unknown, err)
+	}
+	return crl, nil
+}
+
+// SignFromDB builds and signs a CRL listing the certificates issued
+// by the signer's CA that are revoked, and not yet expired, in the
+// certificate database.
+func (s *Signer) SignFromDB(db certdb.Accessor) ([]byte, error) {
+	records, err := db.GetRevokedAndUnexpiredCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	aki := hex.EncodeToString(s.issuer.SubjectKeyId)
+	var revoked []RevokedCertificate
+	for _, cr := range records {
+		if cr.AKI != aki {
+			continue
+		}
+		revoked = append(revoked, RevokedCertificate{
+			Serial:    cr.Serial,
+			RevokedAt: cr.RevokedAt.UTC().Format(time.RFC3339),
+			Reason:    strconv.Itoa(cr.Reason),
+		})
+	}
+	return s.Sign(revoked)
+}
+
+// EncodePEM wraps a DER-encoded CRL in a PEM block.
+func EncodePEM(crl []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})
+}
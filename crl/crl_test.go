@@ -0,0 +1,232 @@
+package crl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/file"
+	"github.com/cloudflare/cfssl/revoke"
+)
+
+const (
+	testCaFile    = "testdata/ca.pem"
+	testCaKeyFile = "testdata/ca-key.pem"
+	testCertFile  = "testdata/cert.pem"
+	expiry        = 24 * time.Hour
+)
+
+var testRevoked = []RevokedCertificate{
+	{Serial: "1234567890", RevokedAt: "2014-06-01", Reason: "keycompromise"},
+	{Serial: "0x10", RevokedAt: "2014-06-02T12:00:00Z", Reason: "4"},
+	{Serial: "17"},
+}
+
+func newTestSigner(t *testing.T) *Signer {
+	s, err := NewSignerFromFile(testCaFile, testCaKeyFile, expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNewSignerFromFileErrors(t *testing.T) {
+	if _, err := NewSignerFromFile("testdata/nonexistent", testCaKeyFile, expiry); err == nil {
+		t.Fatal("Expected error for missing CA certificate.")
+	}
+	if _, err := NewSignerFromFile(testCaFile, "testdata/nonexistent", expiry); err == nil {
+		t.Fatal("Expected error for missing CA key.")
+	}
+	if _, err := NewSignerFromFile(testCertFile, testCaKeyFile, expiry); err == nil {
+		t.Fatal("Expected error for mismatched CA key.")
+	}
+	if _, err := NewSignerFromFile(testCaFile, testCaKeyFile, 0); err == nil {
+		t.Fatal("Expected error for zero expiry.")
+	}
+}
+
+func TestParseRevokedCertificates(t *testing.T) {
+	revoked, err := ParseRevokedCertificates([]byte(`[{"serial": "1234567890", "reason": "superseded"}, {"serial": "0x10"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 2 || revoked[0].Reason != "superseded" || revoked[1].Serial != "0x10" {
+		t.Fatalf("Unexpected revoked certificates %v", revoked)
+	}
+	if _, err := ParseRevokedCertificates([]byte(`{"serial": "1"}`)); err == nil {
+		t.Fatal("Expected error for malformed list.")
+	}
+}
+
+func TestSign(t *testing.T) {
+	s := newTestSigner(t)
+	der, err := s.Sign(testRevoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = crl.CheckSignatureFrom(s.issuer); err != nil {
+		t.Fatal(err)
+	}
+	if crl.NextUpdate.Sub(crl.ThisUpdate) != expiry {
+		t.Fatalf("Wrong validity window: %v to %v", crl.ThisUpdate, crl.NextUpdate)
+	}
+
+	if len(crl.RevokedCertificateEntries) != len(testRevoked) {
+		t.Fatalf("Expected %d revoked certificates, got %d", len(testRevoked), len(crl.RevokedCertificateEntries))
+	}
+	expected := []struct {
+		serial int64
+		reason int
+		date   time.Time
+	}{
+		{1234567890, 1, time.Date(2014, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{16, 4, time.Date(2014, 6, 2, 12, 0, 0, 0, time.UTC)},
+		{17, 0, crl.ThisUpdate},
+	}
+	for i, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Int64() != expected[i].serial {
+			t.Fatalf("Entry %d: wrong serial %v", i, entry.SerialNumber)
+		}
+		if entry.ReasonCode != expected[i].reason {
+			t.Fatalf("Entry %d: wrong reason %d", i, entry.ReasonCode)
+		}
+		if !entry.RevocationTime.Equal(expected[i].date) {
+			t.Fatalf("Entry %d: wrong revocation time %v", i, entry.RevocationTime)
+		}
+	}
+
+	// The PEM encoding is accepted by the older CRL parser used
+	// by the revoke package.
+	if _, err = x509.ParseCRL(EncodePEM(der)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignErrors(t *testing.T) {
+	s := newTestSigner(t)
+	bad := [][]RevokedCertificate{
+		{{Serial: "not a serial"}},
+		{{Serial: "-1"}},
+		{{Serial: "1", RevokedAt: "yesterday"}},
+		{{Serial: "1", Reason: "7"}},
+	}
+	for _, revoked := range bad {
+		if _, err := s.Sign(revoked); err == nil {
+			t.Fatalf("Expected error signing %v", revoked)
+		}
+	}
+}
+
+func TestSignFromDB(t *testing.T) {
+	s := newTestSigner(t)
+	dir, err := ioutil.TempDir("", "cfssl-crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := file.NewAccessor(filepath.Join(dir, "certs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the unexpired certificate revoked by our CA is listed.
+	aki := hex.EncodeToString(s.issuer.SubjectKeyId)
+	notAfter := time.Now().Add(time.Hour)
+	records := []certdb.CertificateRecord{
+		{Serial: "16", AKI: aki, Status: certdb.StatusGood, Expiry: notAfter},
+		{Serial: "17", AKI: aki, Status: certdb.StatusGood, Expiry: notAfter},
+		{Serial: "18", AKI: aki, Status: certdb.StatusGood, Expiry: time.Now().Add(-time.Hour)},
+		{Serial: "19", AKI: "aa", Status: certdb.StatusGood, Expiry: notAfter},
+	}
+	for _, cr := range records {
+		if err = db.InsertCertificate(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, cr := range []certdb.CertificateRecord{records[0], records[2], records[3]} {
+		if err = db.RevokeCertificate(cr.Serial, cr.AKI, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	der, err := s.SignFromDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("Expected 1 revoked certificate, got %d", len(crl.RevokedCertificateEntries))
+	}
+	entry := crl.RevokedCertificateEntries[0]
+	if entry.SerialNumber.Int64() != 16 || entry.ReasonCode != 1 || entry.RevocationTime.After(crl.ThisUpdate) {
+		t.Fatalf("Unexpected entry %+v", entry)
+	}
+}
+
+// issueTestCertificate issues a certificate with the given serial
+// number that points to crlURL as its CRL distribution point.
+func issueTestCertificate(t *testing.T, s *Signer, serial int64, crlURL string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "crl.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		CRLDistributionPoints: []string{crlURL},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.issuer, key.Public(), s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	s := newTestSigner(t)
+	der, err := s.Sign(testRevoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(der)
+	}))
+	defer ts.Close()
+
+	revoked, ok := revoke.VerifyCertificate(issueTestCertificate(t, s, 16, ts.URL))
+	if !ok || !revoked {
+		t.Fatal("Expected certificate to be revoked by our CRL.")
+	}
+
+	revoked, ok = revoke.VerifyCertificate(issueTestCertificate(t, s, 18, ts.URL))
+	if !ok || revoked {
+		t.Fatal("Expected certificate not to be revoked by our CRL.")
+	}
+}
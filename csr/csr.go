@@ -3,15 +3,23 @@ package csr
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
 
+	"github.com/cloudflare/cfssl/config"
 	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 )
 
@@ -31,12 +39,26 @@ type Name struct {
 }
 
 // A KeyRequest contains the algorithm and key size for a new private
-// key.
+// key, and the format it is output in: by default, a PKCS#1 RSA key, an
+// SEC 1 elliptic curve key or a PKCS#8 Ed25519 key; with
+// KeyFormatPKCS8, a PKCS#8 key; and
+// with KeyFormatEncryptedPKCS8, a PKCS#8 key encrypted with Password.
 type KeyRequest struct {
-	Algo string `json:"algo"`
-	Size int    `json:"size"`
+	Algo     string `json:"algo"`
+	Size     int    `json:"size"`
+	Format   string `json:"format,omitempty"`
+	Password string `json:"password,omitempty"`
+	PSS      bool   `json:"pss,omitempty"`
 }
 
+// The formats a KeyRequest may ask for the private key to be output
+// in.
+const (
+	KeyFormatDefault        = ""
+	KeyFormatPKCS8          = "pkcs8"
+	KeyFormatEncryptedPKCS8 = "encrypted-pkcs8"
+)
+
 // The DefaultKeyRequest is used when no key request data is provided
 // in the request. This should be a safe default.
 var DefaultKeyRequest = KeyRequest{
@@ -45,7 +67,8 @@ var DefaultKeyRequest = KeyRequest{
 }
 
 // Generate generates a key as specified in the request. Currently,
-// only ECDSA and RSA are supported.
+// ECDSA, RSA and Ed25519 are supported; Ed25519 keys have a fixed
+// size, and the size of the request is ignored.
 func (kr *KeyRequest) Generate() (interface{}, error) {
 	log.Debugf("generate key from request: algo=%s, size=%d", kr.Algo, kr.Size)
 	switch kr.Algo {
@@ -67,16 +90,66 @@ func (kr *KeyRequest) Generate() (interface{}, error) {
 			return nil, errors.New("invalid curve")
 		}
 		return ecdsa.GenerateKey(curve, rand.Reader)
+	case "ed25519":
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
 	default:
 		return nil, errors.New("invalid algorithm")
 	}
 }
 
+// Check checks that the key request asks for a known output format,
+// with a password if the key is to be encrypted, and only asks for
+// RSA-PSS signatures with an RSA key.
+func (kr *KeyRequest) Check() error {
+	if kr.PSS && kr.Algo != "rsa" {
+		return errors.New("RSA-PSS signatures need an RSA key")
+	}
+	switch kr.Format {
+	case KeyFormatDefault, KeyFormatPKCS8:
+		return nil
+	case KeyFormatEncryptedPKCS8:
+		if kr.Password == "" {
+			return errors.New("no password given to encrypt the private key")
+		}
+		return nil
+	default:
+		return errors.New("unknown private key format " + kr.Format)
+	}
+}
+
+// EncodeKey PEM-encodes a private key generated by the key request in
+// the format the request asks for.
+func (kr *KeyRequest) EncodeKey(priv interface{}) ([]byte, error) {
+	if err := kr.Check(); err != nil {
+		return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest, err)
+	}
+	switch kr.Format {
+	case KeyFormatPKCS8:
+		return helpers.EncodePKCS8PrivateKeyPEM(priv, nil)
+	case KeyFormatEncryptedPKCS8:
+		return helpers.EncodePKCS8PrivateKeyPEM(priv, []byte(kr.Password))
+	default:
+		return EncodePrivateKeyPEM(priv)
+	}
+}
+
 // SigAlgo returns an appropriate X.509 signature algorithm given the
-// key request's type and size.
+// key request's type and size. RSA keys sign with PKCS#1 v1.5 unless
+// the request asks for RSA-PSS.
 func (kr *KeyRequest) SigAlgo() x509.SignatureAlgorithm {
 	switch kr.Algo {
 	case "rsa":
+		if kr.PSS {
+			switch {
+			case kr.Size >= 4096:
+				return x509.SHA512WithRSAPSS
+			case kr.Size >= 3072:
+				return x509.SHA384WithRSAPSS
+			default:
+				return x509.SHA256WithRSAPSS
+			}
+		}
 		switch {
 		case kr.Size >= 4096:
 			return x509.SHA512WithRSA
@@ -98,18 +171,189 @@ func (kr *KeyRequest) SigAlgo() x509.SignatureAlgorithm {
 		default:
 			return x509.ECDSAWithSHA1
 		}
+	case "ed25519":
+		return x509.PureEd25519
 	default:
 		return x509.UnknownSignatureAlgorithm
 	}
 }
 
 // A CertificateRequest encapsulates the API interface to the
-// certificate request functionality.
+// certificate request functionality. Each of the Hosts becomes a
+// subject alternative name of the kind given by ParseHosts. Requests
+// for CA certificates may ask for constraints in CA.
 type CertificateRequest struct {
 	CN         string
 	Names      []Name      `json:"names"`
 	Hosts      []string    `json:"hosts"`
 	KeyRequest *KeyRequest `json:"key,omitempty"`
+	CA         *CAConfig   `json:"ca,omitempty"`
+}
+
+// A CAConfig holds the constraints a request for a CA certificate
+// asks for: a path length of PathLength, or of zero if PathLenZero is
+// set, and the name constraints. They are carried by the extensions
+// of the certificate request, and granted only as far as the signing
+// profile allows.
+type CAConfig struct {
+	PathLength      int                     `json:"pathlen"`
+	PathLenZero     bool                    `json:"pathlenzero"`
+	NameConstraints *config.NameConstraints `json:"name_constraints"`
+}
+
+// Object identifiers of the basic and name constraints extensions,
+// from RFC 5280.
+var (
+	basicConstraintsOID = asn1.ObjectIdentifier{2, 5, 29, 19}
+	nameConstraintsOID  = asn1.ObjectIdentifier{2, 5, 29, 30}
+)
+
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+// The tags of the kinds of general names used in name constraints.
+const (
+	nameTagEmail = 1
+	nameTagDNS   = 2
+	nameTagIP    = 7
+)
+
+type generalSubtree struct {
+	Name asn1.RawValue
+}
+
+type nameConstraints struct {
+	Permitted []generalSubtree `asn1:"optional,tag:0"`
+	Excluded  []generalSubtree `asn1:"optional,tag:1"`
+}
+
+// subtrees returns the general subtrees of the DNS domains, IP ranges
+// in CIDR notation and email addresses.
+func subtrees(domains, ipRanges, emails []string) (sts []generalSubtree, err error) {
+	for _, domain := range domains {
+		sts = append(sts, generalSubtree{asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTagDNS, Bytes: []byte(domain)}})
+	}
+	for _, r := range ipRanges {
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, err
+		}
+		ip := ipNet.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		b := append(append([]byte{}, ip...), ipNet.Mask...)
+		sts = append(sts, generalSubtree{asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTagIP, Bytes: b}})
+	}
+	for _, email := range emails {
+		sts = append(sts, generalSubtree{asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTagEmail, Bytes: []byte(email)}})
+	}
+	return
+}
+
+// extensions returns the extensions of a certificate request asking
+// for the constraints.
+func (ca *CAConfig) extensions() ([]pkix.Extension, error) {
+	if ca.PathLength < 0 {
+		return nil, errors.New("pathlen must not be negative")
+	}
+	bc := basicConstraints{IsCA: true, MaxPathLen: -1}
+	if ca.PathLenZero {
+		bc.MaxPathLen = 0
+	} else if ca.PathLength > 0 {
+		bc.MaxPathLen = ca.PathLength
+	}
+	value, err := asn1.Marshal(bc)
+	if err != nil {
+		return nil, err
+	}
+	exts := []pkix.Extension{{Id: basicConstraintsOID, Critical: true, Value: value}}
+
+	nc := ca.NameConstraints
+	if nc == nil {
+		return exts, nil
+	}
+	var c nameConstraints
+	if c.Permitted, err = subtrees(nc.PermittedDNSDomains, nc.PermittedIPRanges, nc.PermittedEmailAddresses); err != nil {
+		return nil, err
+	}
+	if c.Excluded, err = subtrees(nc.ExcludedDNSDomains, nc.ExcludedIPRanges, nc.ExcludedEmailAddresses); err != nil {
+		return nil, err
+	}
+	if c.Permitted == nil && c.Excluded == nil {
+		return exts, nil
+	}
+	if value, err = asn1.Marshal(c); err != nil {
+		return nil, err
+	}
+	return append(exts, pkix.Extension{Id: nameConstraintsOID, Critical: nc.Critical, Value: value}), nil
+}
+
+// ParseCAExtensions sets the basic and name constraints of the
+// certificate template to those asked for by the extensions of a
+// certificate request, as made by ParseRequest. A request asking for
+// no path length leaves MaxPathLen at -1.
+func ParseCAExtensions(template *x509.Certificate, exts []pkix.Extension) error {
+	for _, ext := range exts {
+		switch {
+		case ext.Id.Equal(basicConstraintsOID):
+			bc := basicConstraints{MaxPathLen: -1}
+			if rest, err := asn1.Unmarshal(ext.Value, &bc); err != nil {
+				return err
+			} else if len(rest) != 0 {
+				return errors.New("trailing data after basic constraints")
+			}
+			template.BasicConstraintsValid = true
+			template.IsCA = bc.IsCA
+			template.MaxPathLen = bc.MaxPathLen
+			template.MaxPathLenZero = bc.MaxPathLen == 0
+		case ext.Id.Equal(nameConstraintsOID):
+			var c nameConstraints
+			if rest, err := asn1.Unmarshal(ext.Value, &c); err != nil {
+				return err
+			} else if len(rest) != 0 {
+				return errors.New("trailing data after name constraints")
+			}
+			template.PermittedDNSDomainsCritical = ext.Critical
+			var err error
+			template.PermittedDNSDomains, template.PermittedIPRanges, template.PermittedEmailAddresses, err = parseSubtrees(c.Permitted)
+			if err != nil {
+				return err
+			}
+			template.ExcludedDNSDomains, template.ExcludedIPRanges, template.ExcludedEmailAddresses, err = parseSubtrees(c.Excluded)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseSubtrees sorts the general subtrees into DNS domains, IP
+// ranges and email addresses.
+func parseSubtrees(sts []generalSubtree) (domains []string, ipRanges []*net.IPNet, emails []string, err error) {
+	for _, st := range sts {
+		if st.Name.Class != asn1.ClassContextSpecific {
+			return nil, nil, nil, errors.New("invalid name constraint")
+		}
+		switch st.Name.Tag {
+		case nameTagDNS:
+			domains = append(domains, string(st.Name.Bytes))
+		case nameTagEmail:
+			emails = append(emails, string(st.Name.Bytes))
+		case nameTagIP:
+			n := len(st.Name.Bytes)
+			if n != 2*net.IPv4len && n != 2*net.IPv6len {
+				return nil, nil, nil, errors.New("invalid IP range in name constraint")
+			}
+			ipRanges = append(ipRanges, &net.IPNet{IP: st.Name.Bytes[:n/2], Mask: st.Name.Bytes[n/2:]})
+		default:
+			return nil, nil, nil, fmt.Errorf("unsupported name constraint of type %d", st.Name.Tag)
+		}
+	}
+	return
 }
 
 // appendIf appends to a if s is not an empty string.
@@ -134,6 +378,25 @@ func (cr *CertificateRequest) Name() pkix.Name {
 	return name
 }
 
+// ParseHosts sorts hosts into the kinds of subject alternative name
+// they belong in: IP addresses, URIs (hosts with a scheme and an
+// authority, such as spiffe://example.org/service), email addresses
+// and, for everything else, DNS names.
+func ParseHosts(hosts []string) (dnsNames []string, ipAddresses []net.IP, emailAddresses []string, uris []*url.URL) {
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			ipAddresses = append(ipAddresses, ip)
+		} else if uri, err := url.Parse(host); err == nil && uri.Scheme != "" && uri.Host != "" {
+			uris = append(uris, uri)
+		} else if addr, err := mail.ParseAddress(host); err == nil && addr.Address == host {
+			emailAddresses = append(emailAddresses, host)
+		} else {
+			dnsNames = append(dnsNames, host)
+		}
+	}
+	return
+}
+
 // ParseRequest takes a certificate request and generates a key and
 // CSR from it. It does no validation -- caveat emptor. It will,
 // however, fail if the key request is not valid (i.e., an unsupported
@@ -143,10 +406,18 @@ func (cr *CertificateRequest) Name() pkix.Name {
 func ParseRequest(req *CertificateRequest) (csr, key []byte, err error) {
 	log.Info("received CSR")
 	if req.KeyRequest == nil {
-		req.KeyRequest = &KeyRequest{
-			Algo: DefaultKeyRequest.Algo,
-			Size: DefaultKeyRequest.Size,
-		}
+		req.KeyRequest = &KeyRequest{}
+	}
+	if req.KeyRequest.Algo == "" {
+		// A key request that only sets the output format gets the
+		// default key.
+		req.KeyRequest.Algo = DefaultKeyRequest.Algo
+		req.KeyRequest.Size = DefaultKeyRequest.Size
+	}
+
+	if err = req.KeyRequest.Check(); err != nil {
+		err = cferr.New(cferr.PolicyError, cferr.InvalidRequest, err)
+		return
 	}
 
 	log.Infof("generating key: %s-%d", req.KeyRequest.Algo, req.KeyRequest.Size)
@@ -156,33 +427,22 @@ func ParseRequest(req *CertificateRequest) (csr, key []byte, err error) {
 		return
 	}
 
-	switch priv := priv.(type) {
-	case *rsa.PrivateKey:
-		key = x509.MarshalPKCS1PrivateKey(priv)
-		block := pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: key,
-		}
-		key = pem.EncodeToMemory(&block)
-	case *ecdsa.PrivateKey:
-		key, err = x509.MarshalECPrivateKey(priv)
-		if err != nil {
-			err = cferr.New(cferr.PrivateKeyError, cferr.Unknown, err)
-			return
-		}
-		block := pem.Block{
-			Type:  "EC PRIVATE KEY",
-			Bytes: key,
-		}
-		key = pem.EncodeToMemory(&block)
-	default:
-		panic("Generate should have failed to produce a valid key.")
+	key, err = req.KeyRequest.EncodeKey(priv)
+	if err != nil {
+		return
 	}
 
 	var tpl = x509.CertificateRequest{
 		Subject:            req.Name(),
 		SignatureAlgorithm: req.KeyRequest.SigAlgo(),
-		DNSNames:           req.Hosts,
+	}
+	tpl.DNSNames, tpl.IPAddresses, tpl.EmailAddresses, tpl.URIs = ParseHosts(req.Hosts)
+	if req.CA != nil {
+		if tpl.ExtraExtensions, err = req.CA.extensions(); err != nil {
+			log.Errorf("invalid CA constraints: %v", err)
+			err = cferr.New(cferr.PolicyError, cferr.InvalidRequest, err)
+			return
+		}
 	}
 	csr, err = x509.CreateCertificateRequest(rand.Reader, &tpl, priv)
 	if err != nil {
@@ -205,6 +465,37 @@ func ParseRequest(req *CertificateRequest) (csr, key []byte, err error) {
 	return
 }
 
+// EncodePrivateKeyPEM PEM-encodes a private key generated by a
+// KeyRequest: a PKCS#1 RSA key, an elliptic curve key, or a PKCS#8
+// Ed25519 key, which has no other encoding.
+func EncodePrivateKeyPEM(priv interface{}) (key []byte, err error) {
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		key = x509.MarshalPKCS1PrivateKey(priv)
+		block := pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: key,
+		}
+		key = pem.EncodeToMemory(&block)
+	case *ecdsa.PrivateKey:
+		key, err = x509.MarshalECPrivateKey(priv)
+		if err != nil {
+			err = cferr.New(cferr.PrivateKeyError, cferr.Unknown, err)
+			return
+		}
+		block := pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: key,
+		}
+		key = pem.EncodeToMemory(&block)
+	case ed25519.PrivateKey:
+		key, err = helpers.EncodePKCS8PrivateKeyPEM(priv, nil)
+	default:
+		err = cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC, nil)
+	}
+	return
+}
+
 // A Generator is responsible for validating certificate requests.
 type Generator struct {
 	Validator func(*CertificateRequest) error
@@ -2,20 +2,24 @@ package csr
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	_ "crypto/sha512"
 	"crypto/x509"
 	"encoding/pem"
+	"reflect"
 	"testing"
 
+	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 // TestKeyRequest ensures that key generation returns the same type of
 // key specified in the KeyRequest.
 func TestKeyRequest(t *testing.T) {
-	var kr = &KeyRequest{"ecdsa", 256}
+	var kr = &KeyRequest{Algo: "ecdsa", Size: 256}
 
 	priv, err := kr.Generate()
 	if err != nil {
@@ -37,7 +41,7 @@ func TestKeyRequest(t *testing.T) {
 // TestPKIXName validates building a pkix.Name structure from a
 // CertificateRequest.
 func TestPKIXName(t *testing.T) {
-	var kr = KeyRequest{"ecdsa", 256}
+	var kr = KeyRequest{Algo: "ecdsa", Size: 256}
 	var cr = &CertificateRequest{
 		CN: "Test Common Name",
 		Names: []Name{
@@ -79,7 +83,7 @@ func TestPKIXName(t *testing.T) {
 // TestParseRequest ensures that a valid certificate request does not
 // error.
 func TestParseRequest(t *testing.T) {
-	var kr = KeyRequest{"ecdsa", 256}
+	var kr = KeyRequest{Algo: "ecdsa", Size: 256}
 	var cr = &CertificateRequest{
 		CN: "Test Common Name",
 		Names: []Name{
@@ -108,6 +112,108 @@ func TestParseRequest(t *testing.T) {
 	}
 }
 
+func TestParseRequestHosts(t *testing.T) {
+	var cr = &CertificateRequest{
+		CN: "Test Common Name",
+		Hosts: []string{"cloudflare.com", "10.0.0.5", "::1", "admin@cloudflare.com",
+			"spiffe://cloudflare.com/service", "localhost:8080"},
+		KeyRequest: &KeyRequest{Algo: "ecdsa", Size: 256},
+	}
+
+	csrPEM, _, err := ParseRequest(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(csr.DNSNames) != 2 || csr.DNSNames[0] != "cloudflare.com" || csr.DNSNames[1] != "localhost:8080" {
+		t.Fatalf("Unexpected DNS names %v", csr.DNSNames)
+	}
+	if len(csr.IPAddresses) != 2 || csr.IPAddresses[0].String() != "10.0.0.5" || csr.IPAddresses[1].String() != "::1" {
+		t.Fatalf("Unexpected IP addresses %v", csr.IPAddresses)
+	}
+	if len(csr.EmailAddresses) != 1 || csr.EmailAddresses[0] != "admin@cloudflare.com" {
+		t.Fatalf("Unexpected email addresses %v", csr.EmailAddresses)
+	}
+	if len(csr.URIs) != 1 || csr.URIs[0].String() != "spiffe://cloudflare.com/service" {
+		t.Fatalf("Unexpected URIs %v", csr.URIs)
+	}
+}
+
+func TestParseRequestCA(t *testing.T) {
+	var cr = &CertificateRequest{
+		CN:         "Test Intermediate CA",
+		KeyRequest: &KeyRequest{Algo: "ecdsa", Size: 256},
+		CA: &CAConfig{
+			PathLength: 2,
+			NameConstraints: &config.NameConstraints{
+				Critical:                true,
+				PermittedDNSDomains:     []string{"cloudflare.com"},
+				ExcludedDNSDomains:      []string{"secret.cloudflare.com"},
+				PermittedIPRanges:       []string{"10.0.0.0/8"},
+				PermittedEmailAddresses: []string{"cloudflare.com"},
+			},
+		},
+	}
+
+	csrPEM, _, err := ParseRequest(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var template x509.Certificate
+	if err = ParseCAExtensions(&template, csr.Extensions); err != nil {
+		t.Fatal(err)
+	}
+	if !template.BasicConstraintsValid || !template.IsCA || template.MaxPathLen != 2 || template.MaxPathLenZero {
+		t.Fatalf("Unexpected basic constraints %v %v %d", template.BasicConstraintsValid, template.IsCA, template.MaxPathLen)
+	}
+	if !template.PermittedDNSDomainsCritical ||
+		!reflect.DeepEqual(template.PermittedDNSDomains, []string{"cloudflare.com"}) ||
+		!reflect.DeepEqual(template.ExcludedDNSDomains, []string{"secret.cloudflare.com"}) ||
+		!reflect.DeepEqual(template.PermittedEmailAddresses, []string{"cloudflare.com"}) {
+		t.Fatalf("Unexpected name constraints in %+v", template)
+	}
+	if len(template.PermittedIPRanges) != 1 || template.PermittedIPRanges[0].String() != "10.0.0.0/8" {
+		t.Fatalf("Unexpected IP constraints %v", template.PermittedIPRanges)
+	}
+
+	cr.CA = &CAConfig{PathLenZero: true}
+	if csrPEM, _, err = ParseRequest(cr); err != nil {
+		t.Fatal(err)
+	}
+	block, _ = pem.Decode(csrPEM)
+	if csr, err = x509.ParseCertificateRequest(block.Bytes); err != nil {
+		t.Fatal(err)
+	}
+	template = x509.Certificate{}
+	if err = ParseCAExtensions(&template, csr.Extensions); err != nil {
+		t.Fatal(err)
+	}
+	if template.MaxPathLen != 0 || !template.MaxPathLenZero || template.PermittedDNSDomains != nil {
+		t.Fatalf("Unexpected constraints in %+v", template)
+	}
+
+	for _, ca := range []*CAConfig{
+		{PathLength: -1},
+		{NameConstraints: &config.NameConstraints{PermittedIPRanges: []string{"10.0.0.0"}}},
+	} {
+		cr.CA = ca
+		if _, _, err = ParseRequest(cr); err == nil {
+			t.Fatalf("Expected error for CA constraints %+v", ca)
+		}
+	}
+}
+
 func whichCurve(sz int) elliptic.Curve {
 	switch sz {
 	case 256:
@@ -161,6 +267,84 @@ func TestRSAKeyGeneration(t *testing.T) {
 	}
 }
 
+// TestEd25519Generation ensures that Ed25519 keys are generated
+// regardless of the requested size, and that a CSR signed with one is
+// valid.
+func TestEd25519Generation(t *testing.T) {
+	kr := &KeyRequest{Algo: "ed25519"}
+	priv, err := kr.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := priv.(ed25519.PrivateKey); !ok {
+		t.Fatalf("Generated key has wrong type %T.", priv)
+	}
+	if kr.SigAlgo() != x509.PureEd25519 {
+		t.Fatal("Invalid signature algorithm!")
+	}
+
+	csrPEM, key, err := ParseRequest(&CertificateRequest{CN: "cloudflare.com", KeyRequest: kr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, _ := pem.Decode(key); block == nil || block.Type != "PRIVATE KEY" {
+		t.Fatal("Expected a PKCS#8 Ed25519 private key")
+	}
+	if _, err = helpers.ParsePrivateKeyPEM(key); err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.SignatureAlgorithm != x509.PureEd25519 {
+		t.Fatalf("Unexpected CSR signature algorithm %v", csr.SignatureAlgorithm)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRSAPSSKeyRequest ensures that RSA key requests asking for
+// RSA-PSS sign their CSRs with it, and that other keys cannot.
+func TestRSAPSSKeyRequest(t *testing.T) {
+	for sz, algo := range map[int]x509.SignatureAlgorithm{
+		2048: x509.SHA256WithRSAPSS,
+		3072: x509.SHA384WithRSAPSS,
+		4096: x509.SHA512WithRSAPSS,
+	} {
+		if sa := (&KeyRequest{Algo: "rsa", Size: sz, PSS: true}).SigAlgo(); sa != algo {
+			t.Fatalf("Unexpected signature algorithm %v for a %d-bit RSA-PSS key request", sa, sz)
+		}
+	}
+
+	csrPEM, _, err := ParseRequest(&CertificateRequest{CN: "cloudflare.com", KeyRequest: &KeyRequest{Algo: "rsa", Size: 2048, PSS: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.SignatureAlgorithm != x509.SHA256WithRSAPSS {
+		t.Fatalf("Unexpected CSR signature algorithm %v", csr.SignatureAlgorithm)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kr := range []*KeyRequest{
+		{Algo: "ecdsa", Size: 256, PSS: true},
+		{PSS: true},
+	} {
+		if _, _, err := ParseRequest(&CertificateRequest{CN: "cloudflare.com", KeyRequest: kr}); err == nil {
+			t.Fatalf("Expected error for key request %+v", kr)
+		}
+	}
+}
+
 // TestBadKeyRequest ensures that generating a key from a KeyRequest
 // fails with an invalid algorithm, or an invalid RSA or ECDSA key
 // size. An invalid ECDSA key size is any size other than 256, 384, or
@@ -228,6 +412,42 @@ func TestDefaultKeyRequest(t *testing.T) {
 	}
 }
 
+func TestKeyFormat(t *testing.T) {
+	for _, test := range []struct {
+		kr        *KeyRequest
+		blockType string
+	}{
+		{&KeyRequest{Algo: "ecdsa", Size: 256}, "EC PRIVATE KEY"},
+		{&KeyRequest{Algo: "ecdsa", Size: 256, Format: KeyFormatPKCS8}, "PRIVATE KEY"},
+		{&KeyRequest{Format: KeyFormatEncryptedPKCS8, Password: "password"}, "ENCRYPTED PRIVATE KEY"},
+	} {
+		_, key, err := ParseRequest(&CertificateRequest{CN: "cloudflare.com", KeyRequest: test.kr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode(key)
+		if block == nil || block.Type != test.blockType {
+			t.Fatalf("Expected a %s for format %q", test.blockType, test.kr.Format)
+		}
+		priv, err := helpers.ParsePrivateKeyPEMWithPassword(key, []byte(test.kr.Password))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := priv.(*ecdsa.PrivateKey); !ok {
+			t.Fatalf("Unexpected key type %T for format %q", priv, test.kr.Format)
+		}
+	}
+
+	for _, kr := range []*KeyRequest{
+		{Algo: "ecdsa", Size: 256, Format: KeyFormatEncryptedPKCS8},
+		{Algo: "ecdsa", Size: 256, Format: "pkcs12"},
+	} {
+		if _, _, err := ParseRequest(&CertificateRequest{CN: "cloudflare.com", KeyRequest: kr}); err == nil {
+			t.Fatalf("Expected error for key request %+v", kr)
+		}
+	}
+}
+
 // TestRSACertRequest validates parsing a certificate request with an
 // RSA key.
 func TestRSACertRequest(t *testing.T) {
@@ -35,7 +35,22 @@ The index of codes are listed below:
 	    5100: NoKeyUsages
 	    5200: InvalidPolicy
 	    5300: InvalidRequest
-	    6XXX: DialError
+	    5400: NameNotAllowed
+	6XXX: DialError
+	7XXX: OCSPError
+	    7100: IssuerMismatch
+	    7200: InvalidStatus
+	8XXX: CertStoreError
+	    8000: Unknown
+	    8001: ReadFailed
+	    8100: RecordNotFound
+	    8200: InsertionFailed
+	    8300: UpdateFailed
+	9XXX: RevocationError
+	    9000: Unknown
+	    9100: InvalidReason
+	    9200: CertificateNotFound
+	    9300: AlreadyRevoked
 
 2. Type HttpError is intended for CF SSL API to consume. It contains a HTTP status code that will be read and returned
 by the API server.
@@ -29,6 +29,9 @@ const (
 	RootError                                 // 4XXX
 	PolicyError                               // 5XXX
 	DialError                                 // 6XXX
+	OCSPError                                 // 7XXX
+	CertStoreError                            // 8XXX
+	RevocationError                           // 9XXX
 )
 
 // Non-specified error
@@ -79,6 +82,29 @@ const (
 	NoKeyUsages    Reason = 100 * (iota + 1) // 51XX
 	InvalidPolicy                            // 52XX
 	InvalidRequest                           // 53XX
+	NameNotAllowed                           // 54XX
+)
+
+// OCSP non-parsing errors, must be specified along with OCSPError.
+const (
+	IssuerMismatch Reason = 100 * (iota + 1) // 71XX
+	InvalidStatus                            // 72XX
+)
+
+// Certificate store non-parsing errors, must be specified along with
+// CertStoreError.
+const (
+	RecordNotFound  Reason = 100 * (iota + 1) // 81XX
+	InsertionFailed                           // 82XX
+	UpdateFailed                              // 83XX
+)
+
+// Revocation non-parsing errors, must be specified along with
+// RevocationError.
+const (
+	InvalidReason       Reason = 100 * (iota + 1) // 91XX
+	CertificateNotFound                           // 92XX
+	AlreadyRevoked                                // 93XX
 )
 
 // The error interface implementation, which formats to a JSON object string.
@@ -150,6 +176,43 @@ func New(category Category, reason Reason, err error) *Error {
 		if err == nil {
 			err = errors.New("Failed dialing remote server.")
 		}
+	case OCSPError:
+		if err == nil {
+			msg := "Unknown OCSP error"
+			switch reason {
+			case IssuerMismatch:
+				msg = "Certificate was not issued by the OCSP issuer"
+			case InvalidStatus:
+				msg = "Invalid OCSP certificate status"
+			}
+			err = errors.New(msg)
+		}
+	case CertStoreError:
+		if err == nil {
+			msg := "Unknown certificate store error"
+			switch reason {
+			case RecordNotFound:
+				msg = "Certificate record not found"
+			case InsertionFailed:
+				msg = "Failed to insert certificate record"
+			case UpdateFailed:
+				msg = "Failed to update certificate record"
+			}
+			err = errors.New(msg)
+		}
+	case RevocationError:
+		if err == nil {
+			msg := "Unknown revocation error"
+			switch reason {
+			case InvalidReason:
+				msg = "Invalid revocation reason"
+			case CertificateNotFound:
+				msg = "Certificate to revoke was not found"
+			case AlreadyRevoked:
+				msg = "Certificate is already revoked"
+			}
+			err = errors.New(msg)
+		}
 	default: // Got a different Category? panic.
 		panic(errors.New("Unsupported CF-SSL Error Type"))
 	}
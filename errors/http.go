@@ -16,6 +16,11 @@ func (e *HttpError) Error() string {
 	return e.error.Error()
 }
 
+// Cause returns the error the HttpError wraps.
+func (e *HttpError) Cause() error {
+	return e.error
+}
+
 func NewMethodNotAllowed(method string) *HttpError {
 	return &HttpError{http.StatusMethodNotAllowed, errors.New(`Method is not allowed:"` + method + `"`)}
 }
@@ -31,6 +36,30 @@ func NewBadRequestString(s string) *HttpError {
 	return NewBadRequest(errors.New(s))
 }
 
+// NewUnauthorized creates a HttpError with the given error and error
+// code 401.
+func NewUnauthorized(err error) *HttpError {
+	return &HttpError{http.StatusUnauthorized, err}
+}
+
+// NewUnauthorizedString returns a HttpError with the supplied message
+// and error code 401.
+func NewUnauthorizedString(s string) *HttpError {
+	return NewUnauthorized(errors.New(s))
+}
+
+// NewForbidden creates a HttpError with the given error and error
+// code 403.
+func NewForbidden(err error) *HttpError {
+	return &HttpError{http.StatusForbidden, err}
+}
+
+// NewForbiddenString returns a HttpError with the supplied message
+// and error code 403.
+func NewForbiddenString(s string) *HttpError {
+	return NewForbidden(errors.New(s))
+}
+
 // NewBadRequestMissingParameter returns a 400 HttpError as a required
 // parameter is missing in the HTTP request.
 func NewBadRequestMissingParameter(s string) *HttpError {
@@ -5,10 +5,12 @@ package helpers
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"io/ioutil"
 	"strings"
 	"time"
 
@@ -17,7 +19,7 @@ import (
 
 const OneYear = 8760 * time.Hour
 
-// KeyLength returns the bit size of ECDSA or RSA PublicKey
+// KeyLength returns the bit size of ECDSA, RSA or Ed25519 PublicKey
 func KeyLength(key interface{}) int {
 	if key == nil {
 		return 0
@@ -26,6 +28,8 @@ func KeyLength(key interface{}) int {
 		return ecdsaKey.Curve.Params().BitSize
 	} else if rsaKey, ok := key.(*rsa.PublicKey); ok {
 		return rsaKey.N.BitLen()
+	} else if _, ok := key.(ed25519.PublicKey); ok {
+		return 256
 	}
 
 	return 0
@@ -61,6 +65,12 @@ func SignatureString(alg x509.SignatureAlgorithm) string {
 		return "SHA384WithRSA"
 	case x509.SHA512WithRSA:
 		return "SHA512WithRSA"
+	case x509.SHA256WithRSAPSS:
+		return "SHA256WithRSAPSS"
+	case x509.SHA384WithRSAPSS:
+		return "SHA384WithRSAPSS"
+	case x509.SHA512WithRSAPSS:
+		return "SHA512WithRSAPSS"
 	case x509.DSAWithSHA1:
 		return "DSAWithSHA1"
 	case x509.DSAWithSHA256:
@@ -73,6 +83,8 @@ func SignatureString(alg x509.SignatureAlgorithm) string {
 		return "ECDSAWithSHA384"
 	case x509.ECDSAWithSHA512:
 		return "ECDSAWithSHA512"
+	case x509.PureEd25519:
+		return "Ed25519"
 	default:
 		return "Unknown Signature"
 	}
@@ -100,6 +112,28 @@ func ParseCertificatesPEM(certsPEM []byte) ([]*x509.Certificate, error) {
 	return certs, nil
 }
 
+// LoadPEMCertPool loads a pool of the PEM-encoded certificates in the
+// file at path.
+func LoadPEMCertPool(path string) (*x509.CertPool, error) {
+	pemCerts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.ReadFailed, err)
+	}
+	certs, err := ParseCertificatesPEM(pemCerts)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, cferr.New(cferr.CertificateError, cferr.DecodeFailed, errors.New("no certificates in "+path))
+	}
+
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
 // ParseSelfSignedCertificatePEM parses a PEM-encoded certificate and check if it is self-signed.
 func ParseSelfSignedCertificatePEM(certPEM []byte) (*x509.Certificate, error) {
 	cert, err := ParseCertificatePEM(certPEM)
@@ -141,24 +175,72 @@ func ParseOneCertificateFromPEM(certsPEM []byte) (cert *x509.Certificate, rest [
 }
 
 // ParsePrivateKeyPEM parses and returns a PEM-encoded private
-// key. The private key may be either an unencrypted PKCS#8, PKCS#1,
-// or elliptic private key.
+// key. The private key may be either a PKCS#8, PKCS#1, or elliptic
+// private key. An encrypted PKCS#8 key or a key with legacy PEM
+// encryption ("Proc-Type: 4,ENCRYPTED") is decrypted with the
+// passphrase read from KeyPasswordSource.
 func ParsePrivateKeyPEM(keyPEM []byte) (key interface{}, err error) {
+	return parsePrivateKeyPEM(keyPEM, func() ([]byte, error) {
+		return ReadPassword(KeyPasswordSource)
+	})
+}
+
+// ParsePrivateKeyPEMWithPassword parses and returns a PEM-encoded
+// private key like ParsePrivateKeyPEM, decrypting an encrypted key
+// with the given passphrase.
+func ParsePrivateKeyPEMWithPassword(keyPEM, password []byte) (key interface{}, err error) {
+	return parsePrivateKeyPEM(keyPEM, func() ([]byte, error) {
+		return password, nil
+	})
+}
+
+// parsePrivateKeyPEM parses a PEM-encoded private key, decrypting an
+// encrypted key with the passphrase returned by password, which is
+// only called for encrypted keys.
+func parsePrivateKeyPEM(keyPEM []byte, password func() ([]byte, error)) (key interface{}, err error) {
 	keyDER, _ := pem.Decode(keyPEM)
 	if keyDER == nil {
 		return nil, cferr.New(cferr.PrivateKeyError, cferr.DecodeFailed, nil)
 	}
-	if procType, ok := keyDER.Headers["Proc-Type"]; ok {
-		if strings.Contains(procType, "ENCRYPTED") {
+
+	der := keyDER.Bytes
+	encrypted := keyDER.Type == "ENCRYPTED PRIVATE KEY"
+	if procType, ok := keyDER.Headers["Proc-Type"]; ok && strings.Contains(procType, "ENCRYPTED") {
+		encrypted = true
+	}
+	if encrypted {
+		pass, err := password()
+		if err != nil {
+			return nil, cferr.New(cferr.PrivateKeyError, cferr.Encrypted, err)
+		}
+		if len(pass) == 0 {
 			return nil, cferr.New(cferr.PrivateKeyError, cferr.Encrypted, nil)
 		}
+		if keyDER.Type == "ENCRYPTED PRIVATE KEY" {
+			der, err = decryptPKCS8(der, pass)
+		} else {
+			der, err = x509.DecryptPEMBlock(keyDER, pass)
+		}
+		if err != nil {
+			if err == x509.IncorrectPasswordError {
+				err = errIncorrectPassword
+			}
+			return nil, cferr.New(cferr.PrivateKeyError, cferr.Encrypted, err)
+		}
 	}
-	key, err = x509.ParsePKCS8PrivateKey(keyDER.Bytes)
+
+	key, err = x509.ParsePKCS8PrivateKey(der)
 	if err != nil {
-		key, err = x509.ParsePKCS1PrivateKey(keyDER.Bytes)
+		key, err = x509.ParsePKCS1PrivateKey(der)
 		if err != nil {
-			key, err = x509.ParseECPrivateKey(keyDER.Bytes)
+			key, err = x509.ParseECPrivateKey(der)
 			if err != nil {
+				// A key that was decrypted but does not parse
+				// was most likely decrypted with the wrong
+				// passphrase.
+				if encrypted {
+					return nil, cferr.New(cferr.PrivateKeyError, cferr.Encrypted, errIncorrectPassword)
+				}
 				// We don't include the actual error into the final error.
 				// The reason might be we don't want to leak any info about
 				// the private key.
@@ -1,8 +1,13 @@
 package helpers
 
 import (
+	"crypto/ecdsa"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	cferr "github.com/cloudflare/cfssl/errors"
 )
 
 const (
@@ -10,8 +15,18 @@ const (
 	testBundleFile        = "testdata/bundle.pem"
 	testExtraWSCertFile   = "testdata/cert_with_whitespace.pem"
 	testExtraWSBundleFile = "testdata/bundle_with_whitespace.pem"
+	testKeyFile           = "testdata/key.pem"
+	testKeyPassword       = "cfssl-test"
 )
 
+// testEncryptedKeyFiles hold the key of testKeyFile encrypted with
+// testKeyPassword.
+var testEncryptedKeyFiles = []string{
+	"testdata/key_pkcs8_aes256.pem",
+	"testdata/key_pkcs8_des3_sha1.pem",
+	"testdata/key_legacy_aes128.pem",
+}
+
 func TestParseCertificatePEM(t *testing.T) {
 	for _, testFile := range []string{testCertFile, testExtraWSCertFile} {
 		certPEM, err := ioutil.ReadFile(testFile)
@@ -37,3 +52,105 @@ func TestParseCertificatesPEM(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadPEMCertPool(t *testing.T) {
+	pool, err := LoadPEMCertPool(testBundleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.Subjects()) == 0 {
+		t.Fatal("Expected certificates in the pool.")
+	}
+
+	if _, err = LoadPEMCertPool("testdata/no_such_file"); err == nil {
+		t.Fatal("Expected error loading a missing file.")
+	}
+}
+
+func readKey(t *testing.T, file string, password []byte) (interface{}, error) {
+	keyPEM, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password == nil {
+		return ParsePrivateKeyPEM(keyPEM)
+	}
+	return ParsePrivateKeyPEMWithPassword(keyPEM, password)
+}
+
+func TestParseEncryptedPrivateKeyPEM(t *testing.T) {
+	expected, err := readKey(t, testKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range testEncryptedKeyFiles {
+		key, err := readKey(t, file, []byte(testKeyPassword))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if !key.(*ecdsa.PrivateKey).Equal(expected) {
+			t.Fatalf("%s: decrypted key does not match", file)
+		}
+
+		for _, password := range []string{"", "wrong password"} {
+			_, err = readKey(t, file, []byte(password))
+			cfErr, ok := err.(*cferr.Error)
+			if !ok || cfErr.ErrorCode != int(cferr.PrivateKeyError)+int(cferr.Encrypted) {
+				t.Fatalf("%s: expected an encrypted key error with password %q, got %v", file, password, err)
+			}
+		}
+	}
+}
+
+func TestKeyPasswordSource(t *testing.T) {
+	defer func(source string) { KeyPasswordSource = source }(KeyPasswordSource)
+
+	os.Setenv("CFSSL_TEST_KEY_PASSWORD", testKeyPassword)
+	defer os.Unsetenv("CFSSL_TEST_KEY_PASSWORD")
+
+	dir, err := ioutil.TempDir("", "cfssl-helpers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+	if err = ioutil.WriteFile(passwordFile, []byte(testKeyPassword+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{"env:CFSSL_TEST_KEY_PASSWORD", "file:" + passwordFile} {
+		KeyPasswordSource = source
+		if _, err = readKey(t, testEncryptedKeyFiles[0], nil); err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+	}
+
+	for _, source := range []string{"", "env:CFSSL_TEST_NO_SUCH_VARIABLE", "file:" + filepath.Join(dir, "missing"), "unknown"} {
+		KeyPasswordSource = source
+		if _, err = readKey(t, testEncryptedKeyFiles[0], nil); err == nil {
+			t.Fatalf("Expected error decrypting a key with passphrase source %q", source)
+		}
+	}
+}
+
+func TestEncodePKCS8PrivateKeyPEM(t *testing.T) {
+	expected, err := readKey(t, testKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, password := range []string{"", testKeyPassword} {
+		keyPEM, err := EncodePKCS8PrivateKeyPEM(expected, []byte(password))
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ParsePrivateKeyPEMWithPassword(keyPEM, []byte(password))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.(*ecdsa.PrivateKey).Equal(expected) {
+			t.Fatalf("Key encoded with password %q does not match", password)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DefaultKeyPasswordSource is the source of the passphrase of
+// encrypted private keys unless another is set: the environment
+// variable CFSSL_KEY_PASSWORD.
+const DefaultKeyPasswordSource = "env:CFSSL_KEY_PASSWORD"
+
+// KeyPasswordSource is the source ParsePrivateKeyPEM reads the
+// passphrase of encrypted private keys from, as taken by
+// ReadPassword. Commands set it from the command line.
+var KeyPasswordSource = DefaultKeyPasswordSource
+
+// DefaultKeyOutPasswordSource is the default source of the passphrase
+// new private keys are encrypted with: the environment variable
+// CFSSL_KEY_OUT_PASSWORD. It is kept apart from the source of the
+// passphrase of existing keys, so that new keys are never encrypted
+// with the passphrase of a CA key.
+const DefaultKeyOutPasswordSource = "env:CFSSL_KEY_OUT_PASSWORD"
+
+// ReadPassword reads a passphrase from the source: "env:NAME" reads
+// it from the environment variable NAME, "file:PATH" from the first
+// line of the file at PATH, and "prompt" asks for it on the terminal.
+// An empty source gives no passphrase.
+func ReadPassword(source string) ([]byte, error) {
+	return readPassword(source, "Passphrase of the private key: ")
+}
+
+// ReadNewPassword reads the passphrase to encrypt a new private key
+// with from the source, as ReadPassword does.
+func ReadNewPassword(source string) ([]byte, error) {
+	return readPassword(source, "Passphrase to encrypt the new private key: ")
+}
+
+func readPassword(source, prompt string) ([]byte, error) {
+	switch {
+	case source == "":
+		return nil, nil
+	case strings.HasPrefix(source, "env:"):
+		return []byte(os.Getenv(strings.TrimPrefix(source, "env:"))), nil
+	case strings.HasPrefix(source, "file:"):
+		contents, err := ioutil.ReadFile(strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return nil, err
+		}
+		if i := bytes.IndexAny(contents, "\r\n"); i >= 0 {
+			contents = contents[:i]
+		}
+		return contents, nil
+	case source == "prompt":
+		return promptPassword(prompt)
+	default:
+		return nil, errors.New("unknown passphrase source " + source)
+	}
+}
+
+// promptPassword writes the prompt to standard error and reads a line
+// from standard input, with echo turned off if it is a terminal.
+func promptPassword(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if setEcho(false) == nil {
+		defer func() {
+			setEcho(true)
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	// Standard input is read a byte at a time so that nothing after
+	// the line is consumed.
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bytes.TrimRight(line, "\r"), nil
+}
+
+// setEcho turns the echo of the terminal on standard input on or off.
+func setEcho(on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,235 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"io"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+)
+
+// Object identifiers of the password-based encryption schemes of
+// encrypted PKCS#8 private keys, from RFC 8018 and RFC 3565.
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// errIncorrectPassword is returned when an encrypted private key
+// cannot be decrypted with the passphrase given.
+var errIncorrectPassword = errors.New("incorrect passphrase for the private key")
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// Parameters of the encryption of PKCS#8 private keys by
+// EncodePKCS8PrivateKeyPEM: PBKDF2 with HMAC-SHA256 derives an AES-256
+// key, used in CBC mode.
+const (
+	pkcs8SaltSize   = 16
+	pkcs8Iterations = 100000
+)
+
+// EncodePKCS8PrivateKeyPEM PEM-encodes the private key as a PKCS#8
+// private key. If the password is not empty, the key is encrypted
+// with it using PBES2, as an "ENCRYPTED PRIVATE KEY" that
+// ParsePrivateKeyPEMWithPassword decrypts.
+func EncodePKCS8PrivateKeyPEM(priv interface{}, password []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+	if len(password) == 0 {
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+
+	der, err = encryptPKCS8(der, password)
+	if err != nil {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
+
+// encryptPKCS8 encrypts the DER-encoded PrivateKeyInfo of a PKCS#8
+// private key with the password, returning the DER-encoded
+// EncryptedPrivateKeyInfo.
+func encryptPKCS8(der, password []byte) ([]byte, error) {
+	salt := make([]byte, pkcs8SaltSize)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2(sha256.New, password, salt, pkcs8Iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	plain := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	data := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, plain)
+
+	kdf, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pkcs8Iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivDER, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivDER}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		EncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData:       data,
+	})
+}
+
+// decryptPKCS8 decrypts the DER-encoded EncryptedPrivateKeyInfo of a
+// PKCS#8 private key encrypted with PBES2, returning the DER-encoded
+// PrivateKeyInfo. PBKDF2 with HMAC-SHA1 or HMAC-SHA256 is supported
+// for key derivation, and AES or triple DES in CBC mode for
+// encryption.
+func decryptPKCS8(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("unsupported private key encryption scheme")
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.New("unsupported private key derivation function")
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, errors.New("unsupported private key derivation function")
+	}
+
+	var keyLen int
+	var newCipher func(key []byte) (cipher.Block, error)
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, errors.New("unsupported private key cipher")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	block, err := newCipher(pbkdf2(prf, password, kdf.Salt, kdf.IterationCount, keyLen))
+	if err != nil {
+		return nil, err
+	}
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid encrypted private key")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// A wrong passphrase shows as invalid PKCS#7 padding.
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() {
+		return nil, errIncorrectPassword
+	}
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			return nil, errIncorrectPassword
+		}
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+// pbkdf2 derives a key of keyLen bytes from the password and salt
+// with PBKDF2, as defined in RFC 8018.
+func pbkdf2(prf func() hash.Hash, password, salt []byte, iter, keyLen int) []byte {
+	mac := hmac.New(prf, password)
+	var key []byte
+	var counter [4]byte
+	for i := uint32(1); len(key) < keyLen; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write(counter[:])
+		u := mac.Sum(nil)
+		t := append([]byte(nil), u...)
+		for n := 1; n < iter; n++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
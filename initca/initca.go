@@ -3,7 +3,17 @@
 package initca
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"io/ioutil"
+	"time"
 
 	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/csr"
@@ -11,6 +21,7 @@ import (
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
 )
 
 // validator contains the default validation logic for certificate
@@ -41,21 +52,253 @@ func New(req *csr.CertificateRequest) (cert, key []byte, err error) {
 		return
 	}
 
-	priv, err := helpers.ParsePrivateKeyPEM(key)
+	priv, err := helpers.ParsePrivateKeyPEMWithPassword(key, []byte(req.KeyRequest.Password))
 	if err != nil {
 		log.Errorf("failed to parse private key: %v", err)
 		return
 	}
 
-	s := &signer.Signer{
-		Priv:   priv,
-		Policy: CAPolicy,
+	signPriv, ok := priv.(crypto.Signer)
+	if !ok {
+		err = cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC, nil)
+		return
+	}
+
+	s, err := local.NewSigner(signPriv, nil, signer.DefaultSigAlgo(priv), CAPolicy)
+	if err != nil {
+		log.Errorf("failed to create signer: %v", err)
+		return
+	}
+
+	cert, err = s.Sign(signer.SignRequest{Request: string(csr)})
+	return
+}
+
+// intermediateValidator checks requests for intermediate CAs, which
+// need a common name but, unlike leaf certificates, no hosts.
+func intermediateValidator(req *csr.CertificateRequest) error {
+	if req.CN == "" {
+		return cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("missing common name"))
+	}
+	return nil
+}
+
+// NewIntermediate creates a new intermediate CA from the certificate
+// request: it generates the key and CSR, and has the signer sign the
+// CSR under the profile, which must be a CA profile of the signer's
+// policy. The chain holds the new certificate followed by the
+// signer's CA certificate, or is nil if the signer's certificate is
+// not available, as for remote signers.
+func NewIntermediate(req *csr.CertificateRequest, s signer.Signer, profile string) (key, csrPEM, cert, chain []byte, err error) {
+	if policy := s.Policy(); policy != nil {
+		if p := policy.Profile(profile); p == nil || !p.CA {
+			err = cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("the signing profile is not a CA profile"))
+			return
+		}
+	}
+
+	log.Infof("creating intermediate certificate from CSR")
+	g := &csr.Generator{Validator: intermediateValidator}
+	csrPEM, key, err = g.ProcessRequest(req)
+	if err != nil {
+		log.Errorf("failed to process request: %v", err)
+		return nil, nil, nil, nil, err
 	}
 
-	cert, err = s.Sign("", csr, "")
+	cert, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Profile: profile})
+	if err != nil {
+		log.Errorf("failed to sign intermediate certificate: %v", err)
+		return nil, nil, nil, nil, err
+	}
+
+	if ca, caErr := s.Certificate(); caErr == nil {
+		chain = append(append([]byte{}, cert...), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})...)
+	}
 	return
 }
 
+// loadCA loads the PEM-encoded CA certificate and private key from
+// the given files.
+func loadCA(caFile, caKeyFile string) (*x509.Certificate, crypto.Signer, error) {
+	log.Debug("Loading CA: ", caFile)
+	certPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, nil, cferr.New(cferr.CertificateError, cferr.ReadFailed, err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Debug("Loading CA key: ", caKeyFile)
+	keyPEM, err := ioutil.ReadFile(caKeyFile)
+	if err != nil {
+		return nil, nil, cferr.New(cferr.PrivateKeyError, cferr.ReadFailed, err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC, nil)
+	}
+	return cert, priv, nil
+}
+
+// Renew creates a new self-signed certificate for the CA whose
+// certificate and private key are in the given files. See
+// RenewFromSigner.
+func Renew(caFile, caKeyFile string) (cert []byte, err error) {
+	ca, priv, err := loadCA(caFile, caKeyFile)
+	if err != nil {
+		return
+	}
+	return RenewFromSigner(ca, priv)
+}
+
+// RenewFromSigner creates a new self-signed certificate for the root
+// CA with the private key. The certificate keeps the subject, key, key
+// identifier, path length and name constraints of the CA, with a new
+// serial number and the validity of CAPolicy starting now; a CA
+// without a path length gets the default one of new roots.
+func RenewFromSigner(ca *x509.Certificate, priv crypto.Signer) (cert []byte, err error) {
+	if !ca.IsCA {
+		return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("the certificate is not a CA certificate"))
+	}
+	if err = checkKey(ca, priv); err != nil {
+		return
+	}
+
+	s, err := local.NewSigner(priv, nil, signer.DefaultSigAlgo(priv), CAPolicy)
+	if err != nil {
+		log.Errorf("failed to create signer: %v", err)
+		return
+	}
+
+	log.Infof("renewing root certificate")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+	return s.Sign(signer.SignRequest{Request: string(caPEM)})
+}
+
+// checkKey checks that the private key is that of the certificate.
+func checkKey(cert *x509.Certificate, priv crypto.Signer) error {
+	certKey, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
+	}
+	privKey, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		return cferr.New(cferr.PrivateKeyError, cferr.ParseFailed, err)
+	}
+	if !bytes.Equal(certKey, privKey) {
+		return cferr.New(cferr.PrivateKeyError, cferr.KeyMismatch, nil)
+	}
+	return nil
+}
+
+// Rekey creates a new key for the CA whose certificate and private
+// key are in the given files. See RekeyFromSigner.
+func Rekey(caFile, caKeyFile string, kr *csr.KeyRequest) (cert, crossCert, key []byte, err error) {
+	ca, priv, err := loadCA(caFile, caKeyFile)
+	if err != nil {
+		return
+	}
+	return RekeyFromSigner(ca, priv, kr)
+}
+
+// RekeyFromSigner generates a new key for the root CA as given by the
+// key request, or of the same kind as its current key if kr is nil or
+// names no algorithm; the key is output in the format kr asks for. It
+// returns a new self-signed certificate for the new key, with the
+// subject and constraints of the CA as for RenewFromSigner, the
+// certificate for the new key cross-signed with the current one, and
+// the new key. Until the current certificate expires, the cross-signed
+// certificate chains the certificates issued under the new key to the
+// current root.
+func RekeyFromSigner(ca *x509.Certificate, priv crypto.Signer, kr *csr.KeyRequest) (cert, crossCert, key []byte, err error) {
+	if !ca.IsCA {
+		err = cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("the certificate is not a CA certificate"))
+		return
+	}
+	if err = checkKey(ca, priv); err != nil {
+		return
+	}
+
+	if kr == nil {
+		kr = &csr.KeyRequest{}
+	}
+	if kr.Algo == "" {
+		current := *kr
+		current.Size = helpers.KeyLength(priv.Public())
+		switch priv.Public().(type) {
+		case *rsa.PublicKey:
+			current.Algo = "rsa"
+		case *ecdsa.PublicKey:
+			current.Algo = "ecdsa"
+		case ed25519.PublicKey:
+			current.Algo = "ed25519"
+		}
+		kr = &current
+	}
+	log.Infof("generating new CA key: %s-%d", kr.Algo, kr.Size)
+	generated, err := kr.Generate()
+	if err != nil {
+		err = cferr.New(cferr.PrivateKeyError, cferr.GenerationFailed, err)
+		return
+	}
+	newPriv, ok := generated.(crypto.Signer)
+	if !ok {
+		err = cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC, nil)
+		return
+	}
+	if key, err = kr.EncodeKey(newPriv); err != nil {
+		return
+	}
+
+	// The current certificate, self-signed with the new key, is
+	// renewed into the new root.
+	template := *ca
+	template.PublicKey = newPriv.Public()
+	template.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	template.SubjectKeyId = nil
+	template.AuthorityKeyId = nil
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, newPriv.Public(), newPriv)
+	if err != nil {
+		err = cferr.New(cferr.CertificateError, cferr.Unknown, err)
+		return
+	}
+	newCA, err := x509.ParseCertificate(der)
+	if err != nil {
+		err = cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
+		return
+	}
+	if cert, err = RenewFromSigner(newCA, newPriv); err != nil {
+		return
+	}
+
+	crossCert, err = crossSign(cert, ca, priv)
+	return
+}
+
+// crossSign issues the PEM-encoded root certificate again under the
+// CA, with a new serial number, and no longer valid than the CA. Its
+// path length is shortened to leave room under the CA's.
+func crossSign(certPEM []byte, ca *x509.Certificate, priv crypto.Signer) ([]byte, error) {
+	s, err := local.NewSigner(priv, ca, signer.DefaultSigAlgo(priv), CAPolicy)
+	if err != nil {
+		log.Errorf("failed to create signer: %v", err)
+		return nil, err
+	}
+
+	req := signer.SignRequest{Request: string(certPEM), CrossSign: true}
+	if ca.NotAfter.Before(time.Now().Add(CAPolicy.Default.Expiry)) {
+		req.NotAfter = ca.NotAfter
+	}
+	log.Infof("cross-signing the new root certificate")
+	return s.Sign(req)
+}
+
 // CAPolicy contains the CA issuing policy as default policy.
 var CAPolicy = &config.Signing{
 	Default: &config.SigningProfile{
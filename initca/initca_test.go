@@ -1,8 +1,12 @@
 package initca
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
 	"io/ioutil"
 	"testing"
 	"time"
@@ -11,6 +15,7 @@ import (
 	"github.com/cloudflare/cfssl/csr"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
 )
 
 type KeyRequest struct {
@@ -43,6 +48,9 @@ var validKeyParams = []KeyRequest{
 		keyAlgo: "ecdsa",
 		keyLen:  521,
 	},
+	{
+		keyAlgo: "ed25519",
+	},
 }
 
 var csrFiles = []string{
@@ -131,7 +139,10 @@ func TestInitCA(t *testing.T) {
 				CA:           true,
 			},
 		}
-		s := &signer.Signer{cert, key, CAPolicy, signer.DefaultSigAlgo(key)}
+		s, err := local.NewSigner(key.(crypto.Signer), cert, signer.DefaultSigAlgo(key), CAPolicy)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		// Sign RSA and ECDSA customer CSRs.
 		for _, csrFile := range csrFiles {
@@ -139,12 +150,12 @@ func TestInitCA(t *testing.T) {
 			if err != nil {
 				t.Fatal("CSR loading error:", err)
 			}
-			bytes, err := s.Sign(hostname, csrBytes, "")
+			bytes, err := s.Sign(signer.SignRequest{Hosts: []string{hostname}, Request: string(csrBytes)})
 			if err != nil {
 				t.Fatal(err)
 			}
 			customerCert, _ := helpers.ParseCertificatePEM(bytes)
-			if customerCert.SignatureAlgorithm != s.SigAlgo {
+			if customerCert.SignatureAlgorithm != s.SigAlgo() {
 				t.Fatal("Signature Algorithm mismatch")
 			}
 			err = customerCert.CheckSignatureFrom(cert)
@@ -181,6 +192,32 @@ func TestNoHostname(t *testing.T) {
 	}
 }
 
+func TestNewEncryptedKey(t *testing.T) {
+	req := &csr.CertificateRequest{
+		CN:    "cloudflare.com",
+		Hosts: []string{"cloudflare.com"},
+		KeyRequest: &csr.KeyRequest{
+			Format:   csr.KeyFormatEncryptedPKCS8,
+			Password: "password",
+		},
+	}
+	certPEM, keyPEM, err := New(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEMWithPassword(keyPEM, []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkKey(cert, key.(crypto.Signer)); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestInvalidCryptoParams(t *testing.T) {
 	var req *csr.CertificateRequest
 	hostname := "cloudflare.com"
@@ -208,3 +245,265 @@ func TestInvalidCryptoParams(t *testing.T) {
 		}
 	}
 }
+
+func TestNewIntermediate(t *testing.T) {
+	rootCert, rootKey, err := New(&csr.CertificateRequest{
+		CN:         "Test Root CA",
+		Hosts:      []string{"cloudflare.com"},
+		KeyRequest: &csr.KeyRequest{Algo: "ecdsa", Size: 256},
+		CA:         &csr.CAConfig{PathLength: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := helpers.ParseCertificatePEM(rootCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.MaxPathLen != 1 {
+		t.Fatalf("Unexpected root path length %d", root.MaxPathLen)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{
+			"intermediate": CAPolicy.Default,
+		},
+		Default: &config.SigningProfile{
+			Usage:  []string{"server auth"},
+			Expiry: time.Hour,
+		},
+	}
+	s, err := local.NewSigner(key.(crypto.Signer), root, signer.DefaultSigAlgo(key), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &csr.CertificateRequest{
+		CN:         "Test Intermediate CA",
+		KeyRequest: &csr.KeyRequest{Algo: "ecdsa", Size: 256},
+		CA:         &csr.CAConfig{PathLenZero: true},
+	}
+	keyBytes, csrBytes, certBytes, chain, err := NewIntermediate(req, s, "intermediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = helpers.ParsePrivateKeyPEM(keyBytes); err != nil {
+		t.Fatal(err)
+	}
+	if len(csrBytes) == 0 {
+		t.Fatal("No certificate request returned.")
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cert.CheckSignatureFrom(root); err != nil {
+		t.Fatal(err)
+	}
+	if !cert.IsCA || cert.MaxPathLen != 0 || !cert.MaxPathLenZero {
+		t.Fatalf("Unexpected intermediate path length %d", cert.MaxPathLen)
+	}
+
+	certs, err := helpers.ParseCertificatesPEM(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(cert) || !certs[1].Equal(root) {
+		t.Fatal("Unexpected chain of the intermediate.")
+	}
+
+	// Intermediates are only signed under CA profiles, and need a
+	// common name.
+	if _, _, _, _, err = NewIntermediate(req, s, ""); err == nil {
+		t.Fatal("Expected error signing an intermediate under a leaf profile.")
+	}
+	req.CN = ""
+	if _, _, _, _, err = NewIntermediate(req, s, "intermediate"); err == nil {
+		t.Fatal("Expected error creating an intermediate without a common name.")
+	}
+}
+
+// newTestRoot creates a root CA with a path length of one, returning
+// its certificate and key.
+func newTestRoot(t *testing.T) (*x509.Certificate, crypto.Signer) {
+	certPEM, keyPEM, err := New(&csr.CertificateRequest{
+		CN:         "Test Root CA",
+		Hosts:      []string{"cloudflare.com"},
+		KeyRequest: &csr.KeyRequest{Algo: "ecdsa", Size: 256},
+		CA:         &csr.CAConfig{PathLength: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key.(crypto.Signer)
+}
+
+func TestRenew(t *testing.T) {
+	ca, priv := newTestRoot(t)
+
+	certPEM, err := RenewFromSigner(ca, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.RawSubject, ca.RawSubject) || !bytes.Equal(cert.RawSubjectPublicKeyInfo, ca.RawSubjectPublicKeyInfo) ||
+		!bytes.Equal(cert.SubjectKeyId, ca.SubjectKeyId) {
+		t.Fatal("Renewed certificate does not keep the subject and key of the CA.")
+	}
+	if cert.SerialNumber.Cmp(ca.SerialNumber) == 0 {
+		t.Fatal("Renewed certificate has the serial number of the CA.")
+	}
+	if !cert.IsCA || cert.MaxPathLen != 1 {
+		t.Fatalf("Unexpected constraints of the renewed certificate: %v %d", cert.IsCA, cert.MaxPathLen)
+	}
+	if err = cert.CheckSignatureFrom(cert); err != nil {
+		t.Fatal(err)
+	}
+
+	// Certificates issued by the CA chain to the renewed certificate.
+	s, err := local.NewSigner(priv, ca, signer.DefaultSigAlgo(priv), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafPEM, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := helpers.ParseCertificatePEM(leafPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = leaf.CheckSignatureFrom(cert); err != nil {
+		t.Fatal(err)
+	}
+
+	// A key identifier not derived the way cfssl derives them is
+	// kept too.
+	template := *ca
+	template.SubjectKeyId = []byte("foreign key id")
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, priv.Public(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certPEM, err = RenewFromSigner(foreign, priv); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = helpers.ParseCertificatePEM(certPEM); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.SubjectKeyId, foreign.SubjectKeyId) {
+		t.Fatalf("Renewed certificate does not keep the key identifier %x of the CA: %x", foreign.SubjectKeyId, cert.SubjectKeyId)
+	}
+
+	_, other := newTestRoot(t)
+	if _, err = RenewFromSigner(ca, other); err == nil {
+		t.Fatal("Expected error renewing a CA with another key.")
+	}
+}
+
+func TestRekey(t *testing.T) {
+	ca, priv := newTestRoot(t)
+
+	certPEM, crossPEM, keyPEM, err := RekeyFromSigner(ca, priv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		t.Fatal("New key is not of the kind of the CA key.")
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.RawSubject, ca.RawSubject) || bytes.Equal(cert.RawSubjectPublicKeyInfo, ca.RawSubjectPublicKeyInfo) {
+		t.Fatal("New root does not have the subject of the CA and a new key.")
+	}
+	if err = cert.CheckSignatureFrom(cert); err != nil {
+		t.Fatal(err)
+	}
+
+	cross, err := helpers.ParseCertificatePEM(crossPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cross.RawSubjectPublicKeyInfo, cert.RawSubjectPublicKeyInfo) || !bytes.Equal(cross.SubjectKeyId, cert.SubjectKeyId) {
+		t.Fatal("Cross-signed certificate is not for the new key.")
+	}
+	if err = cross.CheckSignatureFrom(ca); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cross.AuthorityKeyId, ca.SubjectKeyId) || cross.NotAfter.After(ca.NotAfter) {
+		t.Fatal("Cross-signed certificate does not chain to the CA.")
+	}
+	if !cross.IsCA || cross.MaxPathLen != 0 || !cross.MaxPathLenZero {
+		t.Fatalf("Cross-signed certificate does not fit under the path length of the CA: %d", cross.MaxPathLen)
+	}
+
+	// Certificates issued under the new key chain to the old root
+	// through the cross-signed certificate.
+	s, err := local.NewSigner(key.(crypto.Signer), cert, signer.DefaultSigAlgo(key), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafPEM, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := helpers.ParseCertificatePEM(leafPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(ca)
+	intermediates.AddCert(cross)
+	if _, err = leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "cloudflare.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A key request may only set the format of the new key.
+	_, _, keyPEM, err = RekeyFromSigner(ca, priv, &csr.KeyRequest{Format: csr.KeyFormatPKCS8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err = helpers.ParsePrivateKeyPEM(keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		t.Fatal("New key is not of the kind of the CA key.")
+	}
+
+	if _, _, _, err = RekeyFromSigner(ca, priv, &csr.KeyRequest{Algo: "rsa", Size: 1024}); err == nil {
+		t.Fatal("Expected error rekeying with a weak key.")
+	}
+}
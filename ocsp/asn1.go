@@ -0,0 +1,277 @@
+package ocsp
+
+// In this file, we cover the ASN.1 structures defined by RFC 6960 and
+// the parsing of OCSP requests and responses built from them.
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+)
+
+var (
+	idPKIXOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	idSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+// successful is the responseStatus of an OCSPResponse carrying a
+// signed BasicOCSPResponse.
+const successful = 0
+
+type certID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type request struct {
+	Cert certID
+}
+
+type tbsRequest struct {
+	Version       int              `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName pkix.RDNSequence `asn1:"explicit,tag:1,optional"`
+	RequestList   []request
+}
+
+type ocspRequest struct {
+	TBSRequest tbsRequest
+}
+
+type responseASN1 struct {
+	Status   asn1.Enumerated
+	Response responseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type responseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicResponse struct {
+	TBSResponseData    responseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type responseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []singleResponse
+}
+
+type singleResponse struct {
+	CertID           certID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          revokedInfo      `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type revokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// subjectPublicKeyInfo is used to pull the raw public key bits out of
+// a certificate; the key hash in a CertID is computed over them.
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// keyHash returns the SHA-1 hash of the certificate's public key, as
+// used in both the CertID and the byKey ResponderID.
+func keyHash(cert *x509.Certificate) ([]byte, error) {
+	return keyHashWith(cert, crypto.SHA1)
+}
+
+// keyHashWith returns the hash of the certificate's public key with
+// the given hash function, as used in a CertID of that algorithm.
+func keyHashWith(cert *x509.Certificate, hash crypto.Hash) ([]byte, error) {
+	var spki subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(spki.PublicKey.RightAlign())
+	return h.Sum(nil), nil
+}
+
+// newCertID builds the SHA-1 CertID identifying the serial number
+// under the given issuer.
+func newCertID(issuer *x509.Certificate, serial *big.Int) (certID, error) {
+	issuerKeyHash, err := keyHash(issuer)
+	if err != nil {
+		return certID{}, err
+	}
+	issuerNameHash := sha1.Sum(issuer.RawSubject)
+	return certID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  idSHA1,
+			Parameters: asn1.RawValue{Tag: asn1.TagNull},
+		},
+		IssuerNameHash: issuerNameHash[:],
+		IssuerKeyHash:  issuerKeyHash,
+		SerialNumber:   serial,
+	}, nil
+}
+
+// A Request is a parsed OCSP request for the status of a single
+// certificate.
+type Request struct {
+	HashAlgorithm  crypto.Hash
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+// ParseRequest parses a DER-encoded OCSP request. Only requests for a
+// single certificate are supported.
+func ParseRequest(der []byte) (*Request, error) {
+	var req ocspRequest
+	rest, err := asn1.Unmarshal(der, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("ocsp: trailing data in OCSP request")
+	}
+	if len(req.TBSRequest.RequestList) != 1 {
+		return nil, errors.New("ocsp: only single certificate requests are supported")
+	}
+
+	id := req.TBSRequest.RequestList[0].Cert
+	hash, ok := hashOIDs[id.HashAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, errors.New("ocsp: unsupported hash algorithm in OCSP request")
+	}
+	return &Request{
+		HashAlgorithm:  hash,
+		IssuerNameHash: id.IssuerNameHash,
+		IssuerKeyHash:  id.IssuerKeyHash,
+		SerialNumber:   id.SerialNumber,
+	}, nil
+}
+
+// hashOIDs maps the hash algorithms that may be used in a CertID to
+// their implementations.
+var hashOIDs = map[string]crypto.Hash{
+	idSHA1.String():          crypto.SHA1,
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+// A Response is a parsed OCSP response for a single certificate.
+type Response struct {
+	Status       int
+	SerialNumber *big.Int
+	// IssuerKeyHash is the hash of the issuer's public key in the
+	// CertID of the response, computed with HashAlgorithm.
+	IssuerKeyHash    []byte
+	HashAlgorithm    crypto.Hash
+	ProducedAt       time.Time
+	ThisUpdate       time.Time
+	NextUpdate       time.Time
+	RevokedAt        time.Time
+	RevocationReason int
+	// Certificate is the delegated responder certificate, if one
+	// was included in the response.
+	Certificate *x509.Certificate
+}
+
+// ParseResponse parses a DER-encoded OCSP response containing the
+// status of a single certificate. If issuer is not nil, the
+// signature on the response is checked against either the issuer or
+// the delegated responder certificate embedded in the response; a
+// delegated responder must itself be signed by the issuer.
+func ParseResponse(der []byte, issuer *x509.Certificate) (*Response, error) {
+	var resp responseASN1
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("ocsp: trailing data in OCSP response")
+	}
+	if resp.Status != successful {
+		return nil, errors.New("ocsp: OCSP response is not successful")
+	}
+	if !resp.Response.ResponseType.Equal(idPKIXOCSPBasic) {
+		return nil, errors.New("ocsp: OCSP response is not a basic response")
+	}
+
+	var basic basicResponse
+	rest, err = asn1.Unmarshal(resp.Response.Response, &basic)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("ocsp: trailing data in basic OCSP response")
+	}
+	if len(basic.TBSResponseData.Responses) != 1 {
+		return nil, errors.New("ocsp: OCSP response contains more than one certificate status")
+	}
+
+	single := basic.TBSResponseData.Responses[0]
+	hash, ok := hashOIDs[single.CertID.HashAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, errors.New("ocsp: unsupported hash algorithm in OCSP response")
+	}
+	r := &Response{
+		SerialNumber:  single.CertID.SerialNumber,
+		IssuerKeyHash: single.CertID.IssuerKeyHash,
+		HashAlgorithm: hash,
+		ProducedAt:    basic.TBSResponseData.ProducedAt,
+		ThisUpdate:    single.ThisUpdate,
+		NextUpdate:    single.NextUpdate,
+	}
+	switch {
+	case bool(single.Good):
+		r.Status = Good
+	case bool(single.Unknown):
+		r.Status = Unknown
+	default:
+		r.Status = Revoked
+		r.RevokedAt = single.Revoked.RevocationTime
+		r.RevocationReason = int(single.Revoked.Reason)
+	}
+
+	if len(basic.Certificates) > 0 {
+		r.Certificate, err = x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if issuer != nil {
+		signer := issuer
+		if r.Certificate != nil {
+			if err = r.Certificate.CheckSignatureFrom(issuer); err != nil {
+				return nil, err
+			}
+			signer = r.Certificate
+		}
+
+		algo, ok := signatureAlgorithmFromOID(basic.SignatureAlgorithm.Algorithm)
+		if !ok {
+			return nil, x509.ErrUnsupportedAlgorithm
+		}
+		err = signer.CheckSignature(algo, basic.TBSResponseData.Raw, basic.Signature.RightAlign())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
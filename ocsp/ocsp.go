@@ -0,0 +1,374 @@
+// Package ocsp implements OCSP response signing for CF-SSL. Responses
+// may be signed directly by the issuing CA, or by a delegated
+// responder certificate issued by the CA for that purpose.
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// The certificate statuses that may be reported in an OCSP response.
+const (
+	Good = iota
+	Revoked
+	Unknown
+)
+
+// StatusCode maps the names used by the command line tool and the
+// API to OCSP certificate statuses.
+var StatusCode = map[string]int{
+	"good":    Good,
+	"revoked": Revoked,
+	"unknown": Unknown,
+}
+
+// RevocationReasonCodes maps the names used by the command line tool
+// and the API to the CRLReason codes defined in RFC 5280, section
+// 5.3.1.
+var RevocationReasonCodes = map[string]int{
+	"unspecified":          0,
+	"keycompromise":        1,
+	"cacompromise":         2,
+	"affiliationchanged":   3,
+	"superseded":           4,
+	"cessationofoperation": 5,
+	"certificatehold":      6,
+	"removefromcrl":        8,
+	"privilegewithdrawn":   9,
+	"aacompromise":         10,
+}
+
+// ReasonStringToCode translates a revocation reason, given either by
+// name or by its numeric code, to its RFC 5280 code.
+func ReasonStringToCode(reason string) (int, error) {
+	if reason == "" {
+		return 0, nil
+	}
+	if code, ok := RevocationReasonCodes[strings.ToLower(reason)]; ok {
+		return code, nil
+	}
+	code, err := strconv.Atoi(reason)
+	if err != nil || code < 0 || code > 10 || code == 7 {
+		return 0, cferr.New(cferr.OCSPError, cferr.InvalidStatus,
+			errors.New("invalid revocation reason "+reason))
+	}
+	return code, nil
+}
+
+// A SignRequest contains the certificate whose status is being
+// reported and the status to report. The revocation time and reason
+// are only used for revoked certificates. If ThisUpdate is not set,
+// the current time is used; if NextUpdate is not set, it is
+// computed from the signer's interval.
+type SignRequest struct {
+	Certificate *x509.Certificate
+	Status      string
+	Reason      int
+	RevokedAt   time.Time
+	ThisUpdate  time.Time
+	NextUpdate  time.Time
+}
+
+// NewSignRequestFromDB returns a sign request reporting the status
+// that the certificate database records for cert, which is looked up
+// by its serial number and authority key identifier.
+func NewSignRequestFromDB(db certdb.Accessor, cert *x509.Certificate) (SignRequest, error) {
+	records, err := db.GetCertificate(cert.SerialNumber.String(), hex.EncodeToString(cert.AuthorityKeyId))
+	if err != nil {
+		return SignRequest{}, err
+	}
+	if len(records) == 0 {
+		return SignRequest{}, cferr.New(cferr.CertStoreError, cferr.RecordNotFound, nil)
+	}
+
+	cr := records[0]
+	return SignRequest{
+		Certificate: cert,
+		Status:      cr.Status,
+		Reason:      cr.Reason,
+		RevokedAt:   cr.RevokedAt,
+	}, nil
+}
+
+// A Signer produces DER-encoded OCSP responses from sign requests.
+type Signer struct {
+	issuer    *x509.Certificate
+	responder *x509.Certificate
+	key       crypto.Signer
+	sigAlgo   x509.SignatureAlgorithm
+	interval  time.Duration
+}
+
+// NewSignerFromFile reads the issuer certificate, the responder
+// certificate and the responder's private key from PEM-encoded files
+// and returns a new Signer. If responderFile is empty, the issuer
+// certificate is used as the responder, and keyFile should contain
+// the CA's private key.
+func NewSignerFromFile(issuerFile, responderFile, keyFile string, interval time.Duration) (*Signer, error) {
+	log.Debug("Loading issuer certificate: ", issuerFile)
+	issuerPEM, err := ioutil.ReadFile(issuerFile)
+	if err != nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.ReadFailed, err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	responder := issuer
+	if responderFile != "" {
+		log.Debug("Loading responder certificate: ", responderFile)
+		responderPEM, err := ioutil.ReadFile(responderFile)
+		if err != nil {
+			return nil, cferr.New(cferr.CertificateError, cferr.ReadFailed, err)
+		}
+		responder, err = helpers.ParseCertificatePEM(responderPEM)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Debug("Loading responder key: ", keyFile)
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.ReadFailed, err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigner(issuer, responder, key, interval)
+}
+
+// NewSigner returns a new Signer for responses about certificates
+// issued by issuer, signed by the responder certificate's private
+// key. A responder other than the issuer must be signed by the
+// issuer and carry the OCSP signing extended key usage.
+func NewSigner(issuer, responder *x509.Certificate, key interface{}, interval time.Duration) (*Signer, error) {
+	priv, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC, nil)
+	}
+	if !publicKeysEqual(responder.PublicKey, priv.Public()) {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.KeyMismatch, nil)
+	}
+
+	if !responder.Equal(issuer) {
+		if err := responder.CheckSignatureFrom(issuer); err != nil {
+			return nil, cferr.New(cferr.OCSPError, cferr.IssuerMismatch, err)
+		}
+		if !hasOCSPSigning(responder) {
+			return nil, cferr.New(cferr.OCSPError, cferr.IssuerMismatch,
+				errors.New("responder certificate is not authorised for OCSP signing"))
+		}
+	}
+
+	return &Signer{
+		issuer:    issuer,
+		responder: responder,
+		key:       priv,
+		sigAlgo:   signer.DefaultSigAlgo(key),
+		interval:  interval,
+	}, nil
+}
+
+func publicKeysEqual(a, b interface{}) bool {
+	aDER, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bDER, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aDER, bDER)
+}
+
+func hasOCSPSigning(cert *x509.Certificate) bool {
+	for _, eku := range cert.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign builds and signs an OCSP response for the certificate in the
+// request, returning the DER-encoded response.
+func (s *Signer) Sign(req SignRequest) ([]byte, error) {
+	if req.Certificate == nil {
+		return nil, cferr.New(cferr.OCSPError, cferr.Unknown, errors.New("no certificate in request"))
+	}
+	if err := req.Certificate.CheckSignatureFrom(s.issuer); err != nil {
+		return nil, cferr.New(cferr.OCSPError, cferr.IssuerMismatch, err)
+	}
+
+	status, ok := StatusCode[req.Status]
+	if !ok {
+		return nil, cferr.New(cferr.OCSPError, cferr.InvalidStatus, nil)
+	}
+
+	id, err := newCertID(s.issuer, req.Certificate.SerialNumber)
+	if err != nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
+	}
+
+	now := time.Now().UTC()
+	thisUpdate := req.ThisUpdate
+	if thisUpdate.IsZero() {
+		thisUpdate = now
+	}
+	nextUpdate := req.NextUpdate
+	if nextUpdate.IsZero() && s.interval > 0 {
+		nextUpdate = thisUpdate.Add(s.interval)
+	}
+
+	single := singleResponse{
+		CertID:     id,
+		ThisUpdate: thisUpdate.UTC(),
+		NextUpdate: nextUpdate.UTC(),
+	}
+	switch status {
+	case Good:
+		single.Good = true
+	case Unknown:
+		single.Unknown = true
+	case Revoked:
+		revokedAt := req.RevokedAt
+		if revokedAt.IsZero() {
+			revokedAt = now
+		}
+		single.Revoked = revokedInfo{
+			RevocationTime: revokedAt.UTC(),
+			Reason:         asn1.Enumerated(req.Reason),
+		}
+	}
+
+	responderKeyHash, err := keyHash(s.responder)
+	if err != nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
+	}
+	responderID, err := asn1.Marshal(responderKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	tbs := responseData{
+		RawResponderID: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        2,
+			IsCompound: true,
+			Bytes:      responderID,
+		},
+		ProducedAt: now,
+		Responses:  []singleResponse{single},
+	}
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, err
+	}
+
+	algo, hash, err := signatureAlgorithmIdentifier(s.sigAlgo)
+	if err != nil {
+		return nil, err
+	}
+	// Ed25519 signs the response data itself rather than a digest.
+	signed := tbsDER
+	if hash != 0 {
+		h := hash.New()
+		h.Write(tbsDER)
+		signed = h.Sum(nil)
+	}
+	signature, err := s.key.Sign(rand.Reader, signed, hash)
+	if err != nil {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+
+	basic := basicResponse{
+		TBSResponseData:    responseData{Raw: tbsDER},
+		SignatureAlgorithm: algo,
+		Signature: asn1.BitString{
+			Bytes:     signature,
+			BitLength: 8 * len(signature),
+		},
+	}
+	if !s.responder.Equal(s.issuer) {
+		basic.Certificates = []asn1.RawValue{{FullBytes: s.responder.Raw}}
+	}
+	basicDER, err := asn1.Marshal(basic)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(responseASN1{
+		Status: successful,
+		Response: responseBytes{
+			ResponseType: idPKIXOCSPBasic,
+			Response:     basicDER,
+		},
+	})
+}
+
+// signatureAlgorithms lists the signature algorithms a response may
+// be signed with, along with their OIDs and hash functions. Ed25519
+// has no separate hash function.
+var signatureAlgorithms = []struct {
+	algo x509.SignatureAlgorithm
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{x509.SHA1WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, crypto.SHA1},
+	{x509.SHA256WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, crypto.SHA256},
+	{x509.SHA384WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, crypto.SHA384},
+	{x509.SHA512WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, crypto.SHA512},
+	{x509.ECDSAWithSHA1, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, crypto.SHA1},
+	{x509.ECDSAWithSHA256, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, crypto.SHA256},
+	{x509.ECDSAWithSHA384, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, crypto.SHA384},
+	{x509.ECDSAWithSHA512, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, crypto.SHA512},
+	{x509.PureEd25519, asn1.ObjectIdentifier{1, 3, 101, 112}, crypto.Hash(0)},
+}
+
+// signatureAlgorithmIdentifier returns the AlgorithmIdentifier and
+// hash function for the signature algorithm. RSA algorithm
+// identifiers carry explicit NULL parameters.
+func signatureAlgorithmIdentifier(sigAlgo x509.SignatureAlgorithm) (pkix.AlgorithmIdentifier, crypto.Hash, error) {
+	for _, details := range signatureAlgorithms {
+		if details.algo != sigAlgo {
+			continue
+		}
+		ai := pkix.AlgorithmIdentifier{Algorithm: details.oid}
+		switch sigAlgo {
+		case x509.SHA1WithRSA, x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA:
+			ai.Parameters = asn1.RawValue{Tag: asn1.TagNull}
+		}
+		return ai, details.hash, nil
+	}
+	return pkix.AlgorithmIdentifier{}, 0, x509.ErrUnsupportedAlgorithm
+}
+
+func signatureAlgorithmFromOID(oid asn1.ObjectIdentifier) (x509.SignatureAlgorithm, bool) {
+	for _, details := range signatureAlgorithms {
+		if details.oid.Equal(oid) {
+			return details.algo, true
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, false
+}
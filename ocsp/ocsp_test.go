@@ -0,0 +1,233 @@
+package ocsp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/file"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+const (
+	testCaFile           = "testdata/ca.pem"
+	testCaKeyFile        = "testdata/ca-key.pem"
+	testCertFile         = "testdata/cert.pem"
+	testResponderFile    = "testdata/responder.pem"
+	testResponderKeyFile = "testdata/responder-key.pem"
+	testEd25519CaFile    = "testdata/ed25519-ca.pem"
+	testEd25519CaKeyFile = "testdata/ed25519-ca-key.pem"
+)
+
+var interval = 96 * time.Hour
+
+func loadCert(t *testing.T, file string) []byte {
+	certPEM, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPEM
+}
+
+func newSignRequest(t *testing.T, status string) SignRequest {
+	cert, err := helpers.ParseCertificatePEM(loadCert(t, testCertFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SignRequest{
+		Certificate: cert,
+		Status:      status,
+	}
+}
+
+func TestNewSignerFromFile(t *testing.T) {
+	if _, err := NewSignerFromFile(testCaFile, "", testCaKeyFile, interval); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSignerFromFile(testCaFile, testResponderFile, testResponderKeyFile, interval); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewSignerErrors(t *testing.T) {
+	// The responder key does not belong to the CA.
+	if _, err := NewSignerFromFile(testCaFile, "", testResponderKeyFile, interval); err == nil {
+		t.Fatal("Expected key mismatch error.")
+	}
+	// The leaf certificate is not authorised to sign OCSP responses.
+	if _, err := NewSignerFromFile(testCaFile, testCertFile, testCaKeyFile, interval); err == nil {
+		t.Fatal("Expected error for unauthorised responder.")
+	}
+}
+
+func TestSign(t *testing.T) {
+	issuer, err := helpers.ParseCertificatePEM(loadCert(t, testCaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, responderFiles := range [][2]string{
+		{"", testCaKeyFile},
+		{testResponderFile, testResponderKeyFile},
+	} {
+		s, err := NewSignerFromFile(testCaFile, responderFiles[0], responderFiles[1], interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, status := range StatusCode {
+			req := newSignRequest(t, name)
+			if status == Revoked {
+				req.Reason = RevocationReasonCodes["keycompromise"]
+				req.RevokedAt = time.Now().Add(-time.Hour)
+			}
+			der, err := s.Sign(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := ParseResponse(der, issuer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != status {
+				t.Fatalf("Expected status %d, got %d.", status, resp.Status)
+			}
+			if resp.SerialNumber.Cmp(req.Certificate.SerialNumber) != 0 {
+				t.Fatal("Serial number mismatch.")
+			}
+			if resp.NextUpdate.Sub(resp.ThisUpdate) != interval {
+				t.Fatal("nextUpdate should be thisUpdate plus the interval.")
+			}
+			if status == Revoked && resp.RevocationReason != req.Reason {
+				t.Fatal("Revocation reason mismatch.")
+			}
+			if responderFiles[0] != "" && resp.Certificate == nil {
+				t.Fatal("Delegated responder certificate is missing from the response.")
+			}
+		}
+	}
+}
+
+func TestSignEd25519(t *testing.T) {
+	s, err := NewSignerFromFile(testEd25519CaFile, "", testEd25519CaKeyFile, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "ed25519.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.issuer, key.Public(), s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Sign(SignRequest{Certificate: cert, Status: "good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseResponse(resp, s.issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Status != Good || parsed.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Fatalf("Unexpected response %+v", parsed)
+	}
+}
+
+func TestSignInvalidStatus(t *testing.T) {
+	s, err := NewSignerFromFile(testCaFile, "", testCaKeyFile, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sign(newSignRequest(t, "bogus")); err == nil {
+		t.Fatal("Expected error for invalid status.")
+	}
+}
+
+func TestSignWrongIssuer(t *testing.T) {
+	s, err := NewSignerFromFile(testCaFile, "", testCaKeyFile, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := helpers.ParseCertificatePEM(loadCert(t, testResponderFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sign(SignRequest{Certificate: ca, Status: "good"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewSignerFromFile(testResponderFile, "", testResponderKeyFile, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sign(newSignRequest(t, "good")); err == nil {
+		t.Fatal("Expected error for certificate from another issuer.")
+	}
+}
+
+func TestNewSignRequestFromDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-ocsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := file.NewAccessor(filepath.Join(dir, "certs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := newSignRequest(t, "").Certificate
+	if _, err = NewSignRequestFromDB(db, cert); err == nil {
+		t.Fatal("Expected error for a certificate missing from the database.")
+	}
+
+	cr := certdb.CertificateRecord{
+		Serial: cert.SerialNumber.String(),
+		AKI:    hex.EncodeToString(cert.AuthorityKeyId),
+		Status: certdb.StatusGood,
+		Expiry: cert.NotAfter,
+	}
+	if err = db.InsertCertificate(cr); err != nil {
+		t.Fatal(err)
+	}
+	req, err := NewSignRequestFromDB(db, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != "good" || req.Certificate != cert {
+		t.Fatalf("Unexpected sign request %+v", req)
+	}
+
+	if err = db.RevokeCertificate(cr.Serial, cr.AKI, RevocationReasonCodes["superseded"]); err != nil {
+		t.Fatal(err)
+	}
+	if req, err = NewSignRequestFromDB(db, cert); err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != "revoked" || req.Reason != RevocationReasonCodes["superseded"] || req.RevokedAt.IsZero() {
+		t.Fatalf("Unexpected sign request %+v", req)
+	}
+}
@@ -0,0 +1,249 @@
+package ocsp
+
+// In this file, we cover the OCSP responder: an HTTP server that
+// answers RFC 6960 requests with pre-signed responses.
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+)
+
+// The responseStatus values of an OCSPResponse that carry no signed
+// response; these responses are the same for every request, so they
+// are kept pre-encoded.
+var (
+	malformedRequestResponse = []byte{0x30, 0x03, 0x0A, 0x01, 0x01}
+	internalErrorResponse    = []byte{0x30, 0x03, 0x0A, 0x01, 0x02}
+	unauthorizedResponse     = []byte{0x30, 0x03, 0x0A, 0x01, 0x06}
+)
+
+// A Source is a source of pre-signed OCSP responses. Response returns
+// the DER-encoded response for the request, and false if no response
+// is available for it.
+type Source interface {
+	Response(*Request) ([]byte, bool)
+}
+
+// An InMemorySource is a Source holding responses keyed by the
+// certificate they cover: the hex-encoded hash of its issuer's key, a
+// colon and its hex-encoded serial number. Certificates of different
+// issuers with the same serial number thus have their own responses;
+// a response may be stored under the key hashes of several hash
+// algorithms.
+type InMemorySource map[string][]byte
+
+// sourceKey returns the key of the response for the certificate with
+// the serial number, issued under the key with the hash.
+func sourceKey(issuerKeyHash []byte, serial *big.Int) string {
+	return fmt.Sprintf("%x:%x", issuerKeyHash, serial)
+}
+
+// Response looks up the response for the issuer key hash and serial
+// number in the request, whichever hash algorithm computed the key
+// hash, as long as the response is stored under a key hash of that
+// algorithm.
+func (src InMemorySource) Response(req *Request) ([]byte, bool) {
+	resp, ok := src[sourceKey(req.IssuerKeyHash, req.SerialNumber)]
+	return resp, ok
+}
+
+// certIDHashes lists the hash algorithms a CertID may use.
+var certIDHashes = []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// NewSourceFromFile reads a file of base64-encoded OCSP responses,
+// one per line, such as the output of 'cfssl ocspsign', and returns
+// an InMemorySource serving them. Blank lines are skipped; if a
+// certificate has several responses, the last one wins.
+//
+// Without issuers, a response only answers requests identifying the
+// issuer with the hash algorithm of the response, SHA-1 for those of
+// 'cfssl ocspsign'. Otherwise, each response must be signed for one
+// of the issuers, and answers requests using any of SHA-1, SHA-256,
+// SHA-384 and SHA-512.
+func NewSourceFromFile(responseFile string, issuers []*x509.Certificate) (InMemorySource, error) {
+	f, err := os.Open(responseFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src := InMemorySource{}
+	loaded := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		der, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", responseFile, lineNo, err)
+		}
+		resp, err := ParseResponse(der, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", responseFile, lineNo, err)
+		}
+		keyHashes, err := responseKeyHashes(resp, der, issuers)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", responseFile, lineNo, err)
+		}
+		for _, h := range keyHashes {
+			src[sourceKey(h, resp.SerialNumber)] = der
+		}
+		loaded++
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	log.Infof("loaded %d OCSP responses from %s", loaded, responseFile)
+	return src, nil
+}
+
+// responseKeyHashes returns the issuer key hashes that the response
+// is stored under: its own, and, if it is signed for one of the
+// issuers, those of the issuer's key for every CertID hash algorithm.
+func responseKeyHashes(resp *Response, der []byte, issuers []*x509.Certificate) ([][]byte, error) {
+	if len(issuers) == 0 {
+		return [][]byte{resp.IssuerKeyHash}, nil
+	}
+
+	for _, issuer := range issuers {
+		h, err := keyHashWith(issuer, resp.HashAlgorithm)
+		if err != nil || !bytes.Equal(h, resp.IssuerKeyHash) {
+			continue
+		}
+		if _, err = ParseResponse(der, issuer); err != nil {
+			return nil, err
+		}
+
+		var keyHashes [][]byte
+		for _, hash := range certIDHashes {
+			if h, err = keyHashWith(issuer, hash); err != nil {
+				return nil, err
+			}
+			keyHashes = append(keyHashes, h)
+		}
+		return keyHashes, nil
+	}
+	return nil, errors.New("response is not for a certificate of any of the issuers")
+}
+
+// A Responder answers OCSP requests over HTTP, as described in RFC
+// 6960 appendix A, with responses looked up from its Source. Prefix is
+// the URL path the responder is mounted at, which precedes the
+// base64-encoded request of a GET.
+type Responder struct {
+	Source Source
+	Prefix string
+}
+
+// NewResponder returns a Responder serving responses from source,
+// mounted at the URL path prefix.
+func NewResponder(source Source, prefix string) *Responder {
+	return &Responder{Source: source, Prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// readRequest extracts the DER-encoded OCSP request from either the
+// path of a GET request or the body of a POST request.
+func (rs *Responder) readRequest(r *http.Request) ([]byte, error) {
+	switch r.Method {
+	case "GET":
+		// Any URL encoding on top of the base64 encoding has
+		// already been undone in the parsed path. The base64
+		// encoding may itself contain slashes, so the request is
+		// all of the path after the prefix.
+		if !strings.HasPrefix(r.URL.Path, rs.Prefix+"/") {
+			return nil, errors.New("request path outside of " + rs.Prefix + "/")
+		}
+		return base64.StdEncoding.DecodeString(strings.TrimPrefix(r.URL.Path, rs.Prefix+"/"))
+	case "POST":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		return body, nil
+	default:
+		return nil, errors.New("unsupported method")
+	}
+}
+
+// ServeHTTP answers a single OCSP request. Successful responses carry
+// caching headers derived from their thisUpdate and nextUpdate times,
+// so that intermediate HTTP caches may serve them until they expire.
+func (rs *Responder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := rs.respond(w, r)
+	log.Infof("%s - \"%s %s\" %d", r.RemoteAddr, r.Method, r.URL, status)
+}
+
+func (rs *Responder) respond(w http.ResponseWriter, r *http.Request) int {
+	if r.Method != "GET" && r.Method != "POST" {
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return http.StatusMethodNotAllowed
+	}
+
+	w.Header().Set("Content-Type", "application/ocsp-response")
+
+	der, err := rs.readRequest(r)
+	if err != nil {
+		log.Warningf("failed to read OCSP request: %v", err)
+		w.Write(malformedRequestResponse)
+		return http.StatusOK
+	}
+
+	req, err := ParseRequest(der)
+	if err != nil {
+		log.Warningf("failed to parse OCSP request: %v", err)
+		w.Write(malformedRequestResponse)
+		return http.StatusOK
+	}
+
+	resp, ok := rs.Source.Response(req)
+	if !ok {
+		log.Infof("no response found for serial %x", req.SerialNumber)
+		w.Write(unauthorizedResponse)
+		return http.StatusOK
+	}
+
+	parsed, err := ParseResponse(resp, nil)
+	if err != nil {
+		log.Errorf("stored OCSP response for serial %x is invalid: %v", req.SerialNumber, err)
+		w.Write(internalErrorResponse)
+		return http.StatusOK
+	}
+
+	now := time.Now()
+	w.Header().Set("Last-Modified", parsed.ThisUpdate.UTC().Format(http.TimeFormat))
+	if !parsed.NextUpdate.IsZero() {
+		maxAge := 0
+		if parsed.NextUpdate.After(now) {
+			maxAge = int(parsed.NextUpdate.Sub(now) / time.Second)
+		}
+		w.Header().Set("Expires", parsed.NextUpdate.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control",
+			fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", maxAge))
+	} else {
+		w.Header().Set("Cache-Control", "max-age=0, no-cache")
+	}
+	w.Header().Set("ETag", fmt.Sprintf("\"%X\"", sha256.Sum256(resp)))
+
+	w.Write(resp)
+	return http.StatusOK
+}
@@ -0,0 +1,289 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// newTestSource signs a good response for the test certificate and
+// loads it through a response file, for the given issuers.
+func newTestSource(t *testing.T, issuers []*x509.Certificate) InMemorySource {
+	s, err := NewSignerFromFile(testCaFile, "", testCaKeyFile, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.Sign(newSignRequest(t, "good"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "cfssl-ocsp-responses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("\n" + base64.StdEncoding.EncodeToString(resp) + "\n")
+	f.Close()
+
+	src, err := NewSourceFromFile(f.Name(), issuers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func loadTestIssuer(t *testing.T, file string) *x509.Certificate {
+	issuer, err := helpers.ParseCertificatePEM(loadCert(t, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+// newTestRequest builds a DER-encoded OCSP request for the test
+// certificate.
+func newTestRequest(t *testing.T) []byte {
+	cert, err := helpers.ParseCertificatePEM(loadCert(t, testCertFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := newCertID(loadTestIssuer(t, testCaFile), cert.SerialNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(ocspRequest{tbsRequest{RequestList: []request{{id}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// newSHA256TestRequest builds a DER-encoded OCSP request for the test
+// certificate whose CertID uses SHA-256 hashes.
+func newSHA256TestRequest(t *testing.T) []byte {
+	issuer := loadTestIssuer(t, testCaFile)
+	cert, err := helpers.ParseCertificatePEM(loadCert(t, testCertFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerKeyHash, err := keyHashWith(issuer, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerNameHash := sha256.Sum256(issuer.RawSubject)
+	id := certID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1},
+			Parameters: asn1.RawValue{Tag: asn1.TagNull},
+		},
+		IssuerNameHash: issuerNameHash[:],
+		IssuerKeyHash:  issuerKeyHash,
+		SerialNumber:   cert.SerialNumber,
+	}
+	der, err := asn1.Marshal(ocspRequest{tbsRequest{RequestList: []request{{id}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestNewSourceFromFileErrors(t *testing.T) {
+	if _, err := NewSourceFromFile("testdata/nonexistent", nil); err == nil {
+		t.Fatal("Expected error for missing response file.")
+	}
+	if _, err := NewSourceFromFile(testCaFile, nil); err == nil {
+		t.Fatal("Expected error for invalid response file.")
+	}
+}
+
+// A request using SHA-256 hashes finds the response signed with SHA-1
+// hashes once the source knows the issuer.
+func TestSourceHashAlgorithms(t *testing.T) {
+	req, err := ParseRequest(newSHA256TestRequest(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := newTestSource(t, nil).Response(req); ok {
+		t.Fatal("Expected no response for SHA-256 without the issuer.")
+	}
+
+	src := newTestSource(t, []*x509.Certificate{loadTestIssuer(t, testResponderFile), loadTestIssuer(t, testCaFile)})
+	if _, ok := src.Response(req); !ok {
+		t.Fatal("Expected a response for SHA-256 with the issuer.")
+	}
+	sha1Req, err := ParseRequest(newTestRequest(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := src.Response(sha1Req); !ok {
+		t.Fatal("Expected a response for SHA-1 with the issuer.")
+	}
+}
+
+func TestSourceWrongIssuer(t *testing.T) {
+	s, err := NewSignerFromFile(testCaFile, "", testCaKeyFile, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.Sign(newSignRequest(t, "good"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ioutil.TempFile("", "cfssl-ocsp-responses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(base64.StdEncoding.EncodeToString(resp) + "\n")
+	f.Close()
+
+	if _, err = NewSourceFromFile(f.Name(), []*x509.Certificate{loadTestIssuer(t, testResponderFile)}); err == nil {
+		t.Fatal("Expected error for a response of another issuer.")
+	}
+}
+
+// The responder decodes GET requests after the prefix it is mounted
+// at.
+func TestResponderPrefix(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/ocsp/", NewResponder(newTestSource(t, nil), "/ocsp/"))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for _, test := range []struct {
+		path     string
+		expected []byte
+	}{
+		{"/ocsp/" + base64.StdEncoding.EncodeToString(newTestRequest(t)), nil},
+		{"/ocsp/ocsp/" + base64.StdEncoding.EncodeToString(newTestRequest(t)), malformedRequestResponse},
+	} {
+		resp, err := http.Get(ts.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.expected != nil {
+			if !bytes.Equal(body, test.expected) {
+				t.Fatalf("Unexpected response %x for %s", body, test.path)
+			}
+			continue
+		}
+		if parsed, err := ParseResponse(body, nil); err != nil || parsed.Status != Good {
+			t.Fatalf("Expected a good response for %s: %v", test.path, err)
+		}
+	}
+}
+
+func TestResponder(t *testing.T) {
+	ts := httptest.NewServer(NewResponder(newTestSource(t, nil), ""))
+	defer ts.Close()
+	reqDER := newTestRequest(t)
+
+	check := func(resp *http.Response, expected []byte) {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatal(resp.Status)
+		}
+		if resp.Header.Get("Content-Type") != "application/ocsp-response" {
+			t.Fatal("Wrong content type:", resp.Header.Get("Content-Type"))
+		}
+		if expected != nil && !bytes.Equal(body, expected) {
+			t.Fatalf("Unexpected response %x", body)
+		}
+		if expected == nil {
+			parsed, err := ParseResponse(body, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Status != Good {
+				t.Fatal("Expected good status.")
+			}
+			if !strings.HasPrefix(resp.Header.Get("Cache-Control"), "max-age=") {
+				t.Fatal("Missing max-age:", resp.Header.Get("Cache-Control"))
+			}
+			if resp.Header.Get("Expires") == "" || resp.Header.Get("Last-Modified") == "" {
+				t.Fatal("Missing caching headers.")
+			}
+		}
+	}
+
+	resp, err := http.Post(ts.URL, "application/ocsp-request", bytes.NewReader(reqDER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(resp, nil)
+
+	resp, err = http.Get(ts.URL + "/" + base64.StdEncoding.EncodeToString(reqDER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(resp, nil)
+
+	resp, err = http.Post(ts.URL, "application/ocsp-request", strings.NewReader("garbage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(resp, malformedRequestResponse)
+
+	// A request for a certificate the responder knows nothing about.
+	unknown := newTestRequest(t)
+	unknown[len(unknown)-1]++
+	resp, err = http.Post(ts.URL, "application/ocsp-request", bytes.NewReader(unknown))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(resp, unauthorizedResponse)
+
+	// A request for the serial number of the test certificate under
+	// another issuer.
+	parsed, err := ParseRequest(reqDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIssuer := make([]byte, len(parsed.IssuerKeyHash))
+	der, err := asn1.Marshal(ocspRequest{tbsRequest{RequestList: []request{{certID{
+		HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: idSHA1, Parameters: asn1.RawValue{Tag: asn1.TagNull}},
+		IssuerNameHash: parsed.IssuerNameHash,
+		IssuerKeyHash:  otherIssuer,
+		SerialNumber:   parsed.SerialNumber,
+	}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(ts.URL, "application/ocsp-request", bytes.NewReader(der))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(resp, unauthorizedResponse)
+
+	req, _ := http.NewRequest("PUT", ts.URL, bytes.NewReader(reqDER))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatal(resp.Status)
+	}
+}
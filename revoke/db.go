@@ -0,0 +1,69 @@
+package revoke
+
+// In this file, we cover the revocation of certificates issued by
+// CF-SSL, whose state is kept in the certificate database.
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/cloudflare/cfssl/certdb"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+)
+
+// certificateHold is the RFC 5280 reason code of a temporary
+// revocation, which may later be made permanent.
+const certificateHold = 6
+
+// removeFromCRL is the RFC 5280 reason code only used in delta CRLs,
+// which is not a reason to revoke a certificate.
+const removeFromCRL = 8
+
+// Revoke marks the certificate with the given serial number and
+// authority key identifier as revoked in db, for the given RFC 5280
+// reason, which may be a name or a code. The serial number is given in
+// decimal, or in hexadecimal with a "0x" prefix; the AKI is
+// hex-encoded and may be colon-separated, as printed by OpenSSL; it
+// may be left empty if no other certificate has the same serial
+// number. A certificate may only be revoked once, except that a
+// certificate on hold may be revoked again with a final reason.
+func Revoke(db certdb.Accessor, serial, aki, reason string) error {
+	serialNumber, ok := new(big.Int).SetString(serial, 0)
+	if !ok || serialNumber.Sign() <= 0 {
+		return cferr.New(cferr.RevocationError, cferr.CertificateNotFound,
+			errors.New("invalid serial number "+serial))
+	}
+	serial = serialNumber.String()
+	aki = strings.ToLower(strings.Replace(aki, ":", "", -1))
+
+	reasonCode, err := ocsp.ReasonStringToCode(reason)
+	if err != nil || reasonCode == removeFromCRL {
+		return cferr.New(cferr.RevocationError, cferr.InvalidReason,
+			errors.New("invalid revocation reason "+reason))
+	}
+
+	records, err := db.GetCertificate(serial, aki)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(records) == 0:
+		return cferr.New(cferr.RevocationError, cferr.CertificateNotFound, nil)
+	case len(records) > 1:
+		return cferr.New(cferr.RevocationError, cferr.CertificateNotFound,
+			errors.New("several certificates have serial number "+serial+", an AKI is required"))
+	}
+
+	cr := records[0]
+	if cr.Status == certdb.StatusRevoked && cr.Reason != certificateHold {
+		return cferr.New(cferr.RevocationError, cferr.AlreadyRevoked, nil)
+	}
+
+	if err = db.RevokeCertificate(cr.Serial, cr.AKI, reasonCode); err != nil {
+		return err
+	}
+	log.Infof("revoked certificate %s issued by %s, reason %d", cr.Serial, cr.AKI, reasonCode)
+	return nil
+}
@@ -0,0 +1,86 @@
+package revoke
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/file"
+	cferr "github.com/cloudflare/cfssl/errors"
+)
+
+func newTestDB(t *testing.T) (certdb.Accessor, func()) {
+	dir, err := ioutil.TempDir("", "cfssl-revoke")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := file.NewAccessor(filepath.Join(dir, "certs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiry := time.Now().Add(time.Hour)
+	for _, cr := range []certdb.CertificateRecord{
+		{Serial: "1234567890", AKI: "b7d2f784", Status: certdb.StatusGood, Expiry: expiry},
+		{Serial: "42", AKI: "aa", Status: certdb.StatusGood, Expiry: expiry},
+		{Serial: "42", AKI: "bb", Status: certdb.StatusGood, Expiry: expiry},
+	} {
+		if err = db.InsertCertificate(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, func() { os.RemoveAll(dir) }
+}
+
+func checkErrorCode(t *testing.T, err error, reason cferr.Reason) {
+	if err == nil {
+		t.Fatal("Expected error.")
+	}
+	cfErr, ok := err.(*cferr.Error)
+	if !ok || cfErr.ErrorCode != int(cferr.RevocationError)+int(reason) {
+		t.Fatalf("Expected error code %d, got %v", int(cferr.RevocationError)+int(reason), err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// Hexadecimal serial numbers and colon-separated AKIs are
+	// normalised before lookup.
+	if err := Revoke(db, "0x499602D2", "B7:D2:F7:84", "certificatehold"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := db.GetCertificate("1234567890", "b7d2f784")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].Status != certdb.StatusRevoked || records[0].Reason != certificateHold {
+		t.Fatalf("Certificate not on hold: %+v", records[0])
+	}
+
+	// A certificate on hold can be revoked for good, but only once.
+	if err = Revoke(db, "1234567890", "b7d2f784", "keycompromise"); err != nil {
+		t.Fatal(err)
+	}
+	checkErrorCode(t, Revoke(db, "1234567890", "b7d2f784", "superseded"), cferr.AlreadyRevoked)
+}
+
+func TestRevokeErrors(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	checkErrorCode(t, Revoke(db, "1234567890", "b7d2f784", "bogus"), cferr.InvalidReason)
+	checkErrorCode(t, Revoke(db, "1234567890", "b7d2f784", "removefromcrl"), cferr.InvalidReason)
+	checkErrorCode(t, Revoke(db, "not a serial", "b7d2f784", "1"), cferr.CertificateNotFound)
+	checkErrorCode(t, Revoke(db, "1234567891", "b7d2f784", "1"), cferr.CertificateNotFound)
+	checkErrorCode(t, Revoke(db, "42", "", "1"), cferr.CertificateNotFound)
+
+	// Without an AKI, a unique serial number is enough.
+	if err := Revoke(db, "1234567890", "", "1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,7 +1,8 @@
 // Package revoke provides functionality for checking the validity of
 // a cert. Specifically, the temporal validity of the certificate is
 // checked first, then any CRL in the cert is checked. OCSP is not
-// supported at this time.
+// supported at this time. It also revokes the certificates issued by
+// CF-SSL, by updating their records in the certificate database.
 package revoke
 
 import (
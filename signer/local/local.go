@@ -0,0 +1,536 @@
+// Package local implements a certificate signer that signs
+// certificates with a CA's private key held in this process.
+package local
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/config"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/serial"
+)
+
+// A Signer contains a CA's certificate and private key for signing
+// certificates, a Signing policy to refer to, a SignatureAlgorithm and
+// a generator of serial numbers. If it has a DB accessor, every
+// certificate the Signer issues is recorded in it, and serial numbers
+// already recorded are not reused.
+type Signer struct {
+	ca         *x509.Certificate
+	priv       crypto.Signer
+	policy     *config.Signing
+	sigAlgo    x509.SignatureAlgorithm
+	serials    serial.Generator
+	dbAccessor certdb.Accessor
+}
+
+// maxSerialAttempts bounds the number of serial numbers drawn when
+// looking for one that is not in the certificate database.
+const maxSerialAttempts = 10
+
+// NewSigner creates a new Signer from the CA's private key and
+// certificate, signing certificates with the given signature
+// algorithm under the given Signing policy, whose serial number
+// config chooses how serial numbers are generated. If cert is nil, the
+// Signer can only sign a self-signed CA certificate, which then
+// becomes its CA certificate.
+func NewSigner(priv crypto.Signer, cert *x509.Certificate, sigAlgo x509.SignatureAlgorithm, policy *config.Signing) (*Signer, error) {
+	if policy == nil {
+		policy = &config.Signing{
+			Profiles: map[string]*config.SigningProfile{},
+			Default:  config.DefaultConfig(),
+		}
+	}
+
+	if !policy.Valid() {
+		return nil, cferr.New(cferr.PolicyError, cferr.InvalidPolicy, errors.New("invalid policy"))
+	}
+
+	serials, err := serial.New(policy.Serial)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Signer{
+		ca:      cert,
+		priv:    priv,
+		policy:  policy,
+		sigAlgo: sigAlgo,
+		serials: serials,
+	}
+	// The signature algorithms of the profiles signed locally must
+	// be ones the CA key signs with.
+	profiles := []*config.SigningProfile{policy.Default}
+	for _, profile := range policy.Profiles {
+		profiles = append(profiles, profile)
+	}
+	for _, profile := range profiles {
+		if profile == nil || profile.RemoteServer != "" {
+			continue
+		}
+		if _, err = s.profileSigAlgo(profile); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// NewSignerFromFile generates a new certificate signer using the certificate
+// authority certificate and private key and Signing config for signing. caFile should
+// contain the CA's certificate, and the cakeyFile should contain the
+// private key. Both must be PEM-encoded; an encrypted key is decrypted
+// with the passphrase from helpers.KeyPasswordSource.
+func NewSignerFromFile(caFile, cakeyFile string, policy *config.Signing) (*Signer, error) {
+	log.Debug("Loading CA: ", caFile)
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Loading CA key: ", cakeyFile)
+	cakey, err := ioutil.ReadFile(cakeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedCa, err := helpers.ParseCertificatePEM(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := helpers.ParsePrivateKeyPEM(cakey)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC, nil)
+	}
+
+	return NewSigner(priv, parsedCa, signer.DefaultSigAlgo(priv), policy)
+}
+
+// nextSerial returns a new serial number. If the signer has a
+// certificate database, the serial number is not that of any
+// certificate recorded as issued by the CA.
+func (s *Signer) nextSerial() (*big.Int, error) {
+	for i := 0; i < maxSerialAttempts; i++ {
+		serialNumber, err := s.serials.Next()
+		if err != nil {
+			return nil, err
+		}
+		if s.dbAccessor == nil {
+			return serialNumber, nil
+		}
+
+		var aki string
+		if s.ca != nil {
+			aki = hex.EncodeToString(s.ca.SubjectKeyId)
+		}
+		records, err := s.dbAccessor.GetCertificate(serialNumber.String(), aki)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return serialNumber, nil
+		}
+		log.Warningf("serial number %v is already in use", serialNumber)
+	}
+	return nil, cferr.New(cferr.CertificateError, cferr.Unknown, errors.New("no unused serial number found"))
+}
+
+func (s *Signer) sign(template *x509.Certificate, profile *config.SigningProfile, req signer.SignRequest) (cert []byte, err error) {
+	// The constraints asked for by the request, before the profile
+	// sets those of the certificate.
+	requested := *template
+
+	pub := template.PublicKey
+	encodedpub, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return
+	}
+	pubhash := sha1.New()
+	pubhash.Write(encodedpub)
+
+	if profile == nil {
+		profile = s.policy.Default
+	}
+
+	var (
+		eku             []x509.ExtKeyUsage
+		ku              x509.KeyUsage
+		crlURL, ocspURL string
+	)
+
+	// The third value returned from Usages is a list of unknown key usages.
+	// This should be used when validating the profile at load, and isn't used
+	// here.
+	ku, eku, _ = profile.Usages()
+	if profile.IssuerURL == nil {
+		profile.IssuerURL = s.policy.Default.IssuerURL
+	}
+
+	if ku == 0 && len(eku) == 0 {
+		err = cferr.New(cferr.PolicyError, cferr.NoKeyUsages, errors.New("no key usage available"))
+		return
+	}
+
+	if crlURL = profile.CRL; crlURL == "" {
+		crlURL = s.policy.Default.CRL
+	}
+	if ocspURL = profile.OCSP; ocspURL == "" {
+		ocspURL = s.policy.Default.OCSP
+	}
+
+	notBefore, notAfter, err := signer.Validity(req, s.policy, time.Now())
+	if err != nil {
+		return
+	}
+	serialNumber, err := s.nextSerial()
+	if err != nil {
+		return
+	}
+
+	template.SerialNumber = serialNumber
+	template.NotBefore = notBefore
+	template.NotAfter = notAfter
+	template.KeyUsage = ku
+	template.ExtKeyUsage = eku
+	template.BasicConstraintsValid = true
+	template.IsCA = profile.CA
+	// Cross-signed and renewed root certificates keep their key
+	// identifier, which certificates issued under them refer to.
+	if len(template.SubjectKeyId) == 0 || !req.CrossSign && s.ca != nil {
+		template.SubjectKeyId = pubhash.Sum(nil)
+	}
+
+	if ocspURL != "" {
+		template.OCSPServer = []string{ocspURL}
+	}
+	if crlURL != "" {
+		template.CRLDistributionPoints = []string{crlURL}
+	}
+
+	if len(profile.IssuerURL) != 0 {
+		template.IssuingCertificateURL = profile.IssuerURL
+	}
+
+	if err = signer.AddPolicies(template, profile.Policies); err != nil {
+		err = cferr.New(cferr.PolicyError, cferr.InvalidPolicy, err)
+		return
+	}
+	if err = signer.AddExtensions(template, profile.Extensions); err != nil {
+		err = cferr.New(cferr.PolicyError, cferr.InvalidPolicy, err)
+		return
+	}
+
+	if err = profile.NamePolicy.CheckNames(template); err != nil {
+		err = cferr.New(cferr.PolicyError, cferr.NameNotAllowed, err)
+		return
+	}
+
+	var initRoot bool
+	if s.ca == nil {
+		if !template.IsCA || req.CrossSign {
+			err = cferr.New(cferr.PolicyError, cferr.InvalidRequest, nil)
+			return
+		}
+		template.DNSNames = nil
+		s.ca = template
+		initRoot = true
+		template.MaxPathLen = 2
+	} else if template.IsCA {
+		template.MaxPathLen = 1
+		if !req.CrossSign {
+			template.DNSNames = nil
+		}
+	}
+	if template.IsCA {
+		if err = s.constrainCA(template, &requested, profile, initRoot, req.CrossSign); err != nil {
+			if initRoot {
+				s.ca = nil
+			}
+			return
+		}
+	} else {
+		template.MaxPathLen = 0
+		template.MaxPathLenZero = false
+		clearNameConstraints(template)
+	}
+
+	// A root cross-signed under its predecessor has the subject of its
+	// issuer, which x509 takes for self-signed, so the issuer's key
+	// identifier is given explicitly.
+	if req.CrossSign {
+		template.AuthorityKeyId = s.ca.SubjectKeyId
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, s.ca, pub, s.priv)
+	if err != nil {
+		return
+	}
+	if initRoot {
+		s.ca, err = x509.ParseCertificate(derBytes)
+		if err != nil {
+			err = cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
+			return
+		}
+	}
+
+	if s.dbAccessor != nil {
+		var parsedCert *x509.Certificate
+		parsedCert, err = x509.ParseCertificate(derBytes)
+		if err != nil {
+			err = cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
+			return
+		}
+		err = s.dbAccessor.InsertCertificate(certdb.NewCertificateRecord(parsedCert, req.Profile, req.Requester))
+		if err != nil {
+			log.Errorf("failed to record certificate %v: %v", parsedCert.SerialNumber, err)
+			return
+		}
+	}
+
+	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	return
+}
+
+// constrainCA sets the path length and name constraints of the CA
+// certificate template. A path length asked for by the request is
+// granted if it is within that of the profile and leaves room under
+// the issuing CA's own; otherwise the profile's applies. When
+// cross-signing, the path length of the existing CA certificate is
+// instead shortened to leave room under the issuing CA's. The name
+// constraints asked for by the request are granted if they are within
+// those of the profile.
+func (s *Signer) constrainCA(template, requested *x509.Certificate, profile *config.SigningProfile, initRoot, crossSign bool) error {
+	if requested.BasicConstraintsValid && requested.IsCA && (requested.MaxPathLen > 0 || requested.MaxPathLenZero) {
+		pathLen := requested.MaxPathLen
+		if profile.PathLenZero && pathLen > 0 || profile.MaxPathLen > 0 && pathLen > profile.MaxPathLen {
+			return cferr.New(cferr.PolicyError, cferr.InvalidRequest,
+				fmt.Errorf("path length %d is longer than the signing profile allows", pathLen))
+		}
+		if !initRoot && s.ca.BasicConstraintsValid && (s.ca.MaxPathLen > 0 || s.ca.MaxPathLenZero) && pathLen >= s.ca.MaxPathLen {
+			if !crossSign || s.ca.MaxPathLen == 0 {
+				return cferr.New(cferr.PolicyError, cferr.InvalidRequest,
+					fmt.Errorf("path length %d is not shorter than the issuer's", pathLen))
+			}
+			pathLen = s.ca.MaxPathLen - 1
+		}
+		template.MaxPathLen = pathLen
+		template.MaxPathLenZero = pathLen == 0
+	} else if profile.PathLenZero {
+		template.MaxPathLen = 0
+		template.MaxPathLenZero = true
+	} else if profile.MaxPathLen > 0 {
+		template.MaxPathLen = profile.MaxPathLen
+	}
+
+	clearNameConstraints(template)
+	if profile.NameConstraints != nil {
+		if err := profile.NameConstraints.Apply(template); err != nil {
+			return cferr.New(cferr.PolicyError, cferr.InvalidPolicy, err)
+		}
+	}
+	if err := narrowNameConstraints(template, requested); err != nil {
+		return cferr.New(cferr.PolicyError, cferr.InvalidRequest, err)
+	}
+	return nil
+}
+
+// clearNameConstraints removes the name constraints of the template.
+func clearNameConstraints(template *x509.Certificate) {
+	template.PermittedDNSDomainsCritical = false
+	template.PermittedDNSDomains = nil
+	template.ExcludedDNSDomains = nil
+	template.PermittedIPRanges = nil
+	template.ExcludedIPRanges = nil
+	template.PermittedEmailAddresses = nil
+	template.ExcludedEmailAddresses = nil
+}
+
+// narrowNameConstraints adds the name constraints asked for by the
+// request to those of the template. Excluded names are always added;
+// permitted names of a kind replace those of the template, each of
+// which must then be within one of the template's.
+func narrowNameConstraints(template, requested *x509.Certificate) error {
+	if len(requested.PermittedDNSDomains) > 0 {
+		for _, domain := range requested.PermittedDNSDomains {
+			if len(template.PermittedDNSDomains) > 0 && !anyString(template.PermittedDNSDomains, domain, domainWithin) {
+				return fmt.Errorf("permitted domain %q is not within the signing profile's", domain)
+			}
+		}
+		template.PermittedDNSDomains = requested.PermittedDNSDomains
+	}
+	if len(requested.PermittedEmailAddresses) > 0 {
+		for _, email := range requested.PermittedEmailAddresses {
+			if len(template.PermittedEmailAddresses) > 0 && !anyString(template.PermittedEmailAddresses, email, emailWithin) {
+				return fmt.Errorf("permitted email address %q is not within the signing profile's", email)
+			}
+		}
+		template.PermittedEmailAddresses = requested.PermittedEmailAddresses
+	}
+	if len(requested.PermittedIPRanges) > 0 {
+		for _, r := range requested.PermittedIPRanges {
+			within := len(template.PermittedIPRanges) == 0
+			for _, p := range template.PermittedIPRanges {
+				within = within || ipRangeWithin(r, p)
+			}
+			if !within {
+				return fmt.Errorf("permitted IP range %v is not within the signing profile's", r)
+			}
+		}
+		template.PermittedIPRanges = requested.PermittedIPRanges
+	}
+
+	template.ExcludedDNSDomains = append(template.ExcludedDNSDomains, requested.ExcludedDNSDomains...)
+	template.ExcludedEmailAddresses = append(template.ExcludedEmailAddresses, requested.ExcludedEmailAddresses...)
+	template.ExcludedIPRanges = append(template.ExcludedIPRanges, requested.ExcludedIPRanges...)
+	template.PermittedDNSDomainsCritical = template.PermittedDNSDomainsCritical || requested.PermittedDNSDomainsCritical
+	return nil
+}
+
+// anyString reports whether s is within any of the constraints.
+func anyString(constraints []string, s string, within func(s, constraint string) bool) bool {
+	for _, constraint := range constraints {
+		if within(s, constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+// domainWithin reports whether the domain constraint permits no more
+// than the other constraint: a constraint "example.com" permits the
+// domain and its subdomains, and ".example.com" only its subdomains.
+func domainWithin(domain, constraint string) bool {
+	domain, constraint = strings.ToLower(domain), strings.ToLower(constraint)
+	base := strings.TrimPrefix(constraint, ".")
+	if base == "" {
+		return true
+	}
+	return strings.HasSuffix(domain, "."+base) || !strings.HasPrefix(constraint, ".") && domain == base
+}
+
+// emailWithin reports whether the email constraint permits no more
+// than the other constraint: a constraint is a mailbox, a host
+// permitting all its mailboxes, or ".host" permitting the mailboxes of
+// its subdomains.
+func emailWithin(email, constraint string) bool {
+	email, constraint = strings.ToLower(email), strings.ToLower(constraint)
+	if strings.Contains(constraint, "@") {
+		return email == constraint
+	}
+	host := email[strings.LastIndex(email, "@")+1:]
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(host, constraint)
+	}
+	return host == constraint && !strings.HasPrefix(email, ".")
+}
+
+// ipRangeWithin reports whether the IP range r is within p.
+func ipRangeWithin(r, p *net.IPNet) bool {
+	rOnes, rBits := r.Mask.Size()
+	pOnes, pBits := p.Mask.Size()
+	return rBits == pBits && rOnes >= pOnes && p.Contains(r.IP)
+}
+
+// Sign signs a new certificate based on the PEM-encoded client
+// certificate or certificate request with the signing profile named in
+// the request. The certificate will be valid for the hosts named in
+// the request, or, if the request names none and the profile allows
+// it, for the subject alternative names of the certificate request.
+// A cross-sign request is for an existing CA certificate, which is
+// signed again with its subject, key and subject alternative names.
+func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
+	profile := s.policy.Profile(req.Profile)
+	sigAlgo, err := s.profileSigAlgo(profile)
+	if err != nil {
+		return
+	}
+	template, err := signer.ParseSignRequest(req, profile, sigAlgo)
+	if err != nil {
+		return
+	}
+	return s.sign(template, profile, req)
+}
+
+// profileSigAlgo returns the signature algorithm of the certificates
+// signed under the profile: the one the profile names, if any, or the
+// signer's, and its RSA-PSS counterpart if the profile asks for PSS
+// signatures. The algorithm must be one the CA key signs with.
+func (s *Signer) profileSigAlgo(profile *config.SigningProfile) (x509.SignatureAlgorithm, error) {
+	if profile == nil {
+		return s.sigAlgo, nil
+	}
+	sigAlgo, err := profile.SigAlgo()
+	if err != nil {
+		return x509.UnknownSignatureAlgorithm, cferr.New(cferr.PolicyError, cferr.InvalidPolicy, err)
+	}
+	if sigAlgo == x509.UnknownSignatureAlgorithm {
+		sigAlgo = s.sigAlgo
+	} else if !signer.SigAlgoFitsKey(sigAlgo, s.priv.Public()) {
+		return x509.UnknownSignatureAlgorithm, cferr.New(cferr.PolicyError, cferr.InvalidPolicy,
+			fmt.Errorf("the signing profile asks for %s signatures, which the CA key cannot make", profile.SigAlgoString))
+	}
+	if !profile.PSS {
+		return sigAlgo, nil
+	}
+	if _, ok := s.priv.Public().(*rsa.PublicKey); !ok {
+		return x509.UnknownSignatureAlgorithm, cferr.New(cferr.PolicyError, cferr.InvalidPolicy,
+			errors.New("the signing profile asks for RSA-PSS signatures, but the CA key is not an RSA key"))
+	}
+	return signer.PSSSigAlgo(sigAlgo), nil
+}
+
+// Certificate returns the signer's CA certificate.
+func (s *Signer) Certificate() (*x509.Certificate, error) {
+	if s.ca == nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.Unknown, errors.New("signer has no CA certificate"))
+	}
+	return s.ca, nil
+}
+
+// Policy returns the signer's signing policy.
+func (s *Signer) Policy() *config.Signing {
+	return s.policy
+}
+
+// SetPolicy sets the signer's signing policy. The signer keeps its
+// serial number generator.
+func (s *Signer) SetPolicy(policy *config.Signing) {
+	s.policy = policy
+}
+
+// SigAlgo returns the signature algorithm of the certificates the
+// signer signs.
+func (s *Signer) SigAlgo() x509.SignatureAlgorithm {
+	return s.sigAlgo
+}
+
+// SetSerialGenerator sets the generator of the serial numbers of the
+// certificates the signer issues.
+func (s *Signer) SetSerialGenerator(serials serial.Generator) {
+	s.serials = serials
+}
+
+// SetDBAccessor sets the certificate database in which the signer
+// records the certificates it issues.
+func (s *Signer) SetDBAccessor(db certdb.Accessor) {
+	s.dbAccessor = db
+}
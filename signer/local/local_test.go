@@ -0,0 +1,1132 @@
+package local
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/file"
+	"github.com/cloudflare/cfssl/config"
+	cfcsr "github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+const (
+	testCaFile            = "testdata/ca.pem"
+	testCaKeyFile         = "testdata/ca_key.pem"
+	testECDSACaFile       = "testdata/ecdsa256_ca.pem"
+	testECDSACaKeyFile    = "testdata/ecdsa256_ca_key.pem"
+	testEd25519CaFile     = "testdata/ed25519_ca.pem"
+	testEd25519CaKeyFile  = "testdata/ed25519_ca_key.pem"
+	testEd25519CSRFile    = "testdata/ed25519.csr"
+	testClientCertFile    = "testdata/cert.pem"
+	testBrokenCertFile    = "testdata/broken.pem"
+	testNotSelfSignedFile = "testdata/notselfsigned.pem"
+)
+
+var expiry = 1 * time.Minute
+
+// Start a signer with the testing RSA CA cert and key.
+func newTestSigner(t *testing.T) (s *Signer) {
+	s, err := NewSignerFromFile(testCaFile, testCaKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestNewSignerPolicy(t *testing.T) {
+	var CAConfig = &config.Config{
+		Signing: &config.Signing{
+			Profiles: map[string]*config.SigningProfile{
+				"signature": {
+					Usage:  []string{"digital signature"},
+					Expiry: expiry,
+				},
+			},
+			Default: &config.SigningProfile{
+				Usage:        []string{"cert sign", "crl sign"},
+				ExpiryString: "43800h",
+				Expiry:       expiry,
+				CA:           true,
+			},
+		},
+	}
+	_, err := NewSignerFromFile(testCaFile, testCaKeyFile, CAConfig.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewSignerInvalidPolicy(t *testing.T) {
+	var invalidConfig = &config.Config{
+		Signing: &config.Signing{
+			Profiles: map[string]*config.SigningProfile{
+				"invalid": {
+					Usage:  []string{"wiretapping"},
+					Expiry: expiry,
+				},
+				"empty": {},
+			},
+			Default: &config.SigningProfile{
+				Usage:  []string{"digital signature"},
+				Expiry: expiry,
+			},
+		},
+	}
+	_, err := NewSignerFromFile(testCaFile, testCaKeyFile, invalidConfig.Signing)
+	if err == nil {
+		t.Fatal(err)
+	}
+
+}
+
+func newCustomSigner(t *testing.T, testCaFile, testCaKeyFile string) (s *Signer) {
+	s, err := NewSignerFromFile(testCaFile, testCaKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestNewSigner(t *testing.T) {
+	newTestSigner(t)
+}
+
+func TestNewSignerEncryptedKey(t *testing.T) {
+	defer func(source string) { helpers.KeyPasswordSource = source }(helpers.KeyPasswordSource)
+	helpers.KeyPasswordSource = "env:CFSSL_TEST_KEY_PASSWORD"
+	defer os.Unsetenv("CFSSL_TEST_KEY_PASSWORD")
+
+	const encryptedKeyFile = "testdata/ecdsa256_ca_key_encrypted.pem"
+	if _, err := NewSignerFromFile(testECDSACaFile, encryptedKeyFile, nil); err == nil {
+		t.Fatal("Expected error loading an encrypted key without a passphrase.")
+	}
+
+	os.Setenv("CFSSL_TEST_KEY_PASSWORD", "cfssl-test")
+	s, err := NewSignerFromFile(testECDSACaFile, encryptedKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const (
+	testHostName = "localhost"
+)
+
+func TestSign(t *testing.T) {
+	s := newTestSigner(t)
+
+	clientCertPEM, err := ioutil.ReadFile(testClientCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := helpers.ParseCertificatePEM(clientCertPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := s.Sign(signer.SignRequest{Hosts: []string{testHostName}, Request: string(clientCertPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignatureFrom(s.ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.VerifyHostname(testHostName); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cert.PublicKey, clientCert.PublicKey) {
+		t.Fatal("Cert public key does not match clientCert", cert.PublicKey, clientCert.PublicKey)
+	}
+}
+
+func testSignFile(t *testing.T, certFile string) ([]byte, error) {
+	s := newTestSigner(t)
+
+	pem, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.Sign(signer.SignRequest{Hosts: []string{testHostName}, Request: string(pem)})
+}
+
+func TestBrokenCert(t *testing.T) {
+	if _, err := testSignFile(t, testBrokenCertFile); err == nil {
+		t.Fatal("Broken Certificate did not fail")
+	}
+}
+
+func TestNotSelfSignedCert(t *testing.T) {
+	if _, err := testSignFile(t, testNotSelfSignedFile); !strings.Contains(err.Error(), "\"code\":1200") {
+		t.Fatal(err)
+	}
+}
+
+type csrTest struct {
+	file    string
+	keyAlgo string
+	keyLen  int
+	// Error checking function
+	errorCallback func(*testing.T, error)
+}
+
+// A helper function that returns a errorCallback function which expects an error.
+func ExpectError() func(*testing.T, error) {
+	return func(t *testing.T, err error) {
+		if err == nil {
+			t.Fatal("Expected error. Got nothing.")
+		}
+	}
+}
+
+var csrTests = []csrTest{
+	{
+		file:          "testdata/rsa2048.csr",
+		keyAlgo:       "rsa",
+		keyLen:        2048,
+		errorCallback: nil,
+	},
+	{
+		file:          "testdata/rsa3072.csr",
+		keyAlgo:       "rsa",
+		keyLen:        3072,
+		errorCallback: nil,
+	},
+	{
+		file:          "testdata/rsa4096.csr",
+		keyAlgo:       "rsa",
+		keyLen:        4096,
+		errorCallback: nil,
+	},
+	{
+		file:          "testdata/ecdsa256.csr",
+		keyAlgo:       "ecdsa",
+		keyLen:        256,
+		errorCallback: nil,
+	},
+	{
+		file:          "testdata/ecdsa384.csr",
+		keyAlgo:       "ecdsa",
+		keyLen:        384,
+		errorCallback: nil,
+	},
+	{
+		file:          "testdata/ecdsa521.csr",
+		keyAlgo:       "ecdsa",
+		keyLen:        521,
+		errorCallback: nil,
+	},
+}
+
+func TestSignCSRs(t *testing.T) {
+	s := newTestSigner(t)
+	hostname := "cloudflare.com"
+	for _, test := range csrTests {
+		csr, err := ioutil.ReadFile(test.file)
+		if err != nil {
+			t.Fatal("CSR loading error:", err)
+		}
+		// It is possible to use different SHA2 algorithm with RSA CA key.
+		rsaSigAlgos := []x509.SignatureAlgorithm{x509.SHA1WithRSA, x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA}
+		for _, sigAlgo := range rsaSigAlgos {
+			s.sigAlgo = sigAlgo
+			certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{hostname}, Request: string(csr)})
+			if test.errorCallback != nil {
+				test.errorCallback(t, err)
+			} else {
+				if err != nil {
+					t.Fatalf("Expected no error. Got %s. Param %s %d", err.Error(), test.keyAlgo, test.keyLen)
+				}
+				cert, _ := helpers.ParseCertificatePEM(certBytes)
+				if cert.SignatureAlgorithm != s.sigAlgo {
+					t.Fatal("Cert Signature Algorithm does not match the issuer.")
+				}
+			}
+		}
+	}
+}
+
+func TestSignHosts(t *testing.T) {
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := []string{"cloudflare.com", "127.0.0.1", "::1", "admin@cloudflare.com", "spiffe://cloudflare.com/service"}
+	certBytes, err := s.Sign(signer.SignRequest{Hosts: hosts, Request: string(csr)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"cloudflare.com"}) {
+		t.Fatalf("Unexpected DNS names %v", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 2 || cert.IPAddresses[0].String() != "127.0.0.1" || cert.IPAddresses[1].String() != "::1" {
+		t.Fatalf("Unexpected IP addresses %v", cert.IPAddresses)
+	}
+	if !reflect.DeepEqual(cert.EmailAddresses, []string{"admin@cloudflare.com"}) {
+		t.Fatalf("Unexpected email addresses %v", cert.EmailAddresses)
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://cloudflare.com/service" {
+		t.Fatalf("Unexpected URIs %v", cert.URIs)
+	}
+
+	// The default profile does not take the hosts from the CSR.
+	if _, err = s.Sign(signer.SignRequest{Request: string(csr)}); err == nil {
+		t.Fatal("Expected error signing a request without hosts.")
+	}
+
+	s.policy.Default.AllowCSRHosts = true
+	certBytes, err = s.Sign(signer.SignRequest{Request: string(csr)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"cloudflare.com", "wwwcloudflare.com"}) {
+		t.Fatalf("Unexpected DNS names %v", cert.DNSNames)
+	}
+
+	// All kinds of SANs in the CSR are kept.
+	csr, _, err = cfcsr.ParseRequest(&cfcsr.CertificateRequest{
+		CN:         "cloudflare.com",
+		Hosts:      hosts,
+		KeyRequest: &cfcsr.KeyRequest{Algo: "ecdsa", Size: 256},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBytes, err = s.Sign(signer.SignRequest{Request: string(csr)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.DNSNames) != 1 || len(cert.IPAddresses) != 2 || len(cert.EmailAddresses) != 1 || len(cert.URIs) != 1 {
+		t.Fatalf("Unexpected SANs %v %v %v %v", cert.DNSNames, cert.IPAddresses, cert.EmailAddresses, cert.URIs)
+	}
+}
+
+func TestSignNamePolicy(t *testing.T) {
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy.Default.NamePolicy = &config.NamePolicy{AllowedSuffixes: []string{"cloudflare.com"}}
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Sign(signer.SignRequest{Hosts: []string{"www.cloudflare.com"}, Request: string(csr)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"example.com", "*.cloudflare.com", "127.0.0.1"} {
+		_, err = s.Sign(signer.SignRequest{Hosts: []string{host}, Request: string(csr)})
+		if err == nil || !strings.Contains(err.Error(), "\"code\":5400") {
+			t.Fatalf("Expected name policy error signing for %s, got %v", host, err)
+		}
+	}
+}
+
+func TestSignRecordsCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := file.NewAccessor(filepath.Join(dir, "certs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.SetDBAccessor(db)
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr), Requester: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := db.GetCertificate(cert.SerialNumber.String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 certificate record, got %d", len(records))
+	}
+	cr := records[0]
+	if cr.Status != certdb.StatusGood || cr.Requester != "alice" || cr.PEM != string(certBytes) {
+		t.Fatalf("Unexpected certificate record %+v", cr)
+	}
+	if !cr.Expiry.Equal(cert.NotAfter) {
+		t.Fatalf("Record expiry %v does not match certificate expiry %v", cr.Expiry, cert.NotAfter)
+	}
+}
+
+// fixedSerials hands out a fixed sequence of serial numbers.
+type fixedSerials []int64
+
+func (f *fixedSerials) Next() (*big.Int, error) {
+	if len(*f) == 0 {
+		return nil, errors.New("out of serial numbers")
+	}
+	serial := big.NewInt((*f)[0])
+	*f = (*f)[1:]
+	return serial, nil
+}
+
+func TestSignUniqueSerial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := file.NewAccessor(filepath.Join(dir, "certs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.SetDBAccessor(db)
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr)}
+
+	// The default generator gives positive serial numbers of at most
+	// 20 octets.
+	certBytes, err := s.Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber.Sign() <= 0 || len(cert.SerialNumber.Bytes()) > config.MaxSerialLength {
+		t.Fatalf("Invalid serial number %v", cert.SerialNumber)
+	}
+
+	// A serial number already issued by the CA is skipped.
+	s.SetSerialGenerator(&fixedSerials{1})
+	if _, err = s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	s.SetSerialGenerator(&fixedSerials{1, 1, 2})
+	if certBytes, err = s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = helpers.ParseCertificatePEM(certBytes); err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber.Int64() != 2 {
+		t.Fatalf("Expected serial number 2, got %v", cert.SerialNumber)
+	}
+
+	s.SetSerialGenerator(&fixedSerials{1, 2})
+	if _, err = s.Sign(req); err == nil {
+		t.Fatal("Expected error when every serial number is in use.")
+	}
+}
+
+func TestSignValidity(t *testing.T) {
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy.Default.Expiry = 24 * time.Hour
+	s.policy.Default.Backdate = time.Hour
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, test := range []struct {
+		notBefore, notAfter time.Time
+		valid               bool
+	}{
+		{now.Add(-30 * time.Minute), now.Add(time.Hour), true},
+		{time.Time{}, now.Add(12 * time.Hour), true},
+		{now.Add(time.Hour), time.Time{}, true},
+		{now.Add(-2 * time.Hour), time.Time{}, false},
+		{time.Time{}, now.Add(48 * time.Hour), false},
+		{now.Add(time.Hour), now.Add(time.Minute), false},
+	} {
+		req := signer.SignRequest{
+			Hosts:     []string{"cloudflare.com"},
+			Request:   string(csr),
+			NotBefore: test.notBefore,
+			NotAfter:  test.notAfter,
+		}
+		certBytes, err := s.Sign(req)
+		if !test.valid {
+			if err == nil {
+				t.Fatalf("Expected error signing for %v to %v", test.notBefore, test.notAfter)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !test.notBefore.IsZero() && !cert.NotBefore.Equal(test.notBefore) {
+			t.Fatalf("Expected validity from %v, got %v", test.notBefore, cert.NotBefore)
+		}
+		if !test.notAfter.IsZero() && !cert.NotAfter.Equal(test.notAfter) {
+			t.Fatalf("Expected validity until %v, got %v", test.notAfter, cert.NotAfter)
+		}
+	}
+
+	// Without a window, certificates are backdated by the profile's
+	// backdate and valid for its expiry.
+	certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cert.NotAfter.Sub(cert.NotBefore); d != 25*time.Hour {
+		t.Fatalf("Expected a validity of 25h, got %v", d)
+	}
+}
+
+func TestECDSASigner(t *testing.T) {
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	hostname := "cloudflare.com"
+	for _, test := range csrTests {
+		csr, err := ioutil.ReadFile(test.file)
+		if err != nil {
+			t.Fatal("CSR loading error:", err)
+		}
+		// Try all ECDSA SignatureAlgorithm
+		SigAlgos := []x509.SignatureAlgorithm{x509.ECDSAWithSHA1, x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512}
+		for _, sigAlgo := range SigAlgos {
+			s.sigAlgo = sigAlgo
+			certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{hostname}, Request: string(csr)})
+			if test.errorCallback != nil {
+				test.errorCallback(t, err)
+			} else {
+				if err != nil {
+					t.Fatalf("Expected no error. Got %s. Param %s %d", err.Error(), test.keyAlgo, test.keyLen)
+				}
+				cert, _ := helpers.ParseCertificatePEM(certBytes)
+				if cert.SignatureAlgorithm != s.sigAlgo {
+					t.Fatal("Cert Signature Algorithm does not match the issuer.")
+				}
+			}
+		}
+	}
+}
+
+func TestEd25519Signer(t *testing.T) {
+	s := newCustomSigner(t, testEd25519CaFile, testEd25519CaKeyFile)
+	if s.sigAlgo != x509.PureEd25519 {
+		t.Fatalf("Unexpected signature algorithm %v for an Ed25519 CA", s.sigAlgo)
+	}
+
+	for _, file := range []string{testEd25519CSRFile, "testdata/ecdsa256.csr", "testdata/rsa2048.csr"} {
+		csr, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal("CSR loading error:", err)
+		}
+		certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr)})
+		if err != nil {
+			t.Fatalf("Error signing %s: %v", file, err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.SignatureAlgorithm != x509.PureEd25519 {
+			t.Fatal("Cert Signature Algorithm does not match the issuer.")
+		}
+		if err = cert.CheckSignatureFrom(s.ca); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An Ed25519 CSR is also signed by CAs of other types.
+	csr, err := ioutil.ReadFile(testEd25519CSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.PublicKeyAlgorithm != x509.Ed25519 {
+		t.Fatalf("Unexpected public key algorithm %v", cert.PublicKeyAlgorithm)
+	}
+}
+
+func TestSignPSS(t *testing.T) {
+	policy := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{
+			"pss": {
+				Usage:  []string{"server auth"},
+				Expiry: expiry,
+				PSS:    true,
+			},
+		},
+		Default: config.DefaultConfig(),
+	}
+	s, err := NewSignerFromFile(testCaFile, testCaKeyFile, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		file    string
+		profile string
+		sigAlgo x509.SignatureAlgorithm
+	}{
+		{"testdata/rsa2048-pss.csr", "pss", signer.PSSSigAlgo(s.sigAlgo)},
+		{"testdata/rsa2048.csr", "pss", signer.PSSSigAlgo(s.sigAlgo)},
+		{"testdata/ecdsa256.csr", "pss", signer.PSSSigAlgo(s.sigAlgo)},
+		{"testdata/rsa2048-pss.csr", "", s.sigAlgo},
+	} {
+		csr, err := ioutil.ReadFile(test.file)
+		if err != nil {
+			t.Fatal("CSR loading error:", err)
+		}
+		certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr), Profile: test.profile})
+		if err != nil {
+			t.Fatalf("Error signing %s with profile %q: %v", test.file, test.profile, err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.SignatureAlgorithm != test.sigAlgo {
+			t.Fatalf("Expected signature algorithm %v signing %s with profile %q, got %v",
+				test.sigAlgo, test.file, test.profile, cert.SignatureAlgorithm)
+		}
+		if err = cert.CheckSignatureFrom(s.ca); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only RSA CA keys make RSA-PSS signatures.
+	if _, err = NewSignerFromFile(testECDSACaFile, testECDSACaKeyFile, policy); err == nil {
+		t.Fatal("Expected error creating an ECDSA signer with an RSA-PSS profile")
+	}
+	s = newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.SetPolicy(policy)
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr), Profile: "pss"}); err == nil {
+		t.Fatal("Expected error signing with RSA-PSS and an ECDSA CA key")
+	}
+}
+
+func TestSignProfileSigAlgo(t *testing.T) {
+	newPolicy := func(sigAlgo string, pss bool) *config.Signing {
+		return &config.Signing{
+			Profiles: map[string]*config.SigningProfile{
+				"legacy": {
+					Usage:         []string{"server auth"},
+					Expiry:        expiry,
+					SigAlgoString: sigAlgo,
+					PSS:           pss,
+				},
+			},
+			Default: config.DefaultConfig(),
+		}
+	}
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		caFile, caKeyFile string
+		sigAlgo           string
+		pss               bool
+		expected          x509.SignatureAlgorithm
+	}{
+		{testCaFile, testCaKeyFile, "SHA384WithRSA", false, x509.SHA384WithRSA},
+		{testCaFile, testCaKeyFile, "sha512-rsa", false, x509.SHA512WithRSA},
+		{testCaFile, testCaKeyFile, "SHA512WithRSA", true, x509.SHA512WithRSAPSS},
+		{testCaFile, testCaKeyFile, "SHA384WithRSAPSS", false, x509.SHA384WithRSAPSS},
+		{testECDSACaFile, testECDSACaKeyFile, "ECDSA-SHA384", false, x509.ECDSAWithSHA384},
+		{testEd25519CaFile, testEd25519CaKeyFile, "Ed25519", false, x509.PureEd25519},
+	} {
+		s, err := NewSignerFromFile(test.caFile, test.caKeyFile, newPolicy(test.sigAlgo, test.pss))
+		if err != nil {
+			t.Fatalf("Error creating a signer for %s with %s: %v", test.caFile, test.sigAlgo, err)
+		}
+		certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr), Profile: "legacy"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.SignatureAlgorithm != test.expected {
+			t.Fatalf("Expected signature algorithm %v, got %v", test.expected, cert.SignatureAlgorithm)
+		}
+		if err = cert.CheckSignatureFrom(s.ca); err != nil {
+			t.Fatal(err)
+		}
+
+		// Other profiles keep the signer's algorithm.
+		certBytes, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert, err = helpers.ParseCertificatePEM(certBytes); err != nil {
+			t.Fatal(err)
+		}
+		if cert.SignatureAlgorithm != s.sigAlgo {
+			t.Fatalf("Expected signature algorithm %v for the default profile, got %v", s.sigAlgo, cert.SignatureAlgorithm)
+		}
+	}
+
+	// Algorithms the CA key cannot sign with, and weak algorithms
+	// that are not allowed, are refused.
+	for _, test := range []struct {
+		caFile, caKeyFile string
+		sigAlgo           string
+	}{
+		{testCaFile, testCaKeyFile, "ECDSAWithSHA256"},
+		{testCaFile, testCaKeyFile, "Ed25519"},
+		{testECDSACaFile, testECDSACaKeyFile, "SHA256WithRSA"},
+		{testEd25519CaFile, testEd25519CaKeyFile, "ECDSAWithSHA256"},
+		{testCaFile, testCaKeyFile, "SHA1WithRSA"},
+		{testCaFile, testCaKeyFile, "MD5WithRSA"},
+	} {
+		if _, err = NewSignerFromFile(test.caFile, test.caKeyFile, newPolicy(test.sigAlgo, false)); err == nil {
+			t.Fatalf("Expected error creating a signer for %s with %s", test.caFile, test.sigAlgo)
+		}
+	}
+
+	policy := newPolicy("SHA1WithRSA", false)
+	policy.Profiles["legacy"].AllowWeakSig = true
+	s, err := NewSignerFromFile(testCaFile, testCaKeyFile, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sigAlgo, err := s.profileSigAlgo(policy.Profiles["legacy"]); err != nil || sigAlgo != x509.SHA1WithRSA {
+		t.Fatalf("Expected SHA1WithRSA for an allowed weak algorithm, got %v, %v", sigAlgo, err)
+	}
+}
+
+const (
+	ecdsaInterCSR = "testdata/ecdsa256-inter.csr"
+	ecdsaInterKey = "testdata/ecdsa256-inter.key"
+	rsaInterCSR   = "testdata/rsa2048-inter.csr"
+	rsaInterKey   = "testdata/rsa2048-inter.key"
+)
+
+func TestCAIssuing(t *testing.T) {
+	var caCerts = []string{testCaFile, testECDSACaFile}
+	var caKeys = []string{testCaKeyFile, testECDSACaKeyFile}
+	var interCSRs = []string{ecdsaInterCSR, rsaInterCSR}
+	var interKeys = []string{ecdsaInterKey, rsaInterKey}
+	var CAPolicy = &config.Signing{
+		Default: &config.SigningProfile{
+			Usage:        []string{"cert sign", "crl sign"},
+			ExpiryString: "1h",
+			Expiry:       1 * time.Hour,
+			CA:           true,
+		},
+	}
+	var hostname = "cloudflare-inter.com"
+	// Each RSA or ECDSA root CA issues two intermediate CAs (one ECDSA and one RSA).
+	// For each intermediate CA, use it to issue additional RSA and ECDSA intermediate CSRs.
+	for i, caFile := range caCerts {
+		caKeyFile := caKeys[i]
+		s := newCustomSigner(t, caFile, caKeyFile)
+		s.policy = CAPolicy
+		for j, csr := range interCSRs {
+			csrBytes, _ := ioutil.ReadFile(csr)
+			certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{hostname}, Request: string(csrBytes)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			interCert, err := helpers.ParseCertificatePEM(certBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keyBytes, _ := ioutil.ReadFile(interKeys[j])
+			interKey, _ := helpers.ParsePrivateKeyPEM(keyBytes)
+			interSigner, err := NewSigner(interKey.(crypto.Signer), interCert, signer.DefaultSigAlgo(interKey), CAPolicy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, anotherCSR := range interCSRs {
+				anotherCSRBytes, _ := ioutil.ReadFile(anotherCSR)
+				bytes, err := interSigner.Sign(signer.SignRequest{Hosts: []string{hostname}, Request: string(anotherCSRBytes)})
+				if err != nil {
+					t.Fatal(err)
+				}
+				cert, err := helpers.ParseCertificatePEM(bytes)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cert.SignatureAlgorithm != interSigner.sigAlgo {
+					t.Fatal("Cert Signature Algorithm does not match the issuer.")
+				}
+			}
+		}
+	}
+
+}
+
+func TestCAPathLenAndNameConstraints(t *testing.T) {
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	csr, err := ioutil.ReadFile(ecdsaInterCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := &config.SigningProfile{
+		Usage:  []string{"cert sign", "crl sign"},
+		Expiry: time.Hour,
+		CA:     true,
+	}
+	s.policy = &config.Signing{
+		Profiles: map[string]*config.SigningProfile{"intermediate": profile},
+		Default:  profile,
+	}
+
+	// Without a path length in the profile, intermediates get the
+	// default path length of one.
+	certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare-inter.com"}, Request: string(csr)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.MaxPathLen != 1 || cert.MaxPathLenZero {
+		t.Fatalf("Unexpected path length %d", cert.MaxPathLen)
+	}
+
+	profile.PathLenZero = true
+	profile.NameConstraints = &config.NameConstraints{
+		Critical:               true,
+		PermittedDNSDomains:    []string{"cloudflare.com"},
+		ExcludedDNSDomains:     []string{"secret.cloudflare.com"},
+		PermittedIPRanges:      []string{"10.0.0.0/8"},
+		ExcludedEmailAddresses: []string{"cloudflare.com"},
+	}
+	certBytes, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare-inter.com"}, Request: string(csr), Profile: "intermediate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.MaxPathLen != 0 || !cert.MaxPathLenZero {
+		t.Fatalf("Unexpected path length %d", cert.MaxPathLen)
+	}
+	if !cert.PermittedDNSDomainsCritical ||
+		!reflect.DeepEqual(cert.PermittedDNSDomains, []string{"cloudflare.com"}) ||
+		!reflect.DeepEqual(cert.ExcludedDNSDomains, []string{"secret.cloudflare.com"}) ||
+		!reflect.DeepEqual(cert.ExcludedEmailAddresses, []string{"cloudflare.com"}) {
+		t.Fatalf("Unexpected name constraints in %+v", cert)
+	}
+	if len(cert.PermittedIPRanges) != 1 || cert.PermittedIPRanges[0].String() != "10.0.0.0/8" {
+		t.Fatalf("Unexpected IP constraints %v", cert.PermittedIPRanges)
+	}
+
+	profile.PathLenZero = false
+	profile.MaxPathLen = 3
+	certBytes, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare-inter.com"}, Request: string(csr)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.MaxPathLen != 3 {
+		t.Fatalf("Unexpected path length %d", cert.MaxPathLen)
+	}
+}
+
+func TestSignRequestedCAConstraints(t *testing.T) {
+	// The test CA has a path length of one.
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	profile := &config.SigningProfile{
+		Usage:           []string{"cert sign", "crl sign"},
+		Expiry:          time.Hour,
+		CA:              true,
+		NameConstraints: &config.NameConstraints{PermittedDNSDomains: []string{"cloudflare.com"}},
+	}
+	s.policy = &config.Signing{
+		Profiles: map[string]*config.SigningProfile{"intermediate": profile},
+		Default:  &config.SigningProfile{Usage: []string{"server auth"}, Expiry: time.Hour},
+	}
+
+	sign := func(ca *cfcsr.CAConfig, profileName string) (*x509.Certificate, error) {
+		csrPEM, _, err := cfcsr.ParseRequest(&cfcsr.CertificateRequest{
+			CN:         "Test Intermediate CA",
+			KeyRequest: &cfcsr.KeyRequest{Algo: "ecdsa", Size: 256},
+			CA:         ca,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM), Profile: profileName})
+		if err != nil {
+			return nil, err
+		}
+		return helpers.ParseCertificatePEM(certBytes)
+	}
+
+	cert, err := sign(&cfcsr.CAConfig{
+		PathLenZero: true,
+		NameConstraints: &config.NameConstraints{
+			PermittedDNSDomains: []string{"www.cloudflare.com"},
+			ExcludedDNSDomains:  []string{"secret.www.cloudflare.com"},
+		},
+	}, "intermediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.IsCA || cert.MaxPathLen != 0 || !cert.MaxPathLenZero {
+		t.Fatalf("Unexpected path length %d", cert.MaxPathLen)
+	}
+	if !reflect.DeepEqual(cert.PermittedDNSDomains, []string{"www.cloudflare.com"}) ||
+		!reflect.DeepEqual(cert.ExcludedDNSDomains, []string{"secret.www.cloudflare.com"}) {
+		t.Fatalf("Unexpected name constraints %v %v", cert.PermittedDNSDomains, cert.ExcludedDNSDomains)
+	}
+
+	// Without requested name constraints, the profile's apply.
+	if cert, err = sign(&cfcsr.CAConfig{PathLenZero: true}, "intermediate"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cert.PermittedDNSDomains, []string{"cloudflare.com"}) {
+		t.Fatalf("Unexpected name constraints %v", cert.PermittedDNSDomains)
+	}
+
+	// Constraints beyond the bounds of the profile or of the issuer
+	// are refused.
+	for _, ca := range []*cfcsr.CAConfig{
+		{PathLength: 1},
+		{PathLenZero: true, NameConstraints: &config.NameConstraints{PermittedDNSDomains: []string{"example.com"}}},
+	} {
+		if _, err = sign(ca, "intermediate"); err == nil {
+			t.Fatalf("Expected error signing a CA asking for %+v", ca)
+		}
+	}
+	profile.MaxPathLen = 1
+	profile.PathLenZero = true
+	if _, err = sign(&cfcsr.CAConfig{PathLength: 1}, "intermediate"); err == nil {
+		t.Fatal("Expected error signing a CA asking for a path length beyond the profile's.")
+	}
+
+	// Leaf profiles ignore the requested constraints.
+	if cert, err = sign(&cfcsr.CAConfig{PathLength: 1, NameConstraints: &config.NameConstraints{PermittedDNSDomains: []string{"example.com"}}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if cert.IsCA || cert.PermittedDNSDomains != nil {
+		t.Fatal("Leaf certificate signed with CA constraints.")
+	}
+}
+
+func TestSignPoliciesAndExtensions(t *testing.T) {
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy.Default.Policies = []config.CertificatePolicy{
+		{ID: config.OID{2, 23, 140, 1, 2, 1}},
+		{
+			ID: config.OID{1, 3, 6, 1, 4, 1, 44947, 1, 1, 1},
+			Qualifiers: []config.CertificatePolicyQualifier{
+				{Type: config.CPSQualifier, Value: "https://cloudflare.com/cps"},
+				{Type: config.UserNoticeQualifier, Value: "Test notice"},
+			},
+		},
+	}
+	s.policy.Default.Extensions = []config.Extension{
+		{ID: config.OID{1, 3, 6, 1, 4, 1, 99999, 1}, Critical: false, Value: "0c0474657374"},
+	}
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certBytes, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csr)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.PolicyIdentifiers) != 2 ||
+		cert.PolicyIdentifiers[0].String() != "2.23.140.1.2.1" ||
+		cert.PolicyIdentifiers[1].String() != "1.3.6.1.4.1.44947.1.1.1" {
+		t.Fatalf("Unexpected policy identifiers %v", cert.PolicyIdentifiers)
+	}
+
+	var policiesExt, customExt []byte
+	for _, ext := range cert.Extensions {
+		switch ext.Id.String() {
+		case "2.5.29.32":
+			policiesExt = ext.Value
+		case "1.3.6.1.4.1.99999.1":
+			customExt = ext.Value
+		}
+	}
+	if !bytes.Contains(policiesExt, []byte("https://cloudflare.com/cps")) || !bytes.Contains(policiesExt, []byte("Test notice")) {
+		t.Fatal("Policy qualifiers missing from the certificate policies extension.")
+	}
+	if !bytes.Equal(customExt, []byte{0x0c, 0x04, 't', 'e', 's', 't'}) {
+		t.Fatalf("Unexpected custom extension value %x", customExt)
+	}
+}
+
+// newExistingCA returns a PEM-encoded self-signed CA certificate with
+// its own key, path length and subject key identifier.
+func newExistingCA(t *testing.T, isCA bool) []byte {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Existing CA", Organization: []string{"CloudFlare"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		MaxPathLen:            2,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+		DNSNames:              []string{"ca.cloudflare.com"},
+		OCSPServer:            []string{"http://ocsp.example.com"},
+	}
+	if !isCA {
+		template.MaxPathLen = 0
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCrossSign(t *testing.T) {
+	// The test CA has a path length of one.
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = &config.Signing{
+		Profiles: map[string]*config.SigningProfile{
+			"ca": {Usage: []string{"cert sign", "crl sign"}, Expiry: time.Hour, CA: true},
+		},
+		Default: &config.SigningProfile{Usage: []string{"server auth"}, Expiry: time.Hour},
+	}
+
+	existingPEM := newExistingCA(t, true)
+	existing, err := helpers.ParseCertificatePEM(existingPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBytes, err := s.Sign(signer.SignRequest{Request: string(existingPEM), Profile: "ca", CrossSign: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(cert.RawSubject, existing.RawSubject) {
+		t.Fatalf("Subject not kept: %v", cert.Subject)
+	}
+	if !bytes.Equal(cert.RawSubjectPublicKeyInfo, existing.RawSubjectPublicKeyInfo) {
+		t.Fatal("Public key not kept.")
+	}
+	if !bytes.Equal(cert.SubjectKeyId, existing.SubjectKeyId) {
+		t.Fatalf("Subject key identifier not kept: %x", cert.SubjectKeyId)
+	}
+	if !bytes.Equal(cert.AuthorityKeyId, s.ca.SubjectKeyId) {
+		t.Fatalf("Unexpected authority key identifier %x", cert.AuthorityKeyId)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, existing.DNSNames) {
+		t.Fatalf("Subject alternative names not kept: %v", cert.DNSNames)
+	}
+	if len(cert.OCSPServer) != 0 {
+		t.Fatalf("Issuer information of the existing certificate kept: %v", cert.OCSPServer)
+	}
+	// The path length is shortened to fit under the issuer's.
+	if !cert.IsCA || cert.MaxPathLen != 0 || !cert.MaxPathLenZero {
+		t.Fatalf("Unexpected path length %d", cert.MaxPathLen)
+	}
+	if err = cert.CheckSignatureFrom(s.ca); err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []signer.SignRequest{
+		{Request: string(newExistingCA(t, false)), Profile: "ca", CrossSign: true},
+		{Request: string(csr), Profile: "ca", CrossSign: true},
+		{Hosts: []string{"cloudflare.com"}, Request: string(existingPEM), Profile: "ca", CrossSign: true},
+		{Request: string(existingPEM), CrossSign: true},
+	} {
+		if _, err = s.Sign(req); err == nil {
+			t.Fatalf("Expected error cross-signing %+v", req)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package remote implements a certificate signer that sends signature
+// requests to a remote CF-SSL server.
+package remote
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+
+	"github.com/cloudflare/cfssl/api/client"
+	"github.com/cloudflare/cfssl/config"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// A Signer forwards signature requests to a remote CF-SSL server,
+// which signs them under its own policy. The Signer's policy is not
+// enforced locally; only the auth keys of its profiles are used, to
+// authenticate the requests.
+type Signer struct {
+	policy *config.Signing
+	server *client.Server
+}
+
+// NewSigner creates a new Signer sending signature requests to the
+// CF-SSL server at the given address.
+func NewSigner(policy *config.Signing, remote string) (*Signer, error) {
+	return NewSignerTLS(policy, remote, nil)
+}
+
+// NewSignerTLS creates a new Signer sending signature requests to the
+// CF-SSL server at the given address over HTTPS, with the TLS config.
+// If the TLS config is nil, the server is reached over HTTPS only if
+// the address starts with "https://".
+func NewSignerTLS(policy *config.Signing, remote string, tlsConfig *tls.Config) (*Signer, error) {
+	var server *client.Server
+	if tlsConfig != nil {
+		server = client.NewServerTLS(remote, tlsConfig)
+	} else {
+		server = client.NewServer(remote)
+	}
+	if server == nil {
+		return nil, cferr.New(cferr.DialError, cferr.Unknown, errors.New("invalid address for remote server "+remote))
+	}
+	return &Signer{policy: policy, server: server}, nil
+}
+
+// Sign sends the signature request to the remote server and returns
+// the certificate it signed. If the requested profile of the signer's
+// policy has an auth key, the request is authenticated with it.
+func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if profile := s.policy.Profile(req.Profile); profile != nil && profile.Provider != nil {
+		return s.server.AuthSign(jsonData, profile.Provider)
+	}
+	return s.server.Sign(jsonData)
+}
+
+// Certificate returns an error: the certificate of the remote CA is
+// not available through the remote API.
+func (s *Signer) Certificate() (*x509.Certificate, error) {
+	return nil, cferr.New(cferr.CertificateError, cferr.Unknown, errors.New("the CA certificate of a remote signer is not available"))
+}
+
+// Policy returns the signer's signing policy.
+func (s *Signer) Policy() *config.Signing {
+	return s.policy
+}
+
+// SetPolicy sets the signer's signing policy.
+func (s *Signer) SetPolicy(policy *config.Signing) {
+	s.policy = policy
+}
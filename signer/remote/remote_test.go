@@ -0,0 +1,147 @@
+package remote
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/signer"
+)
+
+var testHosts = []string{"cloudflare.com", "127.0.0.1"}
+
+var testNotAfter = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const testCertificate = "-----BEGIN CERTIFICATE-----\ntest\n-----END CERTIFICATE-----\n"
+
+// newTestServer starts a fake CF-SSL server whose sign endpoint checks
+// the request it receives and answers with testCertificate.
+func newTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(newTestHandler(t))
+}
+
+func newTestHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/cfssl/sign" {
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+		var req signer.SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(req.Hosts, testHosts) || req.Request != "csr" || req.Profile != "server" ||
+			!req.NotBefore.IsZero() || !req.NotAfter.Equal(testNotAfter) {
+			t.Errorf("Unexpected sign request %+v", req)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"result":  map[string]string{"certificate": testCertificate},
+		})
+	})
+}
+
+func TestSign(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	s, err := NewSigner(nil, strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := s.Sign(signer.SignRequest{Hosts: testHosts, Request: "csr", Profile: "server", NotAfter: testNotAfter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cert) != testCertificate {
+		t.Fatalf("Unexpected certificate %q", cert)
+	}
+
+	if _, err = s.Certificate(); err == nil {
+		t.Fatal("Expected error getting the certificate of a remote signer.")
+	}
+}
+
+func TestNewSignerInvalidAddress(t *testing.T) {
+	if _, err := NewSigner(nil, "127.0.0.1:port"); err == nil {
+		t.Fatal("Expected error creating a signer with an invalid address.")
+	}
+}
+
+// newClientCertificate creates a self-signed TLS client certificate.
+func newClientCertificate(t *testing.T) tls.Certificate {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
+
+func TestSignTLS(t *testing.T) {
+	clientCert := newClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	leaf, err := x509.ParseCertificate(clientCert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs.AddCert(leaf)
+
+	ts := httptest.NewUnstartedServer(newTestHandler(t))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	req := signer.SignRequest{Hosts: testHosts, Request: "csr", Profile: "server", NotAfter: testNotAfter}
+
+	s, err := NewSignerTLS(nil, ts.URL, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := s.Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cert) != testCertificate {
+		t.Fatalf("Unexpected certificate %q", cert)
+	}
+
+	// The server requires a client certificate.
+	s, err = NewSignerTLS(nil, ts.URL, &tls.Config{RootCAs: roots})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Sign(req); err == nil {
+		t.Fatal("Expected error signing without a client certificate.")
+	}
+
+	// The server's certificate is not trusted by default.
+	if s, err = NewSigner(nil, ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Sign(req); err == nil {
+		t.Fatal("Expected error signing with an untrusted server.")
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package serial
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile opens the lock file at path, creating it if needed, and
+// waits for an exclusive lock on it. The counter file itself cannot
+// be locked, as it is replaced on every update.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// unlockFile releases the lock taken by lockFile and closes the file.
+func unlockFile(f *os.File) error {
+	defer f.Close()
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,48 @@
+//go:build windows
+// +build windows
+
+package serial
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// lockfileExclusiveLock is the LOCKFILE_EXCLUSIVE_LOCK flag of
+// LockFileEx.
+const lockfileExclusiveLock = 2
+
+// lockFile opens the lock file at path, creating it if needed, and
+// waits for an exclusive lock on it. The counter file itself cannot
+// be locked, as it is replaced on every update.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	ol := new(syscall.Overlapped)
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(ol)))
+	if r == 0 {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// unlockFile releases the lock taken by lockFile and closes the file.
+func unlockFile(f *os.File) error {
+	defer f.Close()
+	ol := new(syscall.Overlapped)
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package serial generates the serial numbers of the certificates a
+// signer issues, either at random or from a persistent counter.
+package serial
+
+import (
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/cfssl/config"
+	cferr "github.com/cloudflare/cfssl/errors"
+)
+
+// A Generator produces the serial numbers of new certificates; they
+// must be positive and at most 20 octets long.
+type Generator interface {
+	Next() (*big.Int, error)
+}
+
+// New returns the Generator described by the config: a Counter if it
+// names a counter file, and otherwise a Random generator of the
+// configured length, or of the default length if the config is nil
+// or gives none.
+func New(cfg *config.SerialConfig) (Generator, error) {
+	if cfg == nil {
+		return NewRandom(config.DefaultSerialLength)
+	}
+	if cfg.CounterFile != "" {
+		return NewCounter(cfg.CounterFile)
+	}
+	if cfg.Length == 0 {
+		return NewRandom(config.DefaultSerialLength)
+	}
+	return NewRandom(cfg.Length)
+}
+
+// A Random generator produces random serial numbers of a fixed length
+// in octets, of which all bits but the sign bit are random.
+type Random struct {
+	length int
+}
+
+// NewRandom returns a Random generator of serial numbers of the given
+// length in octets, which must give at least 64 random bits and fit
+// in 20 octets.
+func NewRandom(length int) (*Random, error) {
+	if length < config.MinSerialLength || length > config.MaxSerialLength {
+		return nil, cferr.New(cferr.PolicyError, cferr.InvalidPolicy,
+			errors.New("serial number length must be between 9 and 20 octets"))
+	}
+	return &Random{length: length}, nil
+}
+
+// Next returns a new random serial number. The top bit is cleared so
+// that the DER encoding of the number fits in the configured length.
+func (r *Random) Next() (*big.Int, error) {
+	b := make([]byte, r.length)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return nil, cferr.New(cferr.CertificateError, cferr.Unknown, err)
+		}
+		b[0] &= 0x7f
+		serial := new(big.Int).SetBytes(b)
+		if serial.Sign() > 0 {
+			return serial, nil
+		}
+	}
+}
+
+// A Counter produces consecutive serial numbers, recording the last
+// one in a file so that the count survives restarts. Counters in
+// several processes may share a counter file: each serial number is
+// taken with the lock file next to it held, from the count as recorded
+// in the file at the time.
+type Counter struct {
+	path string
+	lock sync.Mutex
+}
+
+// maxSerial is the largest serial number that fits in 20 octets.
+var maxSerial = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 8*config.MaxSerialLength-1), big.NewInt(1))
+
+// NewCounter returns a Counter whose state is kept in the file at
+// path, and whose lock file is path with a ".lock" suffix. If the
+// counter file does not exist, the count starts at 1.
+func NewCounter(path string) (*Counter, error) {
+	c := &Counter{path: path}
+	if _, err := c.read(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Next returns the next serial number, once the counter file records
+// it as used.
+func (c *Counter) Next() (*big.Int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	lock, err := lockFile(c.path + ".lock")
+	if err != nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.Unknown, err)
+	}
+	defer unlockFile(lock)
+
+	last, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	next := new(big.Int).Add(last, big.NewInt(1))
+	if next.Cmp(maxSerial) > 0 {
+		return nil, cferr.New(cferr.CertificateError, cferr.Unknown, errors.New("serial number counter exhausted"))
+	}
+	if err = c.save(next); err != nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.Unknown, err)
+	}
+	return next, nil
+}
+
+// read returns the last serial number recorded in the counter file,
+// or zero if there is no counter file yet.
+func (c *Counter) read() (*big.Int, error) {
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return new(big.Int), nil
+	} else if err != nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.ReadFailed, err)
+	}
+
+	last, ok := new(big.Int).SetString(strings.TrimSpace(string(data)), 10)
+	if !ok || last.Sign() < 0 {
+		return nil, cferr.New(cferr.CertificateError, cferr.DecodeFailed,
+			errors.New("invalid serial number counter in "+c.path))
+	}
+	return last, nil
+}
+
+// save writes the counter to a temporary file, flushed to disk, and
+// renames it over the counter file, so that neither a failed write
+// nor a crash loses the count.
+func (c *Counter) save(last *big.Int) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(last.String() + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
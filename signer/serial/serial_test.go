@@ -0,0 +1,174 @@
+package serial
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/cfssl/config"
+)
+
+func TestRandom(t *testing.T) {
+	for _, length := range []int{config.MinSerialLength, config.DefaultSerialLength, config.MaxSerialLength} {
+		r, err := NewRandom(length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := map[string]bool{}
+		for i := 0; i < 100; i++ {
+			serial, err := r.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if serial.Sign() <= 0 {
+				t.Fatalf("Serial number %v is not positive", serial)
+			}
+			if serial.BitLen() > 8*length-1 {
+				t.Fatalf("Serial number %v is longer than %d octets", serial, length)
+			}
+			if seen[serial.String()] {
+				t.Fatalf("Serial number %v repeated", serial)
+			}
+			seen[serial.String()] = true
+		}
+	}
+}
+
+func TestNewRandomInvalidLength(t *testing.T) {
+	for _, length := range []int{0, config.MinSerialLength - 1, config.MaxSerialLength + 1} {
+		if _, err := NewRandom(length); err == nil {
+			t.Fatalf("Expected error creating a generator of %d octets.", length)
+		}
+	}
+}
+
+func TestCounter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-serial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "serial")
+
+	c, err := NewCounter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		serial, err := c.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if serial.Int64() != i {
+			t.Fatalf("Expected serial number %d, got %v", i, serial)
+		}
+	}
+
+	// The count carries on from the file.
+	c, err = NewCounter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := c.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial.Int64() != 4 {
+		t.Fatalf("Expected serial number 4, got %v", serial)
+	}
+
+	if err = ioutil.WriteFile(path, []byte("not a number\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewCounter(path); err == nil {
+		t.Fatal("Expected error loading an invalid counter file.")
+	}
+}
+
+// Counters sharing a counter file, as those of several processes do,
+// never hand out the same serial number.
+func TestCounterShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-serial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "serial")
+
+	var counters []*Counter
+	for i := 0; i < 2; i++ {
+		c, err := NewCounter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counters = append(counters, c)
+	}
+
+	const n = 50
+	var wg sync.WaitGroup
+	serials := make(chan int64, len(counters)*n)
+	for _, c := range counters {
+		wg.Add(1)
+		go func(c *Counter) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				serial, err := c.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				serials <- serial.Int64()
+			}
+		}(c)
+	}
+	wg.Wait()
+	close(serials)
+
+	seen := map[int64]bool{}
+	for serial := range serials {
+		if seen[serial] {
+			t.Fatalf("Serial number %d handed out twice", serial)
+		}
+		seen[serial] = true
+	}
+	if len(seen) != len(counters)*n {
+		t.Fatalf("Expected %d serial numbers, got %d", len(counters)*n, len(seen))
+	}
+}
+
+func TestNew(t *testing.T) {
+	g, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := g.(*Random); !ok || r.length != config.DefaultSerialLength {
+		t.Fatalf("Unexpected default generator %+v", g)
+	}
+
+	g, err = New(&config.SerialConfig{Length: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := g.(*Random); !ok || r.length != 12 {
+		t.Fatalf("Unexpected generator %+v", g)
+	}
+
+	dir, err := ioutil.TempDir("", "cfssl-serial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	g, err = New(&config.SerialConfig{CounterFile: filepath.Join(dir, "serial")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.(*Counter); !ok {
+		t.Fatalf("Unexpected generator %+v", g)
+	}
+
+	if _, err = New(&config.SerialConfig{Length: 4}); err == nil {
+		t.Fatal("Expected error creating a generator of 4 octets.")
+	}
+}
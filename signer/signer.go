@@ -1,79 +1,72 @@
 // Package signer implements certificate signature functionality for CF-SSL.
+// The Signer interface is implemented by the local package, which signs
+// certificates with a CA's private key, and by the remote package, which
+// sends signature requests to a remote CF-SSL server.
 package signer
 
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha1"
+	_ "crypto/sha1"
 	_ "crypto/sha256"
 	_ "crypto/sha512"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
-	"io/ioutil"
-	"math"
 	"math/big"
+	"strings"
 	"time"
 
 	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/csr"
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
-	"github.com/cloudflare/cfssl/log"
 )
 
-// A Signer contains a CA's certificate and private key for signing
-// certificates, a Signing policy to refer to and a SignatureAlgorithm
-//
-type Signer struct {
-	CA      *x509.Certificate
-	Priv    interface{}
-	Policy  *config.Signing
-	SigAlgo x509.SignatureAlgorithm
+// A SignRequest stores a signature request: the PEM-encoded client
+// certificate or certificate request to sign, the hosts the
+// certificate is for and the name of the signing profile to use. If
+// no hosts are given, the certificate is only valid for the hosts
+// named in the certificate request when the signing profile allows
+// it. NotBefore and NotAfter, if not zero, ask for the certificate to
+// be valid from or until the given time, within the bounds the
+// signing profile sets. The requester identifies who the certificate
+// is issued for, in the record kept by signers that have a
+// certificate database; it is not sent to remote signers. If
+// CrossSign is set, the request is an existing CA certificate, which is
+// issued again under the signer's CA with the same subject, public key
+// and subject key identifier.
+type SignRequest struct {
+	Hosts     []string  `json:"hosts"`
+	Request   string    `json:"certificate_request"`
+	Profile   string    `json:"profile"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	CrossSign bool      `json:"cross_sign"`
+	Requester string    `json:"-"`
 }
 
-// NewSigner generates a new certificate signer using the certificate
-// authority certificate and private key and Signing config for signing. caFile should
-// contain the CA's certificate, and the cakeyFile should contain the
-// private key. Both must be PEM-encoded.
-func NewSigner(caFile, cakeyFile string, policy *config.Signing) (*Signer, error) {
-	if policy == nil {
-		policy = &config.Signing{
-			Profiles: map[string]*config.SigningProfile{},
-			Default:  config.DefaultConfig(),
-		}
-	}
-
-	if !policy.Valid() {
-		return nil, cferr.New(cferr.PolicyError, cferr.InvalidPolicy, errors.New("invalid policy"))
-	}
-
-	log.Debug("Loading CA: ", caFile)
-	ca, err := ioutil.ReadFile(caFile)
-	if err != nil {
-		return nil, err
-	}
-	log.Debug("Loading CA key: ", cakeyFile)
-	cakey, err := ioutil.ReadFile(cakeyFile)
-	if err != nil {
-		return nil, err
-	}
-
-	parsedCa, err := helpers.ParseCertificatePEM(ca)
-	if err != nil {
-		return nil, err
-	}
-
-	priv, err := helpers.ParsePrivateKeyPEM(cakey)
-	if err != nil {
-
-		return nil, err
-	}
-
-	return &Signer{parsedCa, priv, policy, DefaultSigAlgo(priv)}, nil
+// A Signer issues certificates according to a signing policy.
+//
+// Sign signs a certificate request, returning the PEM-encoded
+// certificate.
+//
+// Certificate returns the certificate of the CA that signs the
+// certificates.
+//
+// Policy and SetPolicy give access to the signing policy that is
+// applied to sign requests.
+type Signer interface {
+	Sign(req SignRequest) (cert []byte, err error)
+	Certificate() (*x509.Certificate, error)
+	Policy() *config.Signing
+	SetPolicy(*config.Signing)
 }
 
 // DefaultSigAlgo returns an appropriate X.509 signature algorithm given the
@@ -103,137 +96,376 @@ func DefaultSigAlgo(priv interface{}) x509.SignatureAlgorithm {
 		default:
 			return x509.ECDSAWithSHA1
 		}
+	case ed25519.PrivateKey:
+		return x509.PureEd25519
 	default:
 		return x509.UnknownSignatureAlgorithm
 	}
 }
 
-func (s *Signer) sign(template *x509.Certificate, profile *config.SigningProfile) (cert []byte, err error) {
-	pub := template.PublicKey
-	encodedpub, err := x509.MarshalPKIXPublicKey(pub)
+// PSSSigAlgo returns the RSA-PSS signature algorithm with the hash of
+// the given PKCS#1 v1.5 RSA signature algorithm. PSS is not used with
+// SHA-1, which gives SHA-256 instead. Algorithms that are not RSA
+// give x509.UnknownSignatureAlgorithm.
+func PSSSigAlgo(algo x509.SignatureAlgorithm) x509.SignatureAlgorithm {
+	switch algo {
+	case x509.SHA1WithRSA, x509.SHA256WithRSA, x509.SHA256WithRSAPSS:
+		return x509.SHA256WithRSAPSS
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS:
+		return x509.SHA384WithRSAPSS
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS:
+		return x509.SHA512WithRSAPSS
+	default:
+		return x509.UnknownSignatureAlgorithm
+	}
+}
+
+// SigAlgoFitsKey reports whether the signature algorithm is one that
+// private keys of the type of the public key sign with.
+func SigAlgoFitsKey(algo x509.SignatureAlgorithm, pub crypto.PublicKey) bool {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		switch algo {
+		case x509.SHA1WithRSA, x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+			x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		switch algo {
+		case x509.ECDSAWithSHA1, x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+			return true
+		}
+	case ed25519.PublicKey:
+		return algo == x509.PureEd25519
+	}
+	return false
+}
+
+// ParseCertificateRequest takes a DER-encoded certificate request,
+// checks its signature and returns a template for the certificate to
+// be signed with the given signature algorithm. The template holds
+// the basic and name constraints the request asks for, which signers
+// only grant to CA certificates within the bounds of their policy.
+func ParseCertificateRequest(csrBytes []byte, sigAlgo x509.SignatureAlgorithm) (template *x509.Certificate, err error) {
+	req, err := x509.ParseCertificateRequest(csrBytes)
 	if err != nil {
+		err = cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
 		return
 	}
-	pubhash := sha1.New()
-	pubhash.Write(encodedpub)
 
-	if profile == nil {
-		profile = s.Policy.Default
+	err = checkSignature(req, req.SignatureAlgorithm, req.RawTBSCertificateRequest, req.Signature)
+	if err != nil {
+		err = cferr.New(cferr.CertificateError, cferr.KeyMismatch, err)
+		return
 	}
 
-	var (
-		eku             []x509.ExtKeyUsage
-		ku              x509.KeyUsage
-		expiry          time.Duration
-		crlURL, ocspURL string
-	)
+	template = &x509.Certificate{
+		Subject:            req.Subject,
+		PublicKeyAlgorithm: req.PublicKeyAlgorithm,
+		PublicKey:          req.PublicKey,
+		SignatureAlgorithm: sigAlgo,
+		DNSNames:           req.DNSNames,
+		IPAddresses:        req.IPAddresses,
+		EmailAddresses:     req.EmailAddresses,
+		URIs:               req.URIs,
+		MaxPathLen:         -1,
+	}
 
-	// The third value returned from Usages is a list of unknown key usages.
-	// This should be used when validating the profile at load, and isn't used
-	// here.
-	ku, eku, _ = profile.Usages()
-	expiry = profile.Expiry
-	if profile.IssuerURL == nil {
-		profile.IssuerURL = s.Policy.Default.IssuerURL
+	if err = csr.ParseCAExtensions(template, req.Extensions); err != nil {
+		err = cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
+		template = nil
 	}
+	return
+}
 
-	if ku == 0 && len(eku) == 0 {
-		err = cferr.New(cferr.PolicyError, cferr.NoKeyUsages, errors.New("no key usage available"))
-		return
+// ParseSignRequest parses the PEM-encoded certificate request or
+// self-signed certificate of the sign request into a template of the
+// certificate to sign under the profile. The certificate is for the
+// hosts named in the request or, if the request names none and the
+// profile allows it, for the subject alternative names of the
+// certificate request. Without hosts, only CA certificates may be
+// signed, without subject alternative names. Cross-sign requests are
+// parsed by ParseCrossSignRequest.
+func ParseSignRequest(req SignRequest, profile *config.SigningProfile, sigAlgo x509.SignatureAlgorithm) (template *x509.Certificate, err error) {
+	if req.CrossSign {
+		return ParseCrossSignRequest(req, profile, sigAlgo)
 	}
 
-	if expiry == 0 {
-		expiry = s.Policy.Default.Expiry
+	block, _ := pem.Decode([]byte(req.Request))
+	if block == nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.DecodeFailed, nil)
 	}
 
-	if crlURL = profile.CRL; crlURL == "" {
-		crlURL = s.Policy.Default.CRL
+	switch block.Type {
+	case "CERTIFICATE":
+		template, err = helpers.ParseSelfSignedCertificatePEM([]byte(req.Request))
+	case "CERTIFICATE REQUEST":
+		template, err = ParseCertificateRequest(block.Bytes, sigAlgo)
+	default:
+		return nil, cferr.New(cferr.CertificateError, cferr.ParseFailed, errors.New("Not a certificate or csr."))
 	}
-	if ocspURL = profile.OCSP; ocspURL == "" {
-		ocspURL = s.Policy.Default.OCSP
+	if err != nil {
+		return
 	}
 
-	now := time.Now()
-	serialNumber, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+	if len(req.Hosts) > 0 {
+		OverrideHosts(template, req.Hosts)
+	} else if !profile.AllowCSRHosts {
+		if !profile.CA {
+			return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("no hosts given"))
+		}
+		OverrideHosts(template, nil)
+	}
+	return template, nil
+}
+
+// ParseCrossSignRequest parses the PEM-encoded CA certificate of a
+// cross-sign request into a template of the certificate to sign under
+// the profile, which must be a CA profile. The template keeps the
+// subject, public key, subject key identifier and subject alternative
+// names of the certificate, along with the basic and name constraints
+// it holds, which signers grant within the bounds of their policy.
+// Everything else, such as the validity, key usages and issuer
+// information, comes from the profile.
+func ParseCrossSignRequest(req SignRequest, profile *config.SigningProfile, sigAlgo x509.SignatureAlgorithm) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(req.Request))
+	if block == nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.DecodeFailed, nil)
+	}
+	if block.Type != "CERTIFICATE" {
+		return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("only certificates can be cross-signed"))
+	}
+	cert, err := helpers.ParseCertificatePEM([]byte(req.Request))
 	if err != nil {
-		err = cferr.New(cferr.CertificateError, cferr.Unknown, err)
+		return nil, err
+	}
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("only CA certificates can be cross-signed"))
+	}
+	if !profile.CA {
+		return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("cross-signing requires a CA signing profile"))
+	}
+	if len(req.Hosts) > 0 {
+		return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("hosts cannot be given when cross-signing"))
 	}
 
-	template.SerialNumber = serialNumber
-	template.NotBefore = now.Add(-5 * time.Minute).UTC()
-	template.NotAfter = now.Add(expiry).UTC()
-	template.KeyUsage = ku
-	template.ExtKeyUsage = eku
-	template.BasicConstraintsValid = true
-	template.IsCA = profile.CA
-	template.SubjectKeyId = pubhash.Sum(nil)
+	return &x509.Certificate{
+		RawSubject:                  cert.RawSubject,
+		Subject:                     cert.Subject,
+		PublicKeyAlgorithm:          cert.PublicKeyAlgorithm,
+		PublicKey:                   cert.PublicKey,
+		SignatureAlgorithm:          sigAlgo,
+		SubjectKeyId:                cert.SubjectKeyId,
+		DNSNames:                    cert.DNSNames,
+		IPAddresses:                 cert.IPAddresses,
+		EmailAddresses:              cert.EmailAddresses,
+		URIs:                        cert.URIs,
+		BasicConstraintsValid:       true,
+		IsCA:                        true,
+		MaxPathLen:                  cert.MaxPathLen,
+		MaxPathLenZero:              cert.MaxPathLenZero,
+		PermittedDNSDomainsCritical: cert.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         cert.PermittedDNSDomains,
+		ExcludedDNSDomains:          cert.ExcludedDNSDomains,
+		PermittedIPRanges:           cert.PermittedIPRanges,
+		ExcludedIPRanges:            cert.ExcludedIPRanges,
+		PermittedEmailAddresses:     cert.PermittedEmailAddresses,
+		ExcludedEmailAddresses:      cert.ExcludedEmailAddresses,
+	}, nil
+}
 
-	if ocspURL != "" {
-		template.OCSPServer = []string{ocspURL}
+// DefaultBackdate is how far before the time of signing certificates
+// become valid when the signing policy sets no backdate, to allow for
+// clock skew.
+const DefaultBackdate = 5 * time.Minute
+
+// Validity returns the validity window of a certificate signed at the
+// given time for the sign request, under the policy. The window
+// requested must start no earlier than the backdate of the requested
+// profile before now, and end no later than its expiry after now.
+func Validity(req SignRequest, policy *config.Signing, now time.Time) (notBefore, notAfter time.Time, err error) {
+	profile := policy.Profile(req.Profile)
+	expiry := profile.Expiry
+	if expiry == 0 {
+		expiry = policy.Default.Expiry
 	}
-	if crlURL != "" {
-		template.CRLDistributionPoints = []string{crlURL}
+	backdate := profile.Backdate
+	if backdate == 0 {
+		backdate = policy.Default.Backdate
 	}
-
-	if len(profile.IssuerURL) != 0 {
-		template.IssuingCertificateURL = profile.IssuerURL
+	if backdate == 0 {
+		backdate = DefaultBackdate
 	}
 
-	var initRoot bool
-	if s.CA == nil {
-		if !template.IsCA {
-			err = cferr.New(cferr.PolicyError, cferr.InvalidRequest, nil)
+	notBefore = now.Add(-backdate)
+	notAfter = now.Add(expiry)
+	if !req.NotBefore.IsZero() {
+		if req.NotBefore.Before(notBefore) {
+			err = cferr.New(cferr.PolicyError, cferr.InvalidRequest,
+				errors.New("not_before is earlier than the signing profile allows"))
 			return
 		}
-		template.DNSNames = nil
-		s.CA = template
-		initRoot = true
-		template.MaxPathLen = 2
-	} else if template.IsCA {
-		template.MaxPathLen = 1
-		template.DNSNames = nil
+		notBefore = req.NotBefore
 	}
+	if !req.NotAfter.IsZero() {
+		if req.NotAfter.After(notAfter) {
+			err = cferr.New(cferr.PolicyError, cferr.InvalidRequest,
+				errors.New("not_after is later than the signing profile allows"))
+			return
+		}
+		notAfter = req.NotAfter
+	}
+	if !notAfter.After(notBefore) {
+		err = cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("not_after is not later than not_before"))
+		return
+	}
+	return notBefore.UTC(), notAfter.UTC(), nil
+}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, template, s.CA, pub, s.Priv)
+// Validate checks the sign request against the policy without
+// signing it: the request must parse, name hosts allowed by the name
+// policy of the requested profile, and ask for a validity window
+// within its bounds. Signers that have requests signed elsewhere
+// validate them first.
+func Validate(req SignRequest, policy *config.Signing) error {
+	profile := policy.Profile(req.Profile)
+	template, err := ParseSignRequest(req, profile, x509.UnknownSignatureAlgorithm)
 	if err != nil {
-		return
+		return err
 	}
-	if initRoot {
-		s.CA, err = x509.ParseCertificate(derBytes)
-		if err != nil {
-			err = cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
-			return
+	if err = profile.NamePolicy.CheckNames(template); err != nil {
+		return cferr.New(cferr.PolicyError, cferr.NameNotAllowed, err)
+	}
+	_, _, err = Validity(req, policy, time.Now())
+	return err
+}
+
+// SplitHosts takes a comma-separated list of hosts, as given on the
+// command line, and returns the hosts in a slice. Spaces around the
+// hosts and empty entries are dropped; a list without hosts gives a
+// nil slice.
+func SplitHosts(hostList string) []string {
+	var hosts []string
+	for _, host := range strings.Split(hostList, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
 		}
 	}
-	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	return
+	return hosts
 }
 
-func (s *Signer) parseCertificateRequest(csrBytes []byte) (template *x509.Certificate, err error) {
-	csr, err := x509.ParseCertificateRequest(csrBytes)
-	if err != nil {
-		err = cferr.New(cferr.CertificateError, cferr.ParseFailed, err)
-		return
+// OverrideHosts replaces the subject alternative names of the
+// certificate template with the given hosts, each of which goes in
+// the kind of SAN given by csr.ParseHosts.
+func OverrideHosts(template *x509.Certificate, hosts []string) {
+	template.DNSNames, template.IPAddresses, template.EmailAddresses, template.URIs = csr.ParseHosts(hosts)
+}
+
+// Object identifiers of the certificate policies extension and of its
+// policy qualifiers, from RFC 5280.
+var (
+	certificatePoliciesOID = asn1.ObjectIdentifier{2, 5, 29, 32}
+	cpsQualifierOID        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	userNoticeQualifierOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+)
+
+// policyInformation is the ASN.1 structure of a certificate policy,
+// whose qualifiers are encoded separately as their type varies.
+type policyInformation struct {
+	PolicyIdentifier asn1.ObjectIdentifier
+	Qualifiers       []asn1.RawValue `asn1:"omitempty"`
+}
+
+type cpsPolicyQualifier struct {
+	PolicyQualifierID asn1.ObjectIdentifier
+	Qualifier         string `asn1:"ia5"`
+}
+
+type userNotice struct {
+	ExplicitText string `asn1:"utf8"`
+}
+
+type userNoticePolicyQualifier struct {
+	PolicyQualifierID asn1.ObjectIdentifier
+	Qualifier         userNotice
+}
+
+// AddPolicies adds the certificate policies to the certificate
+// template. Since Go only encodes the policy OIDs of a certificate,
+// the extension carrying the policies and their qualifiers is encoded
+// here and added to the template's extra extensions.
+func AddPolicies(template *x509.Certificate, policies []config.CertificatePolicy) error {
+	if len(policies) == 0 {
+		return nil
 	}
 
-	err = checkSignature(csr, csr.SignatureAlgorithm, csr.RawTBSCertificateRequest, csr.Signature)
-	if err != nil {
-		err = cferr.New(cferr.CertificateError, cferr.KeyMismatch, err)
-		return
+	var infos []policyInformation
+	for _, policy := range policies {
+		info := policyInformation{PolicyIdentifier: asn1.ObjectIdentifier(policy.ID)}
+		for _, qualifier := range policy.Qualifiers {
+			var encoded []byte
+			var err error
+			switch qualifier.Type {
+			case config.CPSQualifier:
+				encoded, err = asn1.Marshal(cpsPolicyQualifier{cpsQualifierOID, qualifier.Value})
+			case config.UserNoticeQualifier:
+				encoded, err = asn1.Marshal(userNoticePolicyQualifier{userNoticeQualifierOID, userNotice{qualifier.Value}})
+			default:
+				err = errors.New("unknown policy qualifier type " + qualifier.Type)
+			}
+			if err != nil {
+				return err
+			}
+			info.Qualifiers = append(info.Qualifiers, asn1.RawValue{FullBytes: encoded})
+		}
+		infos = append(infos, info)
+		template.PolicyIdentifiers = append(template.PolicyIdentifiers, info.PolicyIdentifier)
 	}
 
-	template = &x509.Certificate{
-		Subject:            csr.Subject,
-		PublicKeyAlgorithm: csr.PublicKeyAlgorithm,
-		PublicKey:          csr.PublicKey,
-		SignatureAlgorithm: s.SigAlgo,
+	value, err := asn1.Marshal(infos)
+	if err != nil {
+		return err
 	}
+	template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+		Id:    certificatePoliciesOID,
+		Value: value,
+	})
+	return nil
+}
 
-	return
+// AddExtensions adds the extensions to the certificate template. An
+// extension replaces any extension with the same OID that would be
+// derived from the template's fields.
+func AddExtensions(template *x509.Certificate, extensions []config.Extension) error {
+	for _, ext := range extensions {
+		value, err := hex.DecodeString(ext.Value)
+		if err != nil {
+			return err
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id:       asn1.ObjectIdentifier(ext.ID),
+			Critical: ext.Critical,
+			Value:    value,
+		})
+	}
+	return nil
 }
 
 func checkSignature(csr *x509.CertificateRequest, algo x509.SignatureAlgorithm, signed, signature []byte) error {
+	// Ed25519 signs the message itself rather than a digest of it.
+	if algo == x509.PureEd25519 {
+		pub, ok := csr.PublicKey.(ed25519.PublicKey)
+		if !ok {
+			return x509.ErrUnsupportedAlgorithm
+		}
+		if !ed25519.Verify(pub, signed, signature) {
+			return errors.New("x509: Ed25519 verification failure")
+		}
+		return nil
+	}
+
 	var hashType crypto.Hash
+	var pss bool
 
 	switch algo {
 	case x509.SHA1WithRSA, x509.ECDSAWithSHA1:
@@ -244,6 +476,12 @@ func checkSignature(csr *x509.CertificateRequest, algo x509.SignatureAlgorithm,
 		hashType = crypto.SHA384
 	case x509.SHA512WithRSA, x509.ECDSAWithSHA512:
 		hashType = crypto.SHA512
+	case x509.SHA256WithRSAPSS:
+		hashType, pss = crypto.SHA256, true
+	case x509.SHA384WithRSAPSS:
+		hashType, pss = crypto.SHA384, true
+	case x509.SHA512WithRSAPSS:
+		hashType, pss = crypto.SHA512, true
 	default:
 		return x509.ErrUnsupportedAlgorithm
 	}
@@ -258,8 +496,16 @@ func checkSignature(csr *x509.CertificateRequest, algo x509.SignatureAlgorithm,
 
 	switch pub := csr.PublicKey.(type) {
 	case *rsa.PublicKey:
+		if pss {
+			// The salt is as long as the hash, as x509 requires
+			// of the parameters of PSS signatures.
+			return rsa.VerifyPSS(pub, hashType, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
 		return rsa.VerifyPKCS1v15(pub, hashType, digest, signature)
 	case *ecdsa.PublicKey:
+		if pss {
+			return x509.ErrUnsupportedAlgorithm
+		}
 		ecdsaSig := new(struct{ R, S *big.Int })
 		if _, err := asn1.Unmarshal(signature, ecdsaSig); err != nil {
 			return err
@@ -274,31 +520,3 @@ func checkSignature(csr *x509.CertificateRequest, algo x509.SignatureAlgorithm,
 	}
 	return x509.ErrUnsupportedAlgorithm
 }
-
-// Sign signs a new certificate based on the PEM-encoded client
-// certificate or certificate request with the signing profile, specified by profileName.
-// The certificate will be valid for the host named in  the hostName parameter.
-func (s *Signer) Sign(hostName string, in []byte, profileName string) (cert []byte, err error) {
-	profile := s.Policy.Profiles[profileName]
-
-	block, _ := pem.Decode(in)
-	if block == nil {
-		return nil, cferr.New(cferr.CertificateError, cferr.DecodeFailed, err)
-	}
-
-	var template *x509.Certificate
-	switch block.Type {
-	case "CERTIFICATE":
-		template, err = helpers.ParseSelfSignedCertificatePEM(in)
-	case "CERTIFICATE REQUEST":
-		template, err = s.parseCertificateRequest(block.Bytes)
-	default:
-		return nil, cferr.New(cferr.CertificateError, cferr.ParseFailed, errors.New("Not a certificate or csr."))
-	}
-	if err != nil {
-		return
-	}
-
-	template.DNSNames = []string{hostName}
-	return s.sign(template, profile)
-}
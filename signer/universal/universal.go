@@ -0,0 +1,139 @@
+// Package universal implements a certificate signer that signs
+// requests locally or forwards them to remote CF-SSL servers, as the
+// requested signing profile directs.
+package universal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/config"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+	"github.com/cloudflare/cfssl/signer/remote"
+)
+
+// A Signer signs requests for profiles without a remote server with
+// its local CA, and forwards requests for profiles with one to that
+// server, once they pass the checks of the policy. The local signer
+// is missing if the CA cannot be loaded but some profile has a remote
+// server; requests for local profiles then fail.
+type Signer struct {
+	local   *local.Signer
+	remotes map[string]*remote.Signer
+	policy  *config.Signing
+}
+
+// NewSigner creates a new Signer under the policy. Requests for
+// profiles without a remote server are signed with the CA certificate
+// and key in the given files; requests for profiles with one are
+// forwarded to it over HTTPS with the TLS config, if not nil. The CA
+// files are only required if no profile has a remote server.
+func NewSigner(policy *config.Signing, caFile, caKeyFile string, tlsConfig *tls.Config) (*Signer, error) {
+	s := &Signer{remotes: map[string]*remote.Signer{}, policy: policy}
+	if err := s.setRemotes(policy, tlsConfig); err != nil {
+		return nil, err
+	}
+
+	ls, err := local.NewSignerFromFile(caFile, caKeyFile, policy)
+	if err != nil {
+		if len(s.remotes) == 0 {
+			return nil, err
+		}
+		log.Warningf("signing with remote servers only: %v", err)
+	} else {
+		s.local = ls
+		s.policy = ls.Policy()
+	}
+	return s, nil
+}
+
+// setRemotes creates a remote signer for each remote server of the
+// profiles of the policy.
+func (s *Signer) setRemotes(policy *config.Signing, tlsConfig *tls.Config) error {
+	for _, profile := range profiles(policy) {
+		if profile.RemoteServer == "" || s.remotes[profile.RemoteServer] != nil {
+			continue
+		}
+		rs, err := remote.NewSignerTLS(policy, profile.RemoteServer, tlsConfig)
+		if err != nil {
+			return err
+		}
+		s.remotes[profile.RemoteServer] = rs
+	}
+	return nil
+}
+
+// profiles returns the default profile and the named profiles of the
+// policy.
+func profiles(policy *config.Signing) []*config.SigningProfile {
+	if policy == nil {
+		return nil
+	}
+	ps := []*config.SigningProfile{policy.Default}
+	for _, p := range policy.Profiles {
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// Sign signs the request under the requested profile. If the profile
+// has a remote server, the request is validated against the policy
+// and then sent to the server, which signs it; otherwise it is signed
+// by the local CA.
+func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
+	profile := s.policy.Profile(req.Profile)
+	if profile != nil && profile.RemoteServer != "" {
+		rs := s.remotes[profile.RemoteServer]
+		if rs == nil {
+			return nil, cferr.New(cferr.DialError, cferr.Unknown, errors.New("no signer for remote server "+profile.RemoteServer))
+		}
+		if err = signer.Validate(req, s.policy); err != nil {
+			return nil, err
+		}
+		return rs.Sign(req)
+	}
+
+	if s.local == nil {
+		return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest, errors.New("no local CA to sign with"))
+	}
+	return s.local.Sign(req)
+}
+
+// Certificate returns the certificate of the local CA, or an error if
+// the Signer has none.
+func (s *Signer) Certificate() (*x509.Certificate, error) {
+	if s.local == nil {
+		return nil, cferr.New(cferr.CertificateError, cferr.Unknown, errors.New("no local CA certificate"))
+	}
+	return s.local.Certificate()
+}
+
+// Policy returns the signer's signing policy.
+func (s *Signer) Policy() *config.Signing {
+	return s.policy
+}
+
+// SetPolicy sets the signer's signing policy. Requests for profiles
+// naming remote servers that the Signer was not created with fail.
+func (s *Signer) SetPolicy(policy *config.Signing) {
+	s.policy = policy
+	if s.local != nil {
+		s.local.SetPolicy(policy)
+	}
+	for _, rs := range s.remotes {
+		rs.SetPolicy(policy)
+	}
+}
+
+// SetDBAccessor sets the certificate database of the local signer,
+// which records the certificates it signs.
+func (s *Signer) SetDBAccessor(dba certdb.Accessor) {
+	if s.local != nil {
+		s.local.SetDBAccessor(dba)
+	}
+}
@@ -0,0 +1,156 @@
+package universal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+const (
+	testCaFile    = "../local/testdata/ecdsa256_ca.pem"
+	testCaKeyFile = "../local/testdata/ecdsa256_ca_key.pem"
+	testCSRFile   = "../local/testdata/ecdsa256.csr"
+)
+
+const testCertificate = "-----BEGIN CERTIFICATE-----\ntest\n-----END CERTIFICATE-----\n"
+
+// newTestServer starts a fake CF-SSL server that answers every sign
+// request with testCertificate, counting the requests it receives.
+func newTestServer(count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(count, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"result":  map[string]string{"certificate": testCertificate},
+		})
+	}))
+}
+
+// testPolicy returns a policy whose "remote" profile forwards to the
+// remote server, and whose default profile signs locally.
+func testPolicy(remote string) *config.Signing {
+	return &config.Signing{
+		Profiles: map[string]*config.SigningProfile{
+			"remote": {
+				Usage:        []string{"server auth"},
+				Expiry:       time.Hour,
+				NamePolicy:   &config.NamePolicy{AllowedSuffixes: []string{"cloudflare.com"}},
+				RemoteName:   "upstream",
+				RemoteServer: remote,
+			},
+		},
+		Default: &config.SigningProfile{
+			Usage:  []string{"server auth"},
+			Expiry: time.Hour,
+		},
+	}
+}
+
+func readCSR(t *testing.T) string {
+	csr, err := ioutil.ReadFile(testCSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(csr)
+}
+
+func TestSign(t *testing.T) {
+	var count int32
+	ts := newTestServer(&count)
+	defer ts.Close()
+
+	s, err := NewSigner(testPolicy(strings.TrimPrefix(ts.URL, "http://")), testCaFile, testCaKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr := readCSR(t)
+
+	cert, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: csr, Profile: "remote"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cert) != testCertificate || count != 1 {
+		t.Fatalf("Request for a remote profile not forwarded: got %q after %d requests", cert, count)
+	}
+
+	cert, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: csr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatal("Request for a local profile forwarded.")
+	}
+	if _, err = helpers.ParseCertificatePEM(cert); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignValidatesLocally(t *testing.T) {
+	var count int32
+	ts := newTestServer(&count)
+	defer ts.Close()
+
+	s, err := NewSigner(testPolicy(strings.TrimPrefix(ts.URL, "http://")), testCaFile, testCaKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr := readCSR(t)
+
+	for _, req := range []signer.SignRequest{
+		{Hosts: []string{"example.com"}, Request: csr, Profile: "remote"},
+		{Request: csr, Profile: "remote"},
+		{Hosts: []string{"cloudflare.com"}, Request: "not a csr", Profile: "remote"},
+		{Hosts: []string{"cloudflare.com"}, Request: csr, Profile: "remote", NotAfter: time.Now().Add(2 * time.Hour)},
+	} {
+		if _, err = s.Sign(req); err == nil {
+			t.Fatalf("Expected error signing %+v", req)
+		}
+	}
+	if count != 0 {
+		t.Fatal("Invalid request forwarded to the remote server.")
+	}
+}
+
+// Without a CA, a signer still forwards requests for remote profiles,
+// as long as the policy has one, and refuses requests for local ones.
+func TestNewSignerRemoteOnly(t *testing.T) {
+	var count int32
+	ts := newTestServer(&count)
+	defer ts.Close()
+
+	policy := testPolicy(strings.TrimPrefix(ts.URL, "http://"))
+	s, err := NewSigner(policy, "ca.pem", "ca-key.pem", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Certificate(); err == nil {
+		t.Fatal("Expected error getting the certificate of a signer without a CA.")
+	}
+	csr := readCSR(t)
+	if _, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: csr, Profile: "remote"}); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatal("Request not forwarded to the remote server.")
+	}
+	if _, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: csr}); err == nil {
+		t.Fatal("Expected error signing for a local profile without a CA.")
+	}
+	if count != 1 {
+		t.Fatal("Request for a local profile forwarded.")
+	}
+
+	delete(policy.Profiles, "remote")
+	if _, err = NewSigner(policy, "ca.pem", "ca-key.pem", nil); err == nil {
+		t.Fatal("Expected error creating a signer without a CA or a remote server.")
+	}
+}
@@ -19,7 +19,8 @@ func hashPriority(cert *x509.Certificate) int {
 		return 10
 	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512,
 		x509.DSAWithSHA256, x509.SHA256WithRSA, x509.SHA384WithRSA,
-		x509.SHA512WithRSA:
+		x509.SHA512WithRSA, x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS,
+		x509.SHA512WithRSAPSS, x509.PureEd25519:
 		return 100
 	default:
 		return 0
@@ -27,7 +28,7 @@ func hashPriority(cert *x509.Certificate) int {
 }
 
 // Compute the priority of different key algorithm based performance and security
-// ECDSA>RSA>DSA>Unknown
+// Ed25519>ECDSA>RSA>DSA>Unknown
 func keyAlgoPriority(cert *x509.Certificate) int {
 	switch cert.PublicKeyAlgorithm {
 	case x509.ECDSA:
@@ -53,6 +54,8 @@ func keyAlgoPriority(cert *x509.Certificate) int {
 		default:
 			return 0
 		}
+	case x509.Ed25519:
+		return 150
 	// we do not want to bundle a DSA cert.
 	case x509.DSA:
 		return 0
@@ -25,13 +25,15 @@ const (
 // RSA and DSA are considered ubiquitous.
 // ECDSA256 and ECDSA384 should be supported by TLS 1.2 and have limited support
 // from TLS 1.0 and 1.1, based on RFC6460.  And ECDSA521 are relatively less supported
-// as a standard.
+// as a standard. Ed25519 certificates are only accepted by recent clients,
+// mostly over TLS 1.3 (RFC 8446).
 const (
 	RSAUbiquity         KeyAlgoUbiquity = 100
 	DSAUbiquity         KeyAlgoUbiquity = 100
 	ECDSA256Ubiquity    KeyAlgoUbiquity = 70
 	ECDSA384Ubiquity    KeyAlgoUbiquity = 70
 	ECDSA521Ubiquity    KeyAlgoUbiquity = 30
+	Ed25519Ubiquity     KeyAlgoUbiquity = 20
 	UnknownAlgoUbiquity KeyAlgoUbiquity = 0
 )
 
@@ -44,7 +46,8 @@ func hashUbiquity(cert *x509.Certificate) HashUbiquity {
 		return SHA1Ubiquity
 	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512,
 		x509.DSAWithSHA256, x509.SHA256WithRSA, x509.SHA384WithRSA,
-		x509.SHA512WithRSA:
+		x509.SHA512WithRSA, x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS,
+		x509.SHA512WithRSAPSS, x509.PureEd25519:
 		return SHA2Ubiquity
 	case x509.MD5WithRSA, x509.MD2WithRSA:
 		return MD5Ubiquity
@@ -54,7 +57,7 @@ func hashUbiquity(cert *x509.Certificate) HashUbiquity {
 }
 
 // keyAlgoUbiquity compute the ubiquity of the cert's public key algorithm
-// RSA, DSA>ECDSA>Unknown
+// RSA, DSA>ECDSA>Ed25519>Unknown
 func keyAlgoUbiquity(cert *x509.Certificate) KeyAlgoUbiquity {
 	switch cert.PublicKeyAlgorithm {
 	case x509.ECDSA:
@@ -76,6 +79,8 @@ func keyAlgoUbiquity(cert *x509.Certificate) KeyAlgoUbiquity {
 		}
 	case x509.DSA:
 		return DSAUbiquity
+	case x509.Ed25519:
+		return Ed25519Ubiquity
 	default:
 		return UnknownAlgoUbiquity
 	}
@@ -13,12 +13,14 @@ const (
 	rsa2048  = "testdata/rsa2048sha2.pem"
 	rsa3072  = "testdata/rsa3072sha2.pem"
 	rsa4096  = "testdata/rsa4096sha2.pem"
+	rsaPSS   = "testdata/rsa2048pss.pem"
 	ecdsa256 = "testdata/ecdsa256sha2.pem"
 	ecdsa384 = "testdata/ecdsa384sha2.pem"
 	ecdsa521 = "testdata/ecdsa521sha2.pem"
+	ed25519  = "testdata/ed25519.pem"
 )
 
-var rsa1024Cert, rsa2048Cert, rsa3072Cert, rsa4096Cert, ecdsa256Cert, ecdsa384Cert, ecdsa521Cert *x509.Certificate
+var rsa1024Cert, rsa2048Cert, rsa3072Cert, rsa4096Cert, rsaPSSCert, ecdsa256Cert, ecdsa384Cert, ecdsa521Cert, ed25519Cert *x509.Certificate
 
 func readCert(filename string) *x509.Certificate {
 	bytes, _ := ioutil.ReadFile(filename)
@@ -30,9 +32,11 @@ func init() {
 	rsa2048Cert = readCert(rsa2048)
 	rsa3072Cert = readCert(rsa3072)
 	rsa4096Cert = readCert(rsa4096)
+	rsaPSSCert = readCert(rsaPSS)
 	ecdsa256Cert = readCert(ecdsa256)
 	ecdsa384Cert = readCert(ecdsa384)
 	ecdsa521Cert = readCert(ecdsa521)
+	ed25519Cert = readCert(ed25519)
 
 }
 
@@ -55,6 +59,9 @@ func TestCertHashPriority(t *testing.T) {
 	if hashPriority(ecdsa384Cert) > hashPriority(ecdsa256Cert) {
 		t.Fatal("Incorrect hash priority")
 	}
+	if hashPriority(rsaPSSCert) != hashPriority(rsa2048Cert) {
+		t.Fatal("Incorrect hash priority")
+	}
 }
 
 func TestCertKeyAlgoPriority(t *testing.T) {
@@ -73,6 +80,9 @@ func TestCertKeyAlgoPriority(t *testing.T) {
 	if keyAlgoPriority(ecdsa384Cert) > keyAlgoPriority(ecdsa521Cert) {
 		t.Fatal("Incorrect hash priority")
 	}
+	if keyAlgoPriority(ecdsa521Cert) > keyAlgoPriority(ed25519Cert) {
+		t.Fatal("Incorrect hash priority")
+	}
 }
 func TestChainHashPriority(t *testing.T) {
 	var chain []*x509.Certificate
@@ -118,6 +128,9 @@ func TestCertHashUbiquity(t *testing.T) {
 	if hashUbiquity(ecdsa384Cert) < hashUbiquity(ecdsa256Cert) {
 		t.Fatal("Incorrect hash ubiquity")
 	}
+	if hashUbiquity(rsaPSSCert) != SHA2Ubiquity {
+		t.Fatal("Incorrect hash ubiquity")
+	}
 }
 
 func TestCertKeyAlgoUbiquity(t *testing.T) {
@@ -154,6 +167,12 @@ func TestCertKeyAlgoUbiquity(t *testing.T) {
 	if keyAlgoUbiquity(ecdsa384Cert) < keyAlgoUbiquity(ecdsa256Cert) {
 		t.Fatal("Incorrect hash ubiquity")
 	}
+	if keyAlgoUbiquity(ed25519Cert) != Ed25519Ubiquity {
+		t.Fatal("incorrect hash ubiquity")
+	}
+	if keyAlgoUbiquity(ecdsa521Cert) < keyAlgoUbiquity(ed25519Cert) {
+		t.Fatal("Incorrect hash ubiquity")
+	}
 }
 
 func TestChainHashUbiquity(t *testing.T) {